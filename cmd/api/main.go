@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/server"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Refuse to start on a bad config rather than falling back to defaults
+	cfg := server.ConfigFromEnv("API", ":8080")
+	telemetry, err := tel.Init(ctx,
+		tel.WithServiceName("api"),
+		tel.WithTraces(),
+		tel.WithMetrics(),
+		tel.WithLogs(), // used for access logs
+	)
+	if err = errors.Join(err, cfg.Validate()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer telemetry.Shutdown(ctx)
+
+	// team, cost center... from OTEL_STATIC_ATTRIBUTES on every server span
+	middleware.AddEnricher(middleware.StaticAttributes(telemetry.StaticAttributes()...))
+
+	// kill -HUP rebuilds the span exporter, e.g. after the collector moved
+	telemetry.ReloadOn(ctx, syscall.SIGHUP)
+
+	userstoreURL := os.Getenv("USERSTORE_URL")
+	if userstoreURL == "" {
+		userstoreURL = "http://localhost:8081"
+	}
+
+	target, err := url.Parse(userstoreURL)
+	if err != nil {
+		logging.Default().Error("Invalid USERSTORE_URL", "error", err)
+		os.Exit(1)
+	}
+
+	// Name the dependency in service graphs, unless OTEL_PEER_SERVICE_MAPPING says otherwise
+	tel.RegisterPeerService(target.Host, "userstore")
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = tel.NewTransport(http.DefaultTransport)
+
+	// Every user route is served by the userstore. API_ROUTER=nethttp serves
+	// them from a plain http.ServeMux instead of gin, with the same server spans.
+	if os.Getenv("API_ROUTER") == "nethttp" {
+		err = server.RunHandler(newMux(proxy), cfg)
+	} else {
+		err = server.Run(newRouter(proxy), cfg)
+	}
+	if err != nil {
+		logging.Default().Error("Error serving", "error", err)
+		os.Exit(1)
+	}
+}
+
+// routes lists the routes forwarded to the userstore, with gin path parameters
+var routes = []struct {
+	method, path string
+}{
+	{http.MethodGet, "/api/v1/user"},
+	{http.MethodGet, "/api/v1/user/:id"},
+	{http.MethodGet, "/api/v1/user/:id/groups"},
+	{http.MethodPost, "/api/v1/user/:id/groups"},
+	{http.MethodPost, "/api/v1/user"},
+	{http.MethodPatch, "/api/v1/user/:id"},
+	{http.MethodDelete, "/api/v1/user/:id"},
+	{http.MethodPut, "/api/v1/user/:id/avatar"},
+	{http.MethodGet, "/ui/users"},
+	{http.MethodGet, "/api/v1/users/export"},
+	{http.MethodGet, "/api/v1/stats/users"},
+	{http.MethodGet, "/api/v2/user"},
+	{http.MethodGet, "/api/v2/user/:id"},
+	{http.MethodPost, "/api/v2/user"},
+	{http.MethodGet, "/api/v2/user/:id/groups"},
+	{http.MethodPost, "/api/v2/user/:id/groups"},
+	{http.MethodGet, "/api/v2/stats/users"},
+	{http.MethodPost, "/admin/users/update-many"},
+	{http.MethodPost, "/admin/users/delete-many"},
+	{http.MethodPost, "/auth/login"},
+}
+
+func newRouter(proxy http.Handler) *gin.Engine {
+	// gin.Default would add its console logger, access logs go through OTel instead
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Server spans and request metrics
+	router.Use(middleware.Server())
+	router.Use(middleware.ErrorIDs())
+	router.Use(logging.Middleware())
+	router.Use(middleware.Session(middleware.SessionConfigFromEnv()))
+	router.Use(middleware.Protocol())
+	router.Use(middleware.AccessLog(middleware.AccessLogConfigFromEnv()))
+
+	// Reject requests early when the service is overloaded
+	router.Use(middleware.LoadShed(middleware.LoadShedConfigFromEnv()))
+
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	forward := func(c *gin.Context) {
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+	for _, route := range routes {
+		router.Handle(route.method, route.path, forward)
+	}
+	router.NoRoute(middleware.NoRoute())
+
+	return router
+}
+
+// newMux is the net/http variant of newRouter. Only the server spans are
+// shared, the other middlewares are written for gin.
+func newMux(proxy http.Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /healthz", middleware.Route("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	})))
+
+	for _, route := range routes {
+		path := muxPath(route.path)
+		mux.Handle(route.method+" "+path, middleware.Route(path, proxy))
+	}
+
+	return middleware.Handler(mux)
+}
+
+// muxPath turns the gin parameters of path (":id") into ServeMux wildcards ("{id}")
+func muxPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
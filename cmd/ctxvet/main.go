@@ -0,0 +1,179 @@
+// Command ctxvet reports the contexts re-wrapped with the span they already
+// carry, e.g.
+//
+//	span := trace.SpanFromContext(c.Request.Context())
+//	ctx := trace.ContextWithSpan(c.Request.Context(), span)
+//
+// where ctx is just c.Request.Context(), tel.Ctx(c) in handlers. Both the
+// inline form and the span going through a variable are caught.
+//
+//	go run ./cmd/ctxvet ./...
+//
+// It exits with 1 when it found any, so it can run next to go vet in CI.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const tracePackage = "go.opentelemetry.io/otel/trace"
+
+func main() {
+	patterns := os.Args[1:]
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	fset := token.NewFileSet()
+	found := 0
+	for _, pattern := range patterns {
+		files, err := goFiles(pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		for _, path := range files {
+			f, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+
+			for _, pos := range check(fset, f) {
+				fmt.Printf("%s: trace.ContextWithSpan wraps the context with the span it already holds, use the context as is\n", fset.Position(pos))
+				found++
+			}
+		}
+	}
+
+	if found > 0 {
+		os.Exit(1)
+	}
+}
+
+// goFiles lists the Go files of a directory, or of its whole tree for dir/...
+func goFiles(pattern string) ([]string, error) {
+	dir, recursive := strings.CutSuffix(pattern, "/...")
+	if dir == "" {
+		dir = "."
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (!recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// check returns the position of every redundant trace.ContextWithSpan of f
+func check(fset *token.FileSet, f *ast.File) []token.Pos {
+	traceName := ""
+	for _, imp := range f.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == tracePackage {
+			traceName = "trace"
+			if imp.Name != nil {
+				traceName = imp.Name.Name
+			}
+		}
+	}
+	if traceName == "" || traceName == "_" {
+		return nil
+	}
+
+	var found []token.Pos
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		// spanOf maps the variables holding trace.SpanFromContext(ctx) to ctx
+		spanOf := map[string]string{}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i, lhs := range n.Lhs {
+					ident, ok := lhs.(*ast.Ident)
+					if !ok {
+						continue
+					}
+					if ctx, ok := traceCall(n.Rhs[i], traceName, "SpanFromContext"); ok {
+						spanOf[ident.Name] = render(fset, ctx[0])
+					} else {
+						delete(spanOf, ident.Name)
+					}
+				}
+			case *ast.CallExpr:
+				args, ok := traceCall(n, traceName, "ContextWithSpan")
+				if !ok || len(args) != 2 {
+					return true
+				}
+
+				ctx := render(fset, args[0])
+				if inner, ok := traceCall(args[1], traceName, "SpanFromContext"); ok && render(fset, inner[0]) == ctx {
+					found = append(found, n.Pos())
+				} else if ident, ok := args[1].(*ast.Ident); ok && spanOf[ident.Name] == ctx {
+					found = append(found, n.Pos())
+				}
+			}
+			return true
+		})
+	}
+
+	return found
+}
+
+// traceCall returns the arguments of e when it's a call of the trace function
+// called name
+func traceCall(e ast.Expr, traceName, name string) ([]ast.Expr, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return nil, false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Name != traceName || len(call.Args) == 0 {
+		return nil, false
+	}
+
+	return call.Args, true
+}
+
+// render prints e, two expressions printing the same are taken as the same
+// context
+func render(fset *token.FileSet, e ast.Expr) string {
+	var b bytes.Buffer
+	printer.Fprint(&b, fset, e)
+	return b.String()
+}
@@ -0,0 +1,181 @@
+// Command fixtures runs a scripted sequence of requests through the userstore
+// and writes the spans of each one as an OTLP/JSON fixture, normalized by
+// tel.WriteFixture so the examples of the other languages can assert the same
+// attributes byte for byte. It needs the MongoDB at MONGO_URI, e.g. the one of
+// docker-compose.yaml, and is run by go generate:
+//
+//	go generate ./cmd/fixtures
+//
+//go:generate go run . -out ../../testdata/fixtures
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fixtureUser is created by the script, and removed before it runs
+const fixtureUser = "fixture-user"
+
+// step is one request of the script, written to <Name>.json
+type step struct {
+	Name     string
+	Method   string
+	Path     string
+	Username string
+	Body     any
+}
+
+// script is the request sequence, in order. Every value is fixed so the
+// spans are the same from one run to the next.
+var script = []step{
+	{Name: "create_user", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: map[string]any{
+		"id": fixtureUser, "name": "Fixture", "phone_no": 5550199, "password": "fixture-password",
+	}},
+	{Name: "create_invalid_user", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: map[string]any{"name": "no id"}},
+	{Name: "get_unknown_user", Method: http.MethodGet, Path: "/api/v1/user/000000000000000000000000", Username: "alice"},
+	{Name: "get_user_without_token", Method: http.MethodGet, Path: "/api/v1/user/000000000000000000000000"},
+	{Name: "login", Method: http.MethodPost, Path: "/auth/login", Body: map[string]any{"username": fixtureUser, "password": "fixture-password"}},
+	{Name: "login_wrong_password", Method: http.MethodPost, Path: "/auth/login", Body: map[string]any{"username": fixtureUser, "password": "wrong-password"}},
+}
+
+func main() {
+	out := flag.String("out", "testdata/fixtures", "directory the fixtures are written to")
+	flag.Parse()
+
+	if err := run(context.Background(), *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, out string) error {
+	spans := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSyncer(spans),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "userstore"))),
+	)
+	defer provider.Shutdown(ctx)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	repo := userstore.NewInstrumentedRepository(userstore.NewMongoRepository(os.Getenv("MONGO_URI")))
+	userstore.UseRepository(repo)
+	defer repo.Disconnect(ctx)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(middleware.Server())
+	router.Use(middleware.ErrorIDs())
+	userstore.Register(router)
+
+	startCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	userstore.RunStartup(startCtx, provider)
+	if startCtx.Err() != nil {
+		return fmt.Errorf("userstore did not become ready: %w", startCtx.Err())
+	}
+
+	if _, err := repo.DeleteMany(ctx, bson.M{"id": fixtureUser}); err != nil {
+		return fmt.Errorf("removing the user of the last run: %w", err)
+	}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+
+	for _, s := range script {
+		spans.Reset()
+		if err := s.send(server); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if !waitServerSpan(spans) {
+			return fmt.Errorf("%s: no server span ended within %s", s.Name, spanWait)
+		}
+
+		var buf bytes.Buffer
+		if err := tel.WriteFixture(ctx, &buf, spans.GetSpans().Snapshots()); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if err := os.WriteFile(filepath.Join(out, s.Name+".json"), buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// spanWait bounds how long to wait for the server span, which ends right
+// after the answer is written
+const spanWait = 2 * time.Second
+
+func waitServerSpan(spans *tracetest.InMemoryExporter) bool {
+	for deadline := time.Now().Add(spanWait); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, span := range spans.GetSpans() {
+			if span.SpanKind == trace.SpanKindServer {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// send makes the request, the answer itself isn't part of the fixture
+func (s step) send(server *httptest.Server) error {
+	var body io.Reader
+	if s.Body != nil {
+		payload, err := json.Marshal(s.Body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(s.Method, server.URL+s.Path, body)
+	if err != nil {
+		return err
+	}
+	if s.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.Username != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Username)
+	}
+	req.Header.Set("User-Agent", "fixtures")
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// Command gen-collector-config prints an OpenTelemetry Collector config that
+// forwards the app's telemetry to the backend it's configured to export to,
+// with the same endpoint, headers, OAuth2 credentials and TLS settings. Point the app at the
+// collector afterwards, e.g. OTEL_OTLP_HTTP_ENDPOINT=localhost:4318; the
+// receiver accepts the app's URL paths, so nothing else has to change.
+//
+//	go run ./cmd/gen-collector-config > collector.yaml
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/template"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+)
+
+// exporter is a collector exporter for one of the targets
+type exporter struct {
+	Name   string
+	Target tel.OTLPTarget
+	// Headers are sorted by name so the output is stable
+	Headers []header
+}
+
+type header struct {
+	Name, Value string
+}
+
+var collectorConfig = template.Must(template.New("collector").Funcs(template.FuncMap{"scheme": scheme}).Parse(`# Generated by cmd/gen-collector-config
+receivers:
+  otlp:
+    protocols:
+      grpc:
+        endpoint: {{ printf "%q" .GRPCEndpoint }}
+      http:
+        endpoint: {{ printf "%q" .HTTPEndpoint }}
+        traces_url_path: {{ printf "%q" .TracesURLPath }}
+        metrics_url_path: {{ printf "%q" .MetricsURLPath }}
+        logs_url_path: {{ printf "%q" .LogsURLPath }}
+{{ with .OAuth2 }}
+extensions:
+  oauth2client:
+    client_id: {{ printf "%q" .ClientID }}
+    client_secret: {{ printf "%q" .ClientSecret }}
+    token_url: {{ printf "%q" .TokenURL }}
+{{- if .Scopes }}
+    scopes: [{{ range $i, $s := .Scopes }}{{ if $i }}, {{ end }}{{ printf "%q" $s }}{{ end }}]
+{{- end }}
+{{- if .Audience }}
+    endpoint_params:
+      audience: {{ printf "%q" .Audience }}
+{{- end }}
+{{ end }}
+processors:
+  memory_limiter:
+    check_interval: 1s
+    limit_percentage: 80
+    spike_limit_percentage: 25
+  batch: {}
+
+exporters:
+{{- range .Exporters }}
+  {{ .Name }}:
+{{- if eq .Target.Protocol "grpc" }}
+    endpoint: {{ printf "%q" .Target.Endpoint }}
+{{- else }}
+    {{ .Target.Signal }}_endpoint: {{ printf "%q" (print (scheme .Target) "://" .Target.Endpoint .Target.URLPath) }}
+{{- end }}
+{{- if .Headers }}
+    headers:
+{{- range .Headers }}
+      {{ .Name }}: {{ printf "%q" .Value }}
+{{- end }}
+{{- end }}
+{{- if .Target.OAuth2 }}
+    auth:
+      authenticator: oauth2client
+{{- end }}
+    tls:
+      insecure: {{ .Target.Insecure }}
+{{- end }}
+
+service:
+{{- if .OAuth2 }}
+  extensions: [oauth2client]
+{{- end }}
+  pipelines:
+{{- range .Exporters }}
+    {{ .Target.Signal }}:
+      receivers: [otlp]
+      processors: [memory_limiter, batch]
+      exporters: [{{ .Name }}]
+{{- end }}
+`))
+
+func main() {
+	cfg := tel.ConfigFromEnv("gen-collector-config")
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	targets, err := tel.OTLPTargets(cfg)
+	if err != nil {
+		logging.Default().Error("Can't generate a collector config", "error", err)
+		os.Exit(1)
+	}
+
+	data := struct {
+		GRPCEndpoint, HTTPEndpoint                 string
+		TracesURLPath, MetricsURLPath, LogsURLPath string
+		Exporters                                  []exporter
+		OAuth2                                     *tel.OAuth2Config
+	}{
+		GRPCEndpoint: envOr("COLLECTOR_GRPC_ENDPOINT", "0.0.0.0:4317"),
+		HTTPEndpoint: envOr("COLLECTOR_HTTP_ENDPOINT", "0.0.0.0:4318"),
+	}
+
+	if cfg.OAuth2.Enabled() {
+		data.OAuth2 = &cfg.OAuth2
+	}
+
+	for _, target := range targets {
+		kind := "otlphttp"
+		if target.Protocol == "grpc" {
+			kind = "otlp"
+		}
+
+		exp := exporter{Name: kind + "/" + target.Signal, Target: target}
+		for name, value := range target.Headers {
+			exp.Headers = append(exp.Headers, header{Name: name, Value: value})
+		}
+		sort.Slice(exp.Headers, func(i, j int) bool { return exp.Headers[i].Name < exp.Headers[j].Name })
+		data.Exporters = append(data.Exporters, exp)
+
+		// The receiver takes the app's paths so it can stand in for the backend
+		switch target.Signal {
+		case "traces":
+			data.TracesURLPath = target.URLPath
+		case "metrics":
+			data.MetricsURLPath = target.URLPath
+		case "logs":
+			data.LogsURLPath = target.URLPath
+		}
+	}
+	if data.TracesURLPath == "" {
+		data.TracesURLPath = "/v1/traces"
+	}
+
+	if err := collectorConfig.Execute(os.Stdout, data); err != nil {
+		logging.Default().Error("Writing the collector config failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// scheme is the URL scheme of an OTLP/HTTP target
+func scheme(target tel.OTLPTarget) string {
+	if target.Insecure {
+		return "http"
+	}
+
+	return "https"
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
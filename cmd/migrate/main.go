@@ -0,0 +1,42 @@
+// Command migrate applies the pending userstore migrations to MONGO_URI and
+// exits, for deployments that don't migrate at startup (MIGRATE_ON_STARTUP=false).
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+)
+
+func main() {
+	ctx := context.Background()
+
+	telemetry, err := tel.Init(ctx,
+		tel.WithServiceName("migrate"),
+		tel.WithResourceAttributes(userstore.ResourceAttributes()...),
+		tel.WithTraces(),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer telemetry.Shutdown(ctx)
+
+	repo := userstore.NewInstrumentedRepository(userstore.NewMongoRepository(os.Getenv("MONGO_URI")))
+	defer repo.Disconnect(ctx)
+
+	applied, err := repo.Migrate(ctx)
+	if err != nil {
+		// Exiting would skip the deferred Shutdown and lose the failed span
+		logging.Default().Error("Migration failed", "error", err)
+		repo.Disconnect(ctx)
+		telemetry.Shutdown(ctx)
+		os.Exit(1)
+	}
+
+	logging.Default().Info("Migrations done", "applied", applied)
+}
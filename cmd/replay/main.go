@@ -0,0 +1,359 @@
+// Command replay sends the HTTP requests of a recording again, to a target,
+// at the pace they were recorded at: for load tests shaped like real traffic,
+// and to compare the spans two versions of the app record for the same
+// requests with cmd/tracediff. The recording is either OTLP/JSON export
+// requests, one or many in a row like the collector file exporter writes them,
+// whose SERVER spans are the requests, or a HAR file.
+//
+//	go run ./cmd/replay -target http://localhost:8080 spans.json
+//
+// Spans don't record the bodies nor the credentials: requests replayed from
+// them are sent without a body, with -token as the bearer token. HAR entries
+// are sent as recorded. The gaps between the requests are kept, divided by
+// -speed.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+)
+
+// recorded is a request of the recording
+type recorded struct {
+	at     time.Time
+	method string
+	// target is the path and query, sent to -target
+	target string
+	header http.Header
+	body   string
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL the requests are sent to")
+	speed := flag.Float64("speed", 1, "pace of the replay, 2 sends the requests twice as fast as recorded")
+	token := flag.String("token", "", "bearer token of the requests replayed from spans")
+	format := flag.String("format", "auto", "otlp, har, or auto to tell from the file")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: replay [-target url] [-speed n] [-token t] [-format otlp|har|auto] recording.json")
+		os.Exit(2)
+	}
+
+	requests, err := load(flag.Arg(0), *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *token != "" {
+		for _, r := range requests {
+			if r.header.Get("Authorization") == "" {
+				r.header.Set("Authorization", "Bearer "+*token)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	telemetry, err := tel.Init(ctx, tel.WithServiceName("replay"), tel.WithTraces())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	report := replay(ctx, strings.TrimSuffix(*target, "/"), requests, *speed)
+	telemetry.Shutdown(ctx)
+
+	report.print(os.Stdout)
+	if report.errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// load reads the recording, sorted by start time
+func load(path, format string) ([]*recorded, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "auto" {
+		format = "otlp"
+		var probe struct {
+			Log json.RawMessage `json:"log"`
+		}
+		if json.Unmarshal(raw, &probe) == nil && probe.Log != nil {
+			format = "har"
+		}
+	}
+
+	var requests []*recorded
+	switch format {
+	case "otlp":
+		requests, err = loadOTLP(raw)
+	case "har":
+		requests, err = loadHAR(raw)
+	default:
+		return nil, fmt.Errorf("unknown format %q, use otlp, har or auto", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%s: no request to replay", path)
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].at.Before(requests[j].at) })
+	return requests, nil
+}
+
+// otlpRequest is the part of an OTLP/JSON ExportTraceServiceRequest replay
+// looks at
+type otlpRequest struct {
+	ResourceSpans []struct {
+		ScopeSpans []struct {
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type otlpSpan struct {
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId"`
+	Kind              json.RawMessage `json:"kind"`
+	StartTimeUnixNano json.Number     `json:"startTimeUnixNano"`
+	Attributes        []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+}
+
+func (s otlpSpan) attribute(keys ...string) string {
+	for _, key := range keys {
+		for _, a := range s.Attributes {
+			if a.Key == key {
+				return a.Value.StringValue
+			}
+		}
+	}
+
+	return ""
+}
+
+// loadOTLP returns the requests of the SERVER spans. The ones whose parent is
+// in the recording too are hops of a recorded request, e.g. from the api to
+// the userstore, the request they stem from already makes them.
+func loadOTLP(raw []byte) ([]*recorded, error) {
+	var spans []otlpSpan
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		var req otlpRequest
+		err := dec.Decode(&req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+
+	recordedSpans := map[string]bool{}
+	for _, span := range spans {
+		recordedSpans[span.SpanID] = true
+	}
+
+	var requests []*recorded
+	for _, span := range spans {
+		kind := strings.Trim(strings.TrimSpace(string(span.Kind)), `"`)
+		if kind != "2" && kind != "SPAN_KIND_SERVER" {
+			continue
+		}
+		if span.ParentSpanID != "" && recordedSpans[span.ParentSpanID] {
+			continue
+		}
+
+		method := span.attribute("http.request.method_original", "http.request.method", "http.method")
+		path := span.attribute("url.path", "http.target")
+		if method == "" || path == "" {
+			continue
+		}
+		if query := span.attribute("url.query"); query != "" && !strings.Contains(path, "?") {
+			path += "?" + query
+		}
+
+		start, err := strconv.ParseInt(span.StartTimeUnixNano.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("span %s: startTimeUnixNano: %w", span.SpanID, err)
+		}
+
+		requests = append(requests, &recorded{at: time.Unix(0, start), method: method, target: path, header: http.Header{}})
+	}
+
+	return requests, nil
+}
+
+// har is the part of a HAR file replay looks at
+type har struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// harSkippedHeaders are set by the client for the target, not replayed
+var harSkippedHeaders = map[string]bool{
+	"host": true, "content-length": true, "connection": true, "accept-encoding": true,
+	"traceparent": true, "tracestate": true, "baggage": true,
+}
+
+func loadHAR(raw []byte) ([]*recorded, error) {
+	var h har
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, err
+	}
+
+	var requests []*recorded
+	for _, entry := range h.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &recorded{at: entry.StartedDateTime, method: entry.Request.Method, target: u.RequestURI(), header: http.Header{}}
+		for _, header := range entry.Request.Headers {
+			// HTTP/2 pseudo headers like :authority
+			if strings.HasPrefix(header.Name, ":") || harSkippedHeaders[strings.ToLower(header.Name)] {
+				continue
+			}
+			r.header.Add(header.Name, header.Value)
+		}
+		if entry.Request.PostData != nil {
+			r.body = entry.Request.PostData.Text
+			if r.header.Get("Content-Type") == "" && entry.Request.PostData.MimeType != "" {
+				r.header.Set("Content-Type", entry.Request.PostData.MimeType)
+			}
+		}
+
+		requests = append(requests, r)
+	}
+
+	return requests, nil
+}
+
+// report sums up a replay
+type report struct {
+	mu       sync.Mutex
+	sent     int
+	errors   int
+	statuses map[int]int
+	// lag is the most a request was sent after its time
+	lag      time.Duration
+	recorded time.Duration
+	took     time.Duration
+}
+
+// replay sends every request at its offset from the first one, divided by
+// speed, without waiting for the answers of the previous ones
+func replay(ctx context.Context, target string, requests []*recorded, speed float64) *report {
+	client := &http.Client{Transport: tel.NewTransport(http.DefaultTransport)}
+	rep := &report{statuses: map[int]int{}, recorded: requests[len(requests)-1].at.Sub(requests[0].at)}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, r := range requests {
+		due := start.Add(time.Duration(float64(r.at.Sub(requests[0].at)) / speed))
+		time.Sleep(time.Until(due))
+		lag := time.Since(due)
+
+		wg.Add(1)
+		go func(r *recorded) {
+			defer wg.Done()
+			status, err := send(ctx, client, target, r)
+
+			rep.mu.Lock()
+			defer rep.mu.Unlock()
+			rep.sent++
+			rep.lag = max(rep.lag, lag)
+			if err != nil {
+				rep.errors++
+				fmt.Fprintf(os.Stderr, "%s %s: %v\n", r.method, r.target, err)
+				return
+			}
+			rep.statuses[status]++
+		}(r)
+	}
+	wg.Wait()
+	rep.took = time.Since(start)
+
+	return rep
+}
+
+func send(ctx context.Context, client *http.Client, target string, r *recorded) (int, error) {
+	var body io.Reader
+	if r.body != "" {
+		body = strings.NewReader(r.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, target+r.target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header = r.header.Clone()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "sent %d requests in %s (recorded over %s), %d failed, sent up to %s late\n",
+		r.sent, r.took.Round(time.Millisecond), r.recorded.Round(time.Millisecond), r.errors, r.lag.Round(time.Millisecond))
+
+	statuses := make([]int, 0, len(r.statuses))
+	for status := range r.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%d\t%d\n", status, r.statuses[status])
+	}
+}
@@ -0,0 +1,326 @@
+// Command seed loads fixture files into the users collection of MONGO_URI, so
+// demos and tests start from a known dataset:
+//
+//	go run ./cmd/seed testdata/seed/demo.yaml
+//
+// A file holds one or more YAML documents separated by ---, JSON being YAML a
+// static JSON file works too. A document either lists users, or asks for count
+// generated ones, the same seed always generating the same users:
+//
+//	kind: static
+//	users:
+//	  - {id: demo_admin, name: Demo Admin, phone_no: 5550100, password: demo}
+//	---
+//	kind: generated
+//	count: 500
+//	seed: 42
+//	id_prefix: demo_
+//	password: demo
+//
+// Users are upserted by id, so running it again only changes the users whose
+// fixture changed. Passwords are only set on insert. Each file and document
+// is traced as a span under the root span of the run, with progress events.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+var scope = tel.NewScope("github.com/neha-gupta1/otel-semantics/cmd/seed")
+
+// progressEvery is how many users are written between two progress events
+const progressEvery = 100
+
+// document is one YAML document of a fixture file
+type document struct {
+	Kind  string `yaml:"kind"`
+	Users []user `yaml:"users"`
+
+	// generated documents
+	Count    int    `yaml:"count"`
+	Seed     int64  `yaml:"seed"`
+	IDPrefix string `yaml:"id_prefix"`
+	Password string `yaml:"password"`
+}
+
+type user struct {
+	ID          string         `yaml:"id"`
+	Name        string         `yaml:"name"`
+	PhoneNo     int            `yaml:"phone_no"`
+	Password    string         `yaml:"password"`
+	Preferences map[string]any `yaml:"preferences"`
+}
+
+// counts are the outcomes of the upserts
+type counts struct {
+	inserted, updated, unchanged int
+}
+
+func (c *counts) add(o counts) {
+	c.inserted += o.inserted
+	c.updated += o.updated
+	c.unchanged += o.unchanged
+}
+
+func (c counts) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("seed.users.inserted", c.inserted),
+		attribute.Int("seed.users.updated", c.updated),
+		attribute.Int("seed.users.unchanged", c.unchanged),
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: seed [file...], testdata/seed/*.yaml by default")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files, _ = filepath.Glob("testdata/seed/*.yaml")
+	}
+	if len(files) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	telemetry, err := tel.Init(ctx,
+		tel.WithServiceName("seed"),
+		tel.WithResourceAttributes(userstore.ResourceAttributes()...),
+		tel.WithTraces(),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	repo := userstore.NewInstrumentedRepository(userstore.NewMongoRepository(os.Getenv("MONGO_URI")))
+	total, err := run(ctx, repo, files)
+	repo.Disconnect(ctx)
+
+	// Exiting would skip a deferred Shutdown and lose the spans
+	telemetry.Shutdown(ctx)
+	if err != nil {
+		logging.Default().Error("Seeding failed", "error", err)
+		os.Exit(1)
+	}
+
+	logging.Default().Info("Seeding done", "inserted", total.inserted, "updated", total.updated, "unchanged", total.unchanged)
+}
+
+func run(ctx context.Context, repo userstore.UserRepository, files []string) (total counts, err error) {
+	ctx, span := scope.StartInternalSpan(ctx, "seed", trace.WithAttributes(
+		attribute.String("process.executable.name", "seed"),
+		attribute.StringSlice("seed.files", files),
+	))
+	defer func() {
+		span.SetAttributes(total.attributes()...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// The unique index on id is what makes the upserts idempotent under
+	// concurrent runs
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return total, err
+	}
+
+	s := seeder{repo: repo, hashes: map[string]string{}}
+	for _, path := range files {
+		n, err := s.loadFile(ctx, path)
+		total.add(n)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return total, nil
+}
+
+type seeder struct {
+	repo userstore.UserRepository
+	// hashes keeps the hash of each password, hashing is slow on purpose
+	// and fixtures tend to share a few passwords
+	hashes map[string]string
+}
+
+func (s seeder) loadFile(ctx context.Context, path string) (n counts, err error) {
+	ctx, span := scope.StartInternalSpan(ctx, "LoadFixture", trace.WithAttributes(attribute.String("file.path", path)))
+	defer func() {
+		span.SetAttributes(n.attributes()...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return n, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	for i := 0; ; i++ {
+		var doc document
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		users, err := doc.users()
+		if err != nil {
+			return n, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		written, err := s.seedDocument(ctx, i, doc.Kind, users)
+		n.add(written)
+		if err != nil {
+			return n, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+}
+
+func (s seeder) seedDocument(ctx context.Context, index int, kind string, users []user) (n counts, err error) {
+	ctx, span := scope.StartInternalSpan(ctx, "SeedDocument", trace.WithAttributes(
+		attribute.Int("seed.document.index", index),
+		attribute.String("seed.document.kind", kind),
+		attribute.Int("seed.users.count", len(users)),
+	))
+	defer func() {
+		span.SetAttributes(n.attributes()...)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for i, u := range users {
+		hash, err := s.hash(ctx, u.Password)
+		if err != nil {
+			return n, err
+		}
+
+		inserted, modified, err := s.repo.Upsert(ctx, userstore.Users{
+			ID:           u.ID,
+			Name:         u.Name,
+			PhoneNo:      u.PhoneNo,
+			Preferences:  u.Preferences,
+			PasswordHash: hash,
+		})
+		if err != nil {
+			return n, fmt.Errorf("user %q: %w", u.ID, err)
+		}
+
+		switch {
+		case inserted:
+			n.inserted++
+		case modified:
+			n.updated++
+		default:
+			n.unchanged++
+		}
+
+		if done := i + 1; done%progressEvery == 0 || done == len(users) {
+			span.AddEvent("seed.progress", trace.WithAttributes(attribute.Int("seed.users.done", done)))
+			logging.FromContext(ctx).Info("Seeding", "document", index, "done", done, "of", len(users))
+		}
+	}
+
+	return n, nil
+}
+
+func (s seeder) hash(ctx context.Context, password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if hash, ok := s.hashes[password]; ok {
+		return hash, nil
+	}
+
+	hash, err := userstore.HashPassword(ctx, userstore.Password(password))
+	if err != nil {
+		return "", err
+	}
+	s.hashes[password] = hash
+
+	return hash, nil
+}
+
+// users returns the users of the document, checked for the fields the api
+// requires
+func (doc document) users() ([]user, error) {
+	var users []user
+	switch doc.Kind {
+	case "static", "":
+		users = doc.Users
+	case "generated":
+		if doc.Count <= 0 {
+			return nil, errors.New("generated documents need a positive count")
+		}
+		users = generate(doc)
+	default:
+		return nil, fmt.Errorf("unknown kind %q, static or generated", doc.Kind)
+	}
+
+	for _, u := range users {
+		if u.ID == "" || u.Name == "" || u.PhoneNo == 0 {
+			return nil, fmt.Errorf("user %q: id, name and phone_no are required", u.ID)
+		}
+	}
+
+	return users, nil
+}
+
+var (
+	firstNames = []string{"Ada", "Alan", "Barbara", "Dennis", "Edsger", "Frances", "Grace", "Ken", "Leslie", "Linus", "Margaret", "Niklaus", "Radia", "Rob", "Shafi", "Tim"}
+	lastNames  = []string{"Allen", "Hamilton", "Hopper", "Kernighan", "Knuth", "Lamport", "Liskov", "Lovelace", "Perlman", "Pike", "Ritchie", "Thompson", "Torvalds", "Turing", "Wirth"}
+	themes     = []string{"light", "dark", "system"}
+	languages  = []string{"en", "de", "fr", "hi", "ja", "pt"}
+)
+
+// generate returns the users of a generated document, the same document
+// always giving the same users
+func generate(doc document) []user {
+	r := rand.New(rand.NewSource(doc.Seed))
+
+	users := make([]user, doc.Count)
+	for i := range users {
+		users[i] = user{
+			ID:       fmt.Sprintf("%s%05d", doc.IDPrefix, i+1),
+			Name:     firstNames[r.Intn(len(firstNames))] + " " + lastNames[r.Intn(len(lastNames))],
+			PhoneNo:  5550000000 + r.Intn(10000),
+			Password: doc.Password,
+			Preferences: map[string]any{
+				"theme":    themes[r.Intn(len(themes))],
+				"language": languages[r.Intn(len(languages))],
+			},
+		}
+	}
+
+	return users
+}
@@ -0,0 +1,337 @@
+// Command tracediff compares the spans two versions of the app recorded, to
+// check a semantic conventions migration did what it meant to. Both files hold
+// OTLP/JSON export requests, one or many in a row like the collector file
+// exporter writes them. The spans are matched by kind and name, and every
+// attribute difference is reported: keys added or removed, keys renamed
+// (a removed and an added key carrying the same values), and type changes.
+//
+//	go run ./cmd/tracediff old.json new.json
+//
+// It exits with 1 when there are differences, so it can gate CI.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// otlpRequest is the part of an OTLP/JSON ExportTraceServiceRequest tracediff
+// looks at
+type otlpRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				Name       string          `json:"name"`
+				Kind       json.RawMessage `json:"kind"`
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type otlpAttribute struct {
+	Key   string                     `json:"key"`
+	Value map[string]json.RawMessage `json:"value"`
+}
+
+// valueTypes are the AnyValue fields, named like in the attribute API
+var valueTypes = map[string]string{
+	"stringValue": "string",
+	"boolValue":   "bool",
+	"intValue":    "int",
+	"doubleValue": "double",
+	"arrayValue":  "array",
+	"kvlistValue": "map",
+	"bytesValue":  "bytes",
+}
+
+// spanKinds are the names of the OTLP span kinds, numbers in OTLP/JSON
+var spanKinds = map[string]string{
+	"0": "unspecified", "1": "internal", "2": "server", "3": "client", "4": "producer", "5": "consumer",
+	`"SPAN_KIND_UNSPECIFIED"`: "unspecified", `"SPAN_KIND_INTERNAL"`: "internal", `"SPAN_KIND_SERVER"`: "server",
+	`"SPAN_KIND_CLIENT"`: "client", `"SPAN_KIND_PRODUCER"`: "producer", `"SPAN_KIND_CONSUMER"`: "consumer",
+}
+
+// resourceGroup holds the resource attributes, next to the span groups
+const resourceGroup = "resource"
+
+// group is what a version recorded for the spans of one kind and name
+type group struct {
+	spans int
+	keys  map[string]*key
+}
+
+type key struct {
+	types  map[string]bool
+	values map[string]bool
+	seen   int
+}
+
+// recording is every group of a file, by "kind name"
+type recording map[string]*group
+
+func (r recording) add(name string, attrs []otlpAttribute) {
+	g := r[name]
+	if g == nil {
+		g = &group{keys: map[string]*key{}}
+		r[name] = g
+	}
+	g.spans++
+
+	for _, a := range attrs {
+		k := g.keys[a.Key]
+		if k == nil {
+			k = &key{types: map[string]bool{}, values: map[string]bool{}}
+			g.keys[a.Key] = k
+		}
+		k.seen++
+		for field, raw := range a.Value {
+			if t, ok := valueTypes[field]; ok {
+				k.types[t] = true
+				// a few hundred values are plenty to recognize a rename
+				if len(k.values) < 256 {
+					k.values[string(raw)] = true
+				}
+			}
+		}
+	}
+}
+
+func load(path string) (recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rec := recording{}
+	dec := json.NewDecoder(f)
+	for {
+		var req otlpRequest
+		err := dec.Decode(&req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, rs := range req.ResourceSpans {
+			rec.add(resourceGroup, rs.Resource.Attributes)
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					kind := spanKinds[strings.TrimSpace(string(span.Kind))]
+					if kind == "" {
+						kind = "unspecified"
+					}
+					rec.add(kind+" "+span.Name, span.Attributes)
+				}
+			}
+		}
+	}
+
+	return rec, nil
+}
+
+// Difference is one change between the two recordings
+type Difference struct {
+	Group  string `json:"group"`
+	Change string `json:"change"`
+	Key    string `json:"key,omitempty"`
+	To     string `json:"to,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (d Difference) String() string {
+	switch d.Change {
+	case "renamed":
+		return fmt.Sprintf("%s: %s renamed to %s (%s)", d.Group, d.Key, d.To, d.Detail)
+	case "type changed":
+		return fmt.Sprintf("%s: %s changed type %s", d.Group, d.Key, d.Detail)
+	case "span added", "span removed":
+		return fmt.Sprintf("%s: %s", d.Group, d.Change)
+	default:
+		return fmt.Sprintf("%s: %s %s (%s)", d.Group, d.Key, d.Change, d.Detail)
+	}
+}
+
+// renameOverlap is the share of values a removed and an added key must have
+// in common to be reported as a rename
+const renameOverlap = 0.5
+
+func diff(before, after recording) []Difference {
+	var diffs []Difference
+
+	for _, name := range sortedGroups(before, after) {
+		old, cur := before[name], after[name]
+		switch {
+		case cur == nil:
+			diffs = append(diffs, Difference{Group: name, Change: "span removed"})
+			continue
+		case old == nil:
+			diffs = append(diffs, Difference{Group: name, Change: "span added"})
+			continue
+		}
+
+		var removed, added []string
+		for k := range old.keys {
+			if _, ok := cur.keys[k]; !ok {
+				removed = append(removed, k)
+			}
+		}
+		for k := range cur.keys {
+			if _, ok := old.keys[k]; !ok {
+				added = append(added, k)
+			}
+		}
+		sort.Strings(removed)
+		sort.Strings(added)
+
+		// pair each removed key with the added key sharing most of its
+		// values, renamed holds both sides of the pairs
+		renamed := map[string]bool{}
+		for _, from := range removed {
+			best, bestOverlap := "", 0.0
+			for _, to := range added {
+				if renamed[to] {
+					continue
+				}
+				if o := overlap(old.keys[from].values, cur.keys[to].values); o > bestOverlap {
+					best, bestOverlap = to, o
+				}
+			}
+			if bestOverlap >= renameOverlap {
+				renamed[from], renamed[best] = true, true
+				diffs = append(diffs, Difference{Group: name, Change: "renamed", Key: from, To: best,
+					Detail: fmt.Sprintf("%.0f%% of the values in common", bestOverlap*100)})
+			}
+		}
+		for _, k := range removed {
+			if !renamed[k] {
+				diffs = append(diffs, Difference{Group: name, Change: "removed", Key: k, Detail: coverage(old.keys[k], old.spans)})
+			}
+		}
+		for _, k := range added {
+			if !renamed[k] {
+				diffs = append(diffs, Difference{Group: name, Change: "added", Key: k, Detail: coverage(cur.keys[k], cur.spans)})
+			}
+		}
+
+		for _, k := range sortedKeys(old.keys) {
+			if n, ok := cur.keys[k]; ok && types(old.keys[k]) != types(n) {
+				diffs = append(diffs, Difference{Group: name, Change: "type changed", Key: k, Detail: types(old.keys[k]) + " -> " + types(n)})
+			}
+		}
+	}
+
+	return diffs
+}
+
+// overlap is the Jaccard index of two value sets
+func overlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for v := range a {
+		if b[v] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+func coverage(k *key, spans int) string {
+	return fmt.Sprintf("%s, on %d of %d spans", types(k), k.seen, spans)
+}
+
+func types(k *key) string {
+	ts := make([]string, 0, len(k.types))
+	for t := range k.types {
+		ts = append(ts, t)
+	}
+	sort.Strings(ts)
+
+	return strings.Join(ts, "|")
+}
+
+func sortedGroups(recs ...recording) []string {
+	seen := map[string]bool{}
+	for _, r := range recs {
+		for name := range r {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sortedKeys(keys map[string]*key) []string {
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the differences as JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: tracediff [-json] old.json new.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	before, err := load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracediff:", err)
+		os.Exit(2)
+	}
+	after, err := load(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tracediff:", err)
+		os.Exit(2)
+	}
+
+	diffs := diff(before, after)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if diffs == nil {
+			diffs = []Difference{}
+		}
+		enc.Encode(diffs)
+	} else {
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,160 @@
+// Command userctl seeds and queries users through the api. Each invocation is
+// traced as a root span exported with the usual OTEL_* settings, so the calls
+// it makes show up under it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/client"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var scope = tel.NewScope("github.com/neha-gupta1/otel-semantics/cmd/userctl")
+
+func main() {
+	ctx := context.Background()
+
+	telemetry, err := tel.Init(ctx, tel.WithServiceName("userctl"), tel.WithTraces())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = newRootCmd().ExecuteContext(ctx)
+
+	// Exiting would skip a deferred Shutdown and lose the spans
+	telemetry.Shutdown(ctx)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	var baseURL, token string
+
+	root := &cobra.Command{
+		Use:          "userctl",
+		Short:        "Seed and query the users of the api",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().StringVar(&baseURL, "url", envOr("USERCTL_URL", "http://localhost:8080"), "base URL of the api")
+	root.PersistentFlags().StringVar(&token, "token", envOr("USERCTL_TOKEN", "userctl"), "bearer token sent to the api")
+
+	api := func() *client.Client {
+		return client.New(baseURL, token)
+	}
+
+	var count int
+	seed := &cobra.Command{
+		Use:   "seed",
+		Short: "Create test users",
+		Args:  cobra.NoArgs,
+		RunE: traced(func(ctx context.Context, cmd *cobra.Command, _ []string) error {
+			for i := 1; i <= count; i++ {
+				user, err := api().Create(ctx, client.User{
+					ID:      fmt.Sprintf("user_%d", i),
+					Name:    fmt.Sprintf("User %d", i),
+					PhoneNo: 1000000000 + i,
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "created", user.ID)
+			}
+			return nil
+		}),
+	}
+	seed.Flags().IntVarP(&count, "count", "n", 10, "number of users to create")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the users",
+		Args:  cobra.NoArgs,
+		RunE: traced(func(ctx context.Context, cmd *cobra.Command, _ []string) error {
+			users, err := api().List(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tPHONE")
+			for _, u := range users {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", u.ID, u.Name, u.PhoneNo)
+			}
+			return w.Flush()
+		}),
+	}
+
+	get := &cobra.Command{
+		Use:   "get <object id>",
+		Short: "Show a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: traced(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			user, err := api().Get(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(user)
+		}),
+	}
+
+	del := &cobra.Command{
+		Use:   "delete <object id>",
+		Short: "Delete a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: traced(func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			if err := api().Delete(ctx, args[0]); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "deleted", args[0])
+			return nil
+		}),
+	}
+
+	root.AddCommand(seed, list, get, del)
+
+	return root
+}
+
+// traced runs fn in the root span of the invocation, "userctl <command>"
+func traced(fn func(ctx context.Context, cmd *cobra.Command, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx, span := scope.StartInternalSpan(cmd.Context(), cmd.CommandPath(),
+			trace.WithAttributes(
+				attribute.String("process.executable.name", "userctl"),
+				attribute.String("cli.command", cmd.Name()),
+				attribute.StringSlice("cli.args", args),
+			),
+		)
+		defer span.End()
+
+		err := fn(ctx, cmd, args)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return err
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
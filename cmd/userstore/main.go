@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/lifecycle"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/server"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// Refuse to start on a bad config rather than falling back to defaults.
+	// The resource carries the schema version this build migrates the data to.
+	serverCfg := server.ConfigFromEnv("USERSTORE", ":8081")
+	sloCfg, sloErr := middleware.SLOConfigFromEnv()
+	telemetry, err := tel.Init(ctx,
+		tel.WithServiceName("userstore"),
+		tel.WithResourceAttributes(userstore.ResourceAttributes()...),
+		tel.WithTraces(),
+		tel.WithMetrics(),
+		tel.WithLogs(), // used for access logs
+	)
+	if err = errors.Join(err, serverCfg.Validate(), sloErr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer telemetry.Shutdown(ctx)
+
+	// team, cost center... from OTEL_STATIC_ATTRIBUTES on every server span
+	middleware.AddEnricher(middleware.StaticAttributes(telemetry.StaticAttributes()...))
+
+	// kill -HUP rebuilds the span exporter, e.g. after the collector moved
+	telemetry.ReloadOn(ctx, syscall.SIGHUP)
+
+	// gin.Default would add its console logger, access logs go through OTel instead
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// Server spans and request metrics
+	router.Use(middleware.Server())
+	router.Use(middleware.ErrorIDs())
+	router.Use(logging.Middleware())
+	router.Use(middleware.Session(middleware.SessionConfigFromEnv()))
+	router.Use(middleware.Protocol())
+	router.Use(middleware.AccessLog(middleware.AccessLogConfigFromEnv()))
+	router.Use(middleware.SLO(sloCfg))
+
+	// Development diagnostics, off unless LEAK_DETECTION is set
+	router.Use(middleware.LeakDetection(middleware.LeakDetectionConfigFromEnv()))
+
+	// Per request allocations for capacity investigations, off unless
+	// EXPERIMENTAL_REQUEST_ALLOCS is set
+	router.Use(middleware.AllocAttribution(middleware.AllocAttributionConfigFromEnv()))
+
+	// Reject requests early when the service is overloaded
+	router.Use(middleware.LoadShed(middleware.LoadShedConfigFromEnv()))
+
+	// Inject faults for demos, off unless CHAOS_ENABLED is set
+	router.Use(middleware.Chaos(middleware.ChaosConfigFromEnv()))
+
+	// Hold back traffic until the dependencies are up. On SIGINT or SIGTERM
+	// the hooks run backwards: readiness goes first, the listener drains last.
+	userstore.Register(router)
+	userstore.RegisterDebug(router, telemetry)
+	srv := server.New(router, serverCfg)
+
+	lc := lifecycle.New()
+	lc.Append(lifecycle.Hook{Name: "http.shutdown", OnStop: srv.Shutdown})
+	lc.Append(userstore.Hooks(telemetry)...)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := lc.Start(ctx); err != nil {
+			logging.Default().Error("Startup aborted", "error", err)
+		}
+	}()
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			logging.Default().Error("Error serving", "error", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		stop()
+		lc.Stop(context.WithoutCancel(ctx))
+		// after http.shutdown, the drained requests may still use it
+		userstore.Disconnect(context.WithoutCancel(ctx))
+	}
+}
@@ -1,6 +1,6 @@
 #!/bin/bash
 
-url="http://localhost:8080/user"
+url="http://localhost:8080/api/v1/user"
 
 for i in {1..100}
 do
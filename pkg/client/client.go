@@ -0,0 +1,142 @@
+// Package client calls the users API over HTTP, with a client span per request
+// and the trace context propagated to the server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+)
+
+// User is a user as served by /api/v1
+type User struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	PhoneNo int    `json:"phone_no"`
+}
+
+// Error is a non 2xx answer of the API
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Client is a users API client
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New returns a client of the API at baseURL (e.g. "http://localhost:8080"),
+// authenticating with token
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Transport: tel.NewTransport(http.DefaultTransport)},
+	}
+}
+
+// List returns every user
+func (c *Client) List(ctx context.Context) ([]User, error) {
+	var body struct {
+		User []User `json:"user"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/user", nil, &body)
+
+	return body.User, err
+}
+
+// Get returns the user stored under the ObjectID id
+func (c *Client) Get(ctx context.Context, id string) (User, error) {
+	var body struct {
+		User User `json:"user"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/user/"+url.PathEscape(id), nil, &body)
+
+	return body.User, err
+}
+
+// Create stores user
+func (c *Client) Create(ctx context.Context, user User) (User, error) {
+	var body struct {
+		User User `json:"user"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/user", user, &body)
+
+	return body.User, err
+}
+
+// Delete removes the user stored under the ObjectID id
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/user/"+url.PathEscape(id), nil, nil)
+}
+
+// do sends in as JSON, if any, and decodes the answer into out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var reqBody io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// responseError reads the message of an error answer, either {"error": "..."}
+// or problem details
+func responseError(resp *http.Response) error {
+	var body struct {
+		Error  string `json:"error"`
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	msg := body.Error
+	if msg == "" {
+		msg = strings.TrimSuffix(body.Title+": "+body.Detail, ": ")
+	}
+
+	return &Error{Status: resp.StatusCode, Message: msg}
+}
@@ -0,0 +1,266 @@
+// Package conformance drives the userstore routes through their success,
+// client error and server error paths and checks the server spans follow the
+// HTTP semantic conventions: the required attributes are there and the status
+// is only set to Error for 5xx answers. Forks adding routes can call Run from
+// their own tests with extra cases.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/testenv"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanWait bounds how long to wait for the server span, which ends right
+// after the response has been written
+const spanWait = 2 * time.Second
+
+// conformancePassword is the password of the user created with one, looked
+// for in every span of the request
+const conformancePassword = "conformance-s3cret"
+
+// errUnavailable is returned by the repository of the server error cases
+var errUnavailable = errors.New("conformance: repository unavailable")
+
+// Case is a request and what the server span for it must look like
+type Case struct {
+	Name     string
+	Method   string
+	Path     string
+	Username string
+	Body     any
+
+	// Route is the expected http.route, Status the expected response status.
+	// An empty Route is for the requests no route matches: http.route must
+	// be missing and SpanName is "HTTP {method}".
+	Route  string
+	Status int
+
+	// Unavailable runs the request against a repository failing every call
+	Unavailable bool
+
+	// Secret is a value of Body, such as a password, that must not show in
+	// any span of the request
+	Secret string
+}
+
+// Cases returns a success, client error and server error case for the
+// userstore routes
+func Cases() []Case {
+	user := userstore.Users{ID: "conformance", Name: "Conformance", PhoneNo: 5550100}
+	unknown := primitive.NewObjectID().Hex()
+
+	return []Case{
+		{Name: "list users", Method: http.MethodGet, Path: "/api/v1/user", Username: "alice", Route: "/api/v1/user", Status: http.StatusOK},
+		{Name: "list users with bad fields", Method: http.MethodGet, Path: "/api/v1/user?fields=password", Username: "alice", Route: "/api/v1/user", Status: http.StatusBadRequest},
+		{Name: "list users unavailable", Method: http.MethodGet, Path: "/api/v1/user", Username: "alice", Route: "/api/v1/user", Status: http.StatusInternalServerError, Unavailable: true},
+
+		{Name: "get user with bad id", Method: http.MethodGet, Path: "/api/v1/user/not-an-id", Username: "alice", Route: "/api/v1/user/:id", Status: http.StatusBadRequest},
+		{Name: "get unknown user", Method: http.MethodGet, Path: "/api/v1/user/" + unknown, Username: "alice", Route: "/api/v1/user/:id", Status: http.StatusNotFound},
+		{Name: "get user without token", Method: http.MethodGet, Path: "/api/v1/user/" + unknown, Route: "/api/v1/user/:id", Status: http.StatusUnauthorized},
+		{Name: "get user unavailable", Method: http.MethodGet, Path: "/api/v1/user/" + unknown, Username: "alice", Route: "/api/v1/user/:id", Status: http.StatusInternalServerError, Unavailable: true},
+
+		{Name: "create user", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: user, Route: "/api/v1/user", Status: http.StatusOK},
+		{Name: "create invalid user", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: map[string]any{"name": "no id"}, Route: "/api/v1/user", Status: http.StatusBadRequest},
+		{Name: "create user with password", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: map[string]any{
+			"id": "conformance-password", "name": "Conformance", "phone_no": 5550101, "password": conformancePassword,
+		}, Route: "/api/v1/user", Status: http.StatusOK, Secret: conformancePassword},
+		{Name: "create user unavailable", Method: http.MethodPost, Path: "/api/v1/user", Username: "alice", Body: user, Route: "/api/v1/user", Status: http.StatusInternalServerError, Unavailable: true},
+
+		{Name: "login", Method: http.MethodPost, Path: "/auth/login", Body: map[string]any{
+			"username": "conformance-password", "password": conformancePassword,
+		}, Route: "/auth/login", Status: http.StatusOK, Secret: conformancePassword},
+		{Name: "login with wrong password", Method: http.MethodPost, Path: "/auth/login", Body: map[string]any{
+			"username": "conformance-password", "password": "not-" + conformancePassword,
+		}, Route: "/auth/login", Status: http.StatusUnauthorized},
+		{Name: "login unavailable", Method: http.MethodPost, Path: "/auth/login", Body: map[string]any{
+			"username": "conformance-password", "password": conformancePassword,
+		}, Route: "/auth/login", Status: http.StatusInternalServerError, Unavailable: true, Secret: conformancePassword},
+
+		{Name: "user stats", Method: http.MethodGet, Path: "/api/v1/stats/users", Username: "alice", Route: "/api/v1/stats/users", Status: http.StatusOK},
+		{Name: "user stats unavailable", Method: http.MethodGet, Path: "/api/v1/stats/users", Username: "alice", Route: "/api/v1/stats/users", Status: http.StatusInternalServerError, Unavailable: true},
+
+		{Name: "unmatched route", Method: http.MethodGet, Path: "/api/v1/nope", Username: "alice", Status: http.StatusNotFound},
+		{Name: "unmatched method", Method: http.MethodDelete, Path: "/api/v1/stats/users", Username: "alice", Status: http.StatusNotFound},
+		{Name: "path traversal", Method: http.MethodGet, Path: "/api/v1/../../etc/passwd", Status: http.StatusNotFound},
+		{Name: "encoded path traversal", Method: http.MethodGet, Path: "/api/v1/user/..%2f..%2fadmin%2fusers", Status: http.StatusNotFound},
+		{Name: "dot segment traversal", Method: http.MethodGet, Path: "/%2e%2e/%2e%2e/windows/win.ini", Status: http.StatusNotFound},
+	}
+}
+
+// Run sends every case to env and checks its server span
+func Run(t *testing.T, env *testenv.Env, cases []Case) {
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if tc.Unavailable {
+				userstore.UseRepository(UnavailableRepository(env.MongoURI))
+				t.Cleanup(func() { userstore.UseRepository(env.Repository) })
+			}
+			userstore.InvalidateCache()
+			env.Spans.Reset()
+
+			resp := env.Do(t, tc.Method, tc.Path, tc.Username, tc.Body)
+			if resp.StatusCode != tc.Status {
+				t.Fatalf("%s %s answered %d, want %d", tc.Method, tc.Path, resp.StatusCode, tc.Status)
+			}
+
+			CheckServerSpan(t, waitServerSpan(t, env), tc)
+			if tc.Secret != "" {
+				CheckNoSecret(t, env.EndedSpans(), tc.Secret)
+			}
+		})
+	}
+}
+
+// CheckServerSpan checks span is a conforming server span for tc
+func CheckServerSpan(tb testing.TB, span tracetest.SpanStub, tc Case) {
+	tb.Helper()
+
+	if span.SpanKind != trace.SpanKindServer {
+		tb.Errorf("span %q has kind %s, want server", span.Name, span.SpanKind)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	// Forks still on otelgin get the pre 1.21 names, accept both
+	method := requireAttribute(tb, attrs, "http.request.method", "http.method")
+	if method.AsString() != tc.Method {
+		tb.Errorf("method is %q, want %q", method.AsString(), tc.Method)
+	}
+
+	status := requireAttribute(tb, attrs, "http.response.status_code", "http.status_code")
+	if int(status.AsInt64()) != tc.Status {
+		tb.Errorf("status code attribute is %d, want %d", status.AsInt64(), tc.Status)
+	}
+
+	if tc.Route == "" {
+		// the span name and route must not grow with the URLs of unmatched requests
+		if route, ok := attrs["http.route"]; ok {
+			tb.Errorf("http.route is %q for an unmatched request, want none", route.AsString())
+		}
+		if want := "HTTP " + tc.Method; span.Name != want {
+			tb.Errorf("span name is %q for an unmatched request, want %q", span.Name, want)
+		}
+		requireAttribute(tb, attrs, "url.path")
+	} else {
+		route := requireAttribute(tb, attrs, "http.route")
+		if route.AsString() != tc.Route {
+			tb.Errorf("http.route is %q, want %q", route.AsString(), tc.Route)
+		}
+	}
+
+	requireAttribute(tb, attrs, "url.scheme", "http.scheme")
+
+	// Servers only set the status for 5xx, a 4xx is the client's fault
+	if tc.Status >= http.StatusInternalServerError {
+		if span.Status.Code != codes.Error {
+			tb.Errorf("span status is %s for a %d, want Error", span.Status.Code, tc.Status)
+		}
+	} else if span.Status.Code != codes.Unset {
+		tb.Errorf("span status is %s for a %d, want Unset", span.Status.Code, tc.Status)
+	}
+}
+
+// CheckNoSecret fails when secret shows in the name, attributes or events of
+// any of spans, db.query.text included
+func CheckNoSecret(tb testing.TB, spans tracetest.SpanStubs, secret string) {
+	tb.Helper()
+
+	for _, span := range spans {
+		if strings.Contains(span.Name, secret) {
+			tb.Errorf("span %q has the secret in its name", span.Name)
+		}
+		for _, kv := range span.Attributes {
+			if strings.Contains(kv.Value.Emit(), secret) {
+				tb.Errorf("span %q has the secret in %s", span.Name, kv.Key)
+			}
+		}
+		for _, event := range span.Events {
+			for _, kv := range event.Attributes {
+				if strings.Contains(kv.Value.Emit(), secret) {
+					tb.Errorf("event %q of span %q has the secret in %s", event.Name, span.Name, kv.Key)
+				}
+			}
+		}
+	}
+}
+
+// requireAttribute returns the first of keys set on the span, failing when none is
+func requireAttribute(tb testing.TB, attrs map[attribute.Key]attribute.Value, keys ...attribute.Key) attribute.Value {
+	tb.Helper()
+
+	for _, key := range keys {
+		if value, ok := attrs[key]; ok {
+			return value
+		}
+	}
+
+	tb.Errorf("missing required attribute %s", keys[0])
+	return attribute.Value{}
+}
+
+// waitServerSpan returns the server span of the last request
+func waitServerSpan(tb testing.TB, env *testenv.Env) tracetest.SpanStub {
+	tb.Helper()
+
+	deadline := time.Now().Add(spanWait)
+	for time.Now().Before(deadline) {
+		for _, span := range env.EndedSpans() {
+			if span.SpanKind == trace.SpanKindServer {
+				return span
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tb.Fatalf("no server span ended within %s", spanWait)
+	return tracetest.SpanStub{}
+}
+
+// UnavailableRepository is an instrumented repository on the database at uri
+// whose reads and writes fail, to drive the handlers into their 5xx paths
+func UnavailableRepository(uri string) userstore.UserRepository {
+	return userstore.NewInstrumentedRepository(unavailableRepository{userstore.NewMongoRepository(uri)})
+}
+
+type unavailableRepository struct {
+	userstore.UserRepository
+}
+
+func (unavailableRepository) FindAll(context.Context, []string) ([]userstore.Users, error) {
+	return nil, errUnavailable
+}
+
+func (unavailableRepository) Each(context.Context, userstore.Scan, func(userstore.Users) error) (int64, error) {
+	return 0, errUnavailable
+}
+
+func (unavailableRepository) FindByID(context.Context, primitive.ObjectID) (userstore.Users, error) {
+	return userstore.Users{}, errUnavailable
+}
+
+func (unavailableRepository) FindCredentials(context.Context, string) (userstore.Users, error) {
+	return userstore.Users{}, errUnavailable
+}
+
+func (unavailableRepository) Insert(context.Context, userstore.Users) (userstore.Users, error) {
+	return userstore.Users{}, errUnavailable
+}
+
+func (unavailableRepository) Stats(context.Context) (userstore.UserStats, error) {
+	return userstore.UserStats{}, errUnavailable
+}
@@ -0,0 +1,85 @@
+package conformance_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/conformance"
+	"github.com/neha-gupta1/otel-semantics/pkg/testenv"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestUserstore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts MongoDB in docker")
+	}
+
+	conformance.Run(t, testenv.New(t), conformance.Cases())
+}
+
+// recordingTB counts the failures reported through it
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCheckNoSecret(t *testing.T) {
+	const secret = "hunter2"
+
+	for _, tc := range []struct {
+		name   string
+		span   tracetest.SpanStub
+		errors int
+	}{
+		{name: "clean", span: tracetest.SpanStub{Name: "POST /auth/login", Attributes: []attribute.KeyValue{
+			attribute.String("user.name", "alice"),
+		}}},
+		{name: "in the name", span: tracetest.SpanStub{Name: "login " + secret}, errors: 1},
+		{name: "in an attribute", span: tracetest.SpanStub{Name: "find", Attributes: []attribute.KeyValue{
+			attribute.String("db.query.text", `{"password": "`+secret+`"}`),
+		}}, errors: 1},
+		{name: "in a slice attribute", span: tracetest.SpanStub{Name: "find", Attributes: []attribute.KeyValue{
+			attribute.StringSlice("args", []string{"alice", secret}),
+		}}, errors: 1},
+		{name: "in an event", span: tracetest.SpanStub{Name: "login", Events: []sdktrace.Event{
+			{Name: "Validation Error", Attributes: []attribute.KeyValue{attribute.String("error.message", "bad password "+secret)}},
+		}}, errors: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tb := &recordingTB{TB: t}
+			conformance.CheckNoSecret(tb, tracetest.SpanStubs{tc.span}, secret)
+			if len(tb.errors) != tc.errors {
+				t.Errorf("CheckNoSecret reported %q, want %d failures", tb.errors, tc.errors)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSpans(t *testing.T) {
+	const secret = "conformance-s3cret"
+
+	spans := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	defer provider.Shutdown(context.Background())
+
+	ctx, parent := provider.Tracer("conformance").Start(context.Background(), "POST /api/v1/user")
+	if _, err := userstore.HashPassword(ctx, secret); err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	parent.End()
+
+	if len(spans.GetSpans()) < 2 {
+		t.Fatalf("got spans %v, want HashPassword under the request", spans.GetSpans().Snapshots())
+	}
+	conformance.CheckNoSecret(t, spans.GetSpans(), secret)
+}
@@ -0,0 +1,127 @@
+// Package conventions decides which semantic convention attributes are
+// recorded. Each attribute is added with its requirement level from the spec
+// and the profile keeps the levels it wants, so deployments can trade detail
+// for cardinality without touching the instrumentation:
+//
+//   - minimal: required and conditionally required attributes only
+//   - recommended (default): the recommended attributes as well
+//   - full: the opt-in attributes too
+//
+// The profile comes from OTEL_SEMCONV_ATTRIBUTE_PROFILE or SetProfile.
+package conventions
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Requirement is the requirement level of an attribute in the semantic conventions
+type Requirement int
+
+const (
+	// Required covers the conditionally required attributes as well
+	Required Requirement = iota
+	Recommended
+	OptIn
+)
+
+// Profile names how many of the optional attributes are recorded
+type Profile string
+
+const (
+	ProfileMinimal     Profile = "minimal"
+	ProfileRecommended Profile = "recommended"
+	ProfileFull        Profile = "full"
+)
+
+// ParseProfile returns the profile called name, "" being the default
+func ParseProfile(name string) (Profile, error) {
+	switch Profile(name) {
+	case "":
+		return ProfileRecommended, nil
+	case ProfileMinimal, ProfileRecommended, ProfileFull:
+		return Profile(name), nil
+	default:
+		return "", fmt.Errorf("unknown attribute profile %q", name)
+	}
+}
+
+// maxLevel is the highest requirement level recorded by the current profile
+var maxLevel atomic.Int32
+
+func init() {
+	p, err := ParseProfile(os.Getenv("OTEL_SEMCONV_ATTRIBUTE_PROFILE"))
+	if err != nil {
+		p = ProfileRecommended
+	}
+	SetProfile(p)
+}
+
+// SetProfile changes the profile, for the attributes added from then on
+func SetProfile(p Profile) {
+	switch p {
+	case ProfileMinimal:
+		maxLevel.Store(int32(Required))
+	case ProfileFull:
+		maxLevel.Store(int32(OptIn))
+	default:
+		maxLevel.Store(int32(Recommended))
+	}
+}
+
+// Records reports whether attributes of level are recorded
+func Records(level Requirement) bool {
+	return level <= Requirement(maxLevel.Load())
+}
+
+// Add appends kvs to attrs if the profile records attributes of level
+func Add(attrs []attribute.KeyValue, level Requirement, kvs ...attribute.KeyValue) []attribute.KeyValue {
+	if !Records(level) {
+		return attrs
+	}
+
+	return append(attrs, kvs...)
+}
+
+// Filter drops from attrs the ones levels lists at a level the profile doesn't
+// record, for attributes built away from where they're added to the span
+func Filter(attrs []attribute.KeyValue, levels map[attribute.Key]Requirement) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if level, ok := levels[kv.Key]; ok && !Records(level) {
+			continue
+		}
+		out = append(out, kv)
+	}
+
+	return out
+}
+
+// attributesPool holds the slices handed out by AcquireAttributes, sized for
+// the attributes of an HTTP server span
+var attributesPool = sync.Pool{
+	New: func() any {
+		attrs := make([]attribute.KeyValue, 0, 24)
+		return &attrs
+	},
+}
+
+// AcquireAttributes returns an empty slice to build attributes in, to give
+// back with ReleaseAttributes once they've been handed to the SDK, which copies
+// them
+func AcquireAttributes() *[]attribute.KeyValue {
+	return attributesPool.Get().(*[]attribute.KeyValue)
+}
+
+// ReleaseAttributes puts attrs back in the pool. The slice may have grown
+// since AcquireAttributes, the larger one is kept.
+func ReleaseAttributes(attrs *[]attribute.KeyValue) {
+	// don't keep the values alive until the slice is reused
+	clear(*attrs)
+	*attrs = (*attrs)[:0]
+	attributesPool.Put(attrs)
+}
@@ -0,0 +1,246 @@
+// Package cron runs the periodic jobs of a service. Each run is a trace of its
+// own, and the runs are measured like requests.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Job is a function run on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+
+	// Timeout cancels a run taking longer, 0 lets it run until the next one
+	// is due
+	Timeout time.Duration
+}
+
+var scope = tel.NewScope("app/cron")
+
+var (
+	meter = otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/cron")
+
+	jobDuration, _ = meter.Float64Histogram("cron.job.duration",
+		metric.WithDescription("Duration of the job runs, by job and outcome"),
+		metric.WithUnit("s"),
+	)
+	jobSkipped, _ = meter.Int64Counter("cron.job.skipped",
+		metric.WithDescription("Number of runs skipped because the previous one was still running"),
+		metric.WithUnit("{run}"),
+	)
+	jobActive, _ = meter.Int64UpDownCounter("cron.job.active",
+		metric.WithDescription("Number of runs in progress, by job: the busy workers of the scheduler"),
+		metric.WithUnit("{run}"),
+	)
+	jobWaitTime, _ = meter.Float64Histogram("cron.job.wait_time",
+		metric.WithDescription("Time between when a run was due and when it started"),
+		metric.WithUnit("s"),
+	)
+)
+
+// Scheduler runs jobs until it's stopped. A run that comes due while the
+// previous one of the same job is still going is skipped, not queued.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []*entry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+type entry struct {
+	job      Job
+	function string
+	busy     atomic.Bool
+}
+
+// New returns an empty scheduler
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add schedules job, before or after Start
+func (s *Scheduler) Add(job Job) {
+	e := &entry{job: job, function: functionName(job.Run)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, e)
+	if s.cancel != nil {
+		s.loop(e)
+	}
+}
+
+// Start runs every job on its schedule. It returns at once, ctx only carries
+// the values the runs inherit, not their cancellation.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return errors.New("cron: already started")
+	}
+
+	ctx, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	s.ctx = ctx
+	for _, e := range s.jobs {
+		s.loop(e)
+	}
+
+	return nil
+}
+
+// Stop cancels the runs in progress and waits for them to return, or for ctx
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop waits for the next runs of e, it's called with s.mu held
+func (s *Scheduler) loop(e *entry) {
+	ctx := s.ctx
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+
+		next := e.job.Schedule.Next(time.Now())
+		for {
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if e.busy.CompareAndSwap(false, true) {
+				s.running.Add(1)
+				go func(scheduled time.Time) {
+					defer s.running.Done()
+					defer e.busy.Store(false)
+					s.run(ctx, e, scheduled)
+				}(next)
+			} else {
+				jobSkipped.Add(ctx, 1, metric.WithAttributes(attribute.String("cron.job.name", e.job.Name)))
+				logging.FromContext(ctx).Warn("Skipping job run, the previous one is still running", "job", e.job.Name)
+			}
+
+			next = e.job.Schedule.Next(time.Now())
+		}
+	}()
+}
+
+// run runs the job once under a new root span
+func (s *Scheduler) run(ctx context.Context, e *entry, scheduled time.Time) {
+	name := metric.WithAttributes(attribute.String("cron.job.name", e.job.Name))
+	lag := time.Since(scheduled)
+	jobWaitTime.Record(ctx, lag.Seconds(), name)
+	jobActive.Add(ctx, 1, name)
+	defer jobActive.Add(context.WithoutCancel(ctx), -1, name)
+
+	ctx, span := scope.StartInternalSpan(ctx, "cron "+e.job.Name,
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("cron.job.name", e.job.Name),
+			attribute.String("cron.schedule", e.job.Schedule.String()),
+			attribute.String("cron.scheduled_time", scheduled.UTC().Format(time.RFC3339)),
+			attribute.Float64("cron.job.lag", lag.Seconds()),
+			attribute.String("code.function.name", e.function),
+		),
+	)
+	defer span.End()
+
+	if e.job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.job.Timeout)
+		defer cancel()
+	}
+
+	ctx = context.WithValue(ctx, batchKey{}, new(atomic.Int64))
+	start := time.Now()
+	err := runRecovering(ctx, e.job.Run)
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		if errors.Is(err, context.DeadlineExceeded) {
+			outcome = "timeout"
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logging.FromContext(ctx).Error("Job failed", "job", e.job.Name, "error", err)
+	}
+	span.SetAttributes(attribute.String("cron.job.outcome", outcome))
+
+	jobDuration.Record(context.WithoutCancel(ctx), time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("cron.job.name", e.job.Name),
+		attribute.String("cron.job.outcome", outcome),
+	))
+}
+
+// RecordBatch records on the run of ctx that it processed a batch of n items,
+// as cron.job.batch.item_count like messaging.batch.message_count on the
+// spans of consumers. Several batches add up.
+func RecordBatch(ctx context.Context, n int64) {
+	if b, ok := ctx.Value(batchKey{}).(*atomic.Int64); ok {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("cron.job.batch.item_count", b.Add(n)))
+	}
+}
+
+// batchKey holds the items RecordBatch counted for a run
+type batchKey struct{}
+
+// runRecovering turns a panicking job into a failed run, the scheduler keeps going
+func runRecovering(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// functionName is the full name of fn, e.g. "github.com/x/pkg/users.purge"
+func functionName(fn any) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+
+	return ""
+}
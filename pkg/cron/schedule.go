@@ -0,0 +1,72 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next
+type Schedule interface {
+	// Next is the first run strictly after t
+	Next(t time.Time) time.Time
+	// String is recorded as cron.schedule
+	String() string
+}
+
+// Every runs a job every d, counted from the start of the scheduler
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+func (e every) String() string             { return "@every " + time.Duration(e).String() }
+
+// Daily runs a job every day at hour:minute, in UTC
+func Daily(hour, minute int) Schedule {
+	return daily{hour: hour, minute: minute}
+}
+
+type daily struct {
+	hour, minute int
+}
+
+func (d daily) Next(t time.Time) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), d.hour, d.minute, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+func (d daily) String() string { return fmt.Sprintf("@daily %02d:%02d", d.hour, d.minute) }
+
+// ParseSchedule reads "@every <duration>", "@hourly", "@daily" (midnight UTC)
+// or "@daily HH:MM"
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "@hourly":
+		return Every(time.Hour), nil
+	case s == "@daily":
+		return Daily(0, 0), nil
+	case strings.HasPrefix(s, "@every "):
+		d, err := time.ParseDuration(strings.TrimPrefix(s, "@every "))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval in %q", s)
+		}
+		return Every(d), nil
+	case strings.HasPrefix(s, "@daily "):
+		at, err := time.Parse("15:04", strings.TrimPrefix(s, "@daily "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of day in %q, use HH:MM", s)
+		}
+		return Daily(at.Hour(), at.Minute()), nil
+	default:
+		return nil, fmt.Errorf("unknown schedule %q, use @every <duration>, @hourly, @daily or @daily HH:MM", s)
+	}
+}
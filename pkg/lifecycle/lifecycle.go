@@ -0,0 +1,229 @@
+// Package lifecycle runs the startup and shutdown hooks of a service in order,
+// each under its own span of a service.start or service.stop trace, so a slow
+// or stuck start shows which dependency it waited on.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hook is a startup step and the matching shutdown step, either can be nil
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+
+	// Timeout bounds OnStart and OnStop each, the Manager's timeouts apply
+	// when it isn't set
+	Timeout time.Duration
+
+	// RetryInterval retries a failing OnStart until it passes or times out,
+	// for dependencies that may come up after the service
+	RetryInterval time.Duration
+}
+
+// Manager runs the hooks: OnStart in the order they were added, OnStop in
+// the reverse order and only for the hooks that started
+type Manager struct {
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+
+	// running is held by Start and Stop, a Stop waits for the Start it interrupts
+	running sync.Mutex
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+// New returns a Manager with the timeouts of LIFECYCLE_START_TIMEOUT (default
+// 2m) and LIFECYCLE_STOP_TIMEOUT (default 30s)
+func New() *Manager {
+	return &Manager{
+		StartTimeout: durationFromEnv("LIFECYCLE_START_TIMEOUT", 2*time.Minute),
+		StopTimeout:  durationFromEnv("LIFECYCLE_STOP_TIMEOUT", 30*time.Second),
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+
+	return d
+}
+
+// Append adds hooks after the ones already there
+func (m *Manager) Append(hooks ...Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, hooks...)
+}
+
+// Start runs the OnStart hooks in order under a service.start trace, stopping
+// at the first one failing. The hooks started before it are left running,
+// Stop shuts them down.
+func (m *Manager) Start(ctx context.Context) error {
+	m.running.Lock()
+	defer m.running.Unlock()
+
+	m.mu.Lock()
+	hooks := m.hooks[m.started:]
+	m.mu.Unlock()
+
+	start := time.Now()
+	err := tel.Time(ctx, "service.start", func(ctx context.Context) error {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Int("service.lifecycle.hooks", len(hooks)))
+
+		for _, hook := range hooks {
+			if hook.OnStart != nil {
+				if err := m.runStart(ctx, hook); err != nil {
+					return fmt.Errorf("%s: %w", hook.Name, err)
+				}
+			}
+
+			m.mu.Lock()
+			m.started++
+			m.mu.Unlock()
+		}
+
+		span.SetAttributes(attribute.Float64("service.start.duration", time.Since(start).Seconds()))
+		return nil
+	}, trace.WithNewRoot())
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Service started", "duration", time.Since(start))
+	return nil
+}
+
+func (m *Manager) runStart(ctx context.Context, hook Hook) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = m.StartTimeout
+	}
+
+	return tel.Time(ctx, "service.start."+hook.Name, func(ctx context.Context) error {
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			attribute.String("service.lifecycle.hook", hook.Name),
+			attribute.Float64("service.lifecycle.timeout", timeout.Seconds()),
+		)
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			err := call(ctx, hook.OnStart)
+			if err == nil {
+				span.SetAttributes(
+					attribute.Int("service.lifecycle.attempts", attempt),
+					attribute.Float64("service.lifecycle.duration", time.Since(start).Seconds()),
+				)
+				return nil
+			}
+
+			span.AddEvent("Hook failed", trace.WithAttributes(
+				attribute.Int("service.lifecycle.attempt", attempt),
+				attribute.String("error.message", err.Error()),
+			))
+			if hook.RetryInterval == 0 {
+				return timeoutError(ctx, timeout, err)
+			}
+			logging.FromContext(ctx).Warn("Startup hook failed", "hook", hook.Name, "attempt", attempt, "error", err)
+
+			select {
+			case <-ctx.Done():
+				return timeoutError(ctx, timeout, err)
+			case <-time.After(hook.RetryInterval):
+			}
+		}
+	})
+}
+
+// Stop runs the OnStop hooks of the started hooks in reverse order under a
+// service.stop trace. Every hook runs even if one fails, the errors are joined.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.running.Lock()
+	defer m.running.Unlock()
+
+	m.mu.Lock()
+	hooks := m.hooks[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	start := time.Now()
+	err := tel.Time(ctx, "service.stop", func(ctx context.Context) error {
+		var errs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if hooks[i].OnStop == nil {
+				continue
+			}
+			if err := m.runStop(ctx, hooks[i]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", hooks[i].Name, err))
+			}
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("service.stop.duration", time.Since(start).Seconds()))
+		return errors.Join(errs...)
+	}, trace.WithNewRoot())
+
+	logging.FromContext(ctx).Info("Service stopped", "duration", time.Since(start), "error", err)
+	return err
+}
+
+func (m *Manager) runStop(ctx context.Context, hook Hook) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = m.StopTimeout
+	}
+
+	return tel.Time(ctx, "service.stop."+hook.Name, func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("service.lifecycle.hook", hook.Name),
+			attribute.Float64("service.lifecycle.timeout", timeout.Seconds()),
+		)
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return timeoutError(ctx, timeout, call(ctx, hook.OnStop))
+	})
+}
+
+// call returns when fn does or when ctx is done, a hook ignoring its context
+// can't hold the service up past its timeout
+func call(ctx context.Context, fn func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeoutError says the hook ran out of time rather than reporting its last error alone
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+// Package logging gives every log line the context it was written in: the
+// trace and span IDs, the route and the tenant of the request, so logs can be
+// joined with the traces.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tenantBaggageKey is the baggage member naming the tenant of a request
+const tenantBaggageKey = "tenant"
+
+// base is the logger every FromContext logger derives from. LOG_FORMAT=json
+// switches it to JSON lines and LOG_LEVEL (debug, info, warn, error) sets the
+// minimum level, info by default.
+var base = newLogger(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+
+func newLogger(format, level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// Default returns the logger for code running outside of any request
+func Default() *slog.Logger {
+	return base
+}
+
+type routeKey struct{}
+
+// WithRoute returns ctx carrying the route logged by FromContext
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+type sessionKey struct{}
+
+// WithSession returns ctx carrying the session.id logged by FromContext
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// Session returns the session.id of ctx, "" when it has none
+func Session(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+// FromContext returns a logger with the trace_id, span_id, route, tenant and
+// session.id of ctx, leaving out the ones ctx doesn't have
+func FromContext(ctx context.Context) *slog.Logger {
+	var attrs []any
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+
+	if route, ok := ctx.Value(routeKey{}).(string); ok && route != "" {
+		attrs = append(attrs, "route", route)
+	}
+
+	if id := Session(ctx); id != "" {
+		attrs = append(attrs, "session.id", id)
+	}
+
+	if tenant := baggage.FromContext(ctx).Member(tenantBaggageKey).Value(); tenant != "" {
+		attrs = append(attrs, "tenant", tenant)
+	}
+
+	if len(attrs) == 0 {
+		return base
+	}
+
+	return base.With(attrs...)
+}
+
+// Middleware puts the matched route in the request context for FromContext
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccessLogConfig controls which requests get an access log record
+type AccessLogConfig struct {
+	// SuccessSampleRatio is the fraction of 2xx responses that are logged.
+	// Every other response is always logged.
+	SuccessSampleRatio float64
+}
+
+// AccessLogConfigFromEnv reads ACCESS_LOG_2XX_SAMPLE_RATIO, defaulting to logging
+// one in ten successful requests
+func AccessLogConfigFromEnv() AccessLogConfig {
+	cfg := AccessLogConfig{SuccessSampleRatio: 0.1}
+
+	if v, err := strconv.ParseFloat(os.Getenv("ACCESS_LOG_2XX_SAMPLE_RATIO"), 64); err == nil && v >= 0 && v <= 1 {
+		cfg.SuccessSampleRatio = v
+	}
+
+	return cfg
+}
+
+// AccessLog emits one log record per request through the OTel logs pipeline, in
+// place of gin's console logger. It must run after the tracing middleware so the
+// records carry the trace and span IDs of the request.
+func AccessLog(cfg AccessLogConfig) gin.HandlerFunc {
+	logger := global.GetLoggerProvider().Logger("github.com/neha-gupta1/otel-semantics/pkg/middleware")
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		duration := time.Since(start)
+
+		status := c.Writer.Status()
+		if status >= 200 && status < 300 && rand.Float64() >= cfg.SuccessSampleRatio {
+			return
+		}
+
+		ctx := c.Request.Context()
+		route := c.FullPath()
+
+		var record log.Record
+		record.SetTimestamp(start)
+		record.SetSeverity(accessLogSeverity(status))
+		record.SetSeverityText(accessLogSeverity(status).String())
+		record.SetBody(log.StringValue(fmt.Sprintf("%s %s %d %s", c.Request.Method, c.Request.URL.Path, status, duration)))
+		record.AddAttributes(
+			log.String("http.request.method", c.Request.Method),
+			log.String("http.route", route),
+			log.String("url.path", c.Request.URL.Path),
+			log.Int("http.response.status_code", status),
+			log.Float64("http.server.request.duration", duration.Seconds()),
+			log.String("client.address", c.ClientIP()),
+			log.String("trace_id", trace.SpanContextFromContext(ctx).TraceID().String()),
+		)
+
+		if id := logging.Session(ctx); id != "" {
+			record.AddAttributes(log.String("session.id", id))
+		}
+
+		logger.Emit(ctx, record)
+	}
+}
+
+func accessLogSeverity(status int) log.Severity {
+	switch {
+	case status >= 500:
+		return log.SeverityError
+	case status >= 400:
+		return log.SeverityWarn
+	default:
+		return log.SeverityInfo
+	}
+}
@@ -0,0 +1,192 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware/chiadapter"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware/echoadapter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// answer is the status the test routes answer with, from the status query
+// parameter
+func answer(r *http.Request) int {
+	switch r.URL.Query().Get("status") {
+	case "404":
+		return http.StatusNotFound
+	case "500":
+		return http.StatusInternalServerError
+	default:
+		return http.StatusOK
+	}
+}
+
+// adapters serve GET /users/{id} on each framework, with its route syntax
+var adapters = []struct {
+	name    string
+	route   string
+	handler func() http.Handler
+}{
+	{name: "gin", route: "/users/:id", handler: func() http.Handler {
+		router := gin.New()
+		router.Use(middleware.Server())
+		router.GET("/users/:id", func(c *gin.Context) { c.Status(answer(c.Request)) })
+		return router
+	}},
+	{name: "chi", route: "/users/{id}", handler: func() http.Handler {
+		router := chi.NewRouter()
+		router.Use(chiadapter.Server())
+		router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(answer(r)) })
+		return router
+	}},
+	{name: "echo", route: "/users/:id", handler: func() http.Handler {
+		e := echo.New()
+		e.Use(echoadapter.Server())
+		e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(answer(c.Request())) })
+		return e
+	}},
+}
+
+func TestAdapters(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+		status int
+	}{
+		{name: "ok", target: "/users/42", status: http.StatusOK},
+		{name: "client error", target: "/users/42?status=404", status: http.StatusNotFound},
+		{name: "server error", target: "/users/42?status=500", status: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the attributes every adapter must report the same way
+			var first map[attribute.Key]attribute.Value
+			var firstAdapter string
+
+			for _, adapter := range adapters {
+				spans.Reset()
+				metrics.Collect(context.Background(), &metricdata.ResourceMetrics{})
+
+				req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+				req.Header.Set("User-Agent", "adapters-test")
+				resp := httptest.NewRecorder()
+				adapter.handler().ServeHTTP(resp, req)
+
+				if resp.Code != tc.status {
+					t.Fatalf("%s answered %d, want %d", adapter.name, resp.Code, tc.status)
+				}
+
+				ended := spans.GetSpans()
+				if len(ended) != 1 {
+					t.Fatalf("%s ended %d spans, want the server span", adapter.name, len(ended))
+				}
+				span := ended[0]
+
+				if want := "GET " + adapter.route; span.Name != want {
+					t.Errorf("%s span name is %q, want %q", adapter.name, span.Name, want)
+				}
+				if span.SpanKind != trace.SpanKindServer {
+					t.Errorf("%s span kind is %s, want server", adapter.name, span.SpanKind)
+				}
+				wantCode := codes.Unset
+				if tc.status >= http.StatusInternalServerError {
+					wantCode = codes.Error
+				}
+				if span.Status.Code != wantCode {
+					t.Errorf("%s span status is %s, want %s", adapter.name, span.Status.Code, wantCode)
+				}
+
+				attrs := map[attribute.Key]attribute.Value{}
+				for _, kv := range span.Attributes {
+					attrs[kv.Key] = kv.Value
+				}
+				if route := attrs["http.route"].AsString(); route != adapter.route {
+					t.Errorf("%s http.route is %q, want %q", adapter.name, route, adapter.route)
+				}
+				if status := attrs["http.response.status_code"].AsInt64(); status != int64(tc.status) {
+					t.Errorf("%s http.response.status_code is %d, want %d", adapter.name, status, tc.status)
+				}
+
+				// the route syntax is the framework's own, the rest must match
+				delete(attrs, "http.route")
+				if first == nil {
+					first, firstAdapter = attrs, adapter.name
+				} else {
+					compareAttributes(t, firstAdapter+" span", first, adapter.name+" span", attrs)
+				}
+
+				point := requestDuration(t, adapter.name)
+				if point.Count != 1 {
+					t.Errorf("%s recorded %d durations, want 1", adapter.name, point.Count)
+				}
+				if route, _ := point.Attributes.Value("http.route"); route.AsString() != adapter.route {
+					t.Errorf("%s duration http.route is %q, want %q", adapter.name, route.AsString(), adapter.route)
+				}
+				if status, _ := point.Attributes.Value("http.response.status_code"); status.AsInt64() != int64(tc.status) {
+					t.Errorf("%s duration status is %d, want %d", adapter.name, status.AsInt64(), tc.status)
+				}
+				errorType, hasErrorType := point.Attributes.Value("error.type")
+				if wantErrorType := tc.status >= http.StatusInternalServerError; hasErrorType != wantErrorType {
+					t.Errorf("%s duration error.type is %q, want one: %t", adapter.name, errorType.AsString(), wantErrorType)
+				}
+			}
+		})
+	}
+}
+
+// compareAttributes fails on the attributes of a and b that differ
+func compareAttributes(t *testing.T, aName string, a map[attribute.Key]attribute.Value, bName string, b map[attribute.Key]attribute.Value) {
+	t.Helper()
+
+	for key, value := range a {
+		if other, ok := b[key]; !ok {
+			t.Errorf("%s has %s, %s doesn't", aName, key, bName)
+		} else if other != value {
+			t.Errorf("%s has %s=%s, %s has %s", aName, key, value.Emit(), bName, other.Emit())
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			t.Errorf("%s has %s, %s doesn't", bName, key, aName)
+		}
+	}
+}
+
+// requestDuration returns the only http.server.request.duration point recorded
+// since the last collection
+func requestDuration(t *testing.T, adapter string) metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collecting the metrics: %v", err)
+	}
+
+	var points []metricdata.HistogramDataPoint[float64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "http.server.request.duration" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				if point.Count > 0 {
+					points = append(points, point)
+				}
+			}
+		}
+	}
+	if len(points) != 1 {
+		t.Fatalf("%s recorded %d http.server.request.duration points, want 1", adapter, len(points))
+	}
+
+	return points[0]
+}
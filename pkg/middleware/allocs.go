@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AllocAttributionConfig turns on the experimental per request allocation
+// attribution of AllocAttribution
+type AllocAttributionConfig struct {
+	Enabled bool
+	// SampleRatio is the share of requests measured, reading the runtime
+	// metrics twice per request isn't free
+	SampleRatio float64
+}
+
+// AllocAttributionConfigFromEnv reads EXPERIMENTAL_REQUEST_ALLOCS (off by
+// default) and EXPERIMENTAL_REQUEST_ALLOCS_RATIO (default 0.1)
+func AllocAttributionConfigFromEnv() AllocAttributionConfig {
+	cfg := AllocAttributionConfig{SampleRatio: 0.1}
+
+	if v, err := strconv.ParseBool(os.Getenv("EXPERIMENTAL_REQUEST_ALLOCS")); err == nil {
+		cfg.Enabled = v
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv("EXPERIMENTAL_REQUEST_ALLOCS_RATIO"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.SampleRatio = v
+	}
+
+	return cfg
+}
+
+// allocMetrics are the cumulative heap allocation counters of the process
+var allocMetrics = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+// AllocAttribution records on the server span of a sample of requests the heap
+// allocations made while their handler ran, request.alloc_bytes and
+// request.alloc_objects, for capacity investigations. The counters are the
+// process ones, so what concurrent requests allocate is counted too:
+// request.concurrent is the number of requests in flight at some point while
+// it ran, itself included, the figures are exact when it's 1. Install it
+// after Server.
+func AllocAttribution(cfg AllocAttributionConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	// every request is counted, to tell how many overlapped a measured one
+	var inFlight, started atomic.Int64
+
+	return func(c *gin.Context) {
+		overlapping := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		startedBefore := started.Add(1)
+
+		span := trace.SpanFromContext(c.Request.Context())
+		if !span.IsRecording() || rand.Float64() >= cfg.SampleRatio {
+			c.Next()
+			return
+		}
+
+		before := readAllocs()
+		c.Next()
+		after := readAllocs()
+		overlapping += started.Load() - startedBefore
+
+		span.SetAttributes(
+			attribute.Int64("request.alloc_bytes", int64(after[0].Value.Uint64()-before[0].Value.Uint64())),
+			attribute.Int64("request.alloc_objects", int64(after[1].Value.Uint64()-before[1].Value.Uint64())),
+			attribute.Int64("request.concurrent", overlapping),
+		)
+	}
+}
+
+func readAllocs() []metrics.Sample {
+	samples := make([]metrics.Sample, len(allocMetrics))
+	for i, name := range allocMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+
+	return samples
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Faults injected by Chaos, recorded in the chaos.fault attribute
+const (
+	FaultLatency = "latency"
+	FaultError   = "error"
+	FaultDBDrop  = "db_connection_drop"
+)
+
+const chaosFaultKey = "chaos.fault"
+
+// ChaosConfig sets how often each fault is injected. At most one fault is
+// injected per request, so the ratios should add up to 1 or less.
+type ChaosConfig struct {
+	Enabled bool
+	// Routes limits the faults to these gin routes (e.g. "/api/v1/user"), every
+	// route is affected when it's empty
+	Routes []string
+
+	LatencyRatio float64
+	Latency      time.Duration
+
+	ErrorRatio  float64
+	ErrorStatus int
+
+	// DBDropRatio is the fraction of requests whose database calls fail as if
+	// the connection had been dropped, see ChaosDropDB
+	DBDropRatio float64
+}
+
+// ChaosConfigFromEnv reads CHAOS_ENABLED, CHAOS_ROUTES, CHAOS_LATENCY_RATIO,
+// CHAOS_LATENCY (default 500ms), CHAOS_ERROR_RATIO, CHAOS_ERROR_STATUS (default
+// 500) and CHAOS_DB_DROP_RATIO. Nothing is injected unless CHAOS_ENABLED is true.
+func ChaosConfigFromEnv() ChaosConfig {
+	cfg := ChaosConfig{
+		Latency:     500 * time.Millisecond,
+		ErrorStatus: http.StatusInternalServerError,
+	}
+
+	cfg.Enabled, _ = strconv.ParseBool(os.Getenv("CHAOS_ENABLED"))
+
+	for _, route := range strings.Split(os.Getenv("CHAOS_ROUTES"), ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			cfg.Routes = append(cfg.Routes, route)
+		}
+	}
+
+	cfg.LatencyRatio = ratioFromEnv("CHAOS_LATENCY_RATIO")
+	cfg.ErrorRatio = ratioFromEnv("CHAOS_ERROR_RATIO")
+	cfg.DBDropRatio = ratioFromEnv("CHAOS_DB_DROP_RATIO")
+
+	if v, err := time.ParseDuration(os.Getenv("CHAOS_LATENCY")); err == nil && v >= 0 {
+		cfg.Latency = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("CHAOS_ERROR_STATUS")); err == nil && v >= 400 && v <= 599 {
+		cfg.ErrorStatus = v
+	}
+
+	return cfg
+}
+
+func ratioFromEnv(key string) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v < 0 || v > 1 {
+		return 0
+	}
+
+	return v
+}
+
+type chaosDropDBKey struct{}
+
+// ChaosDropDB reports whether Chaos chose to drop the database connections of
+// the request ctx belongs to
+func ChaosDropDB(ctx context.Context) bool {
+	drop, _ := ctx.Value(chaosDropDBKey{}).(bool)
+	return drop
+}
+
+// Chaos injects faults in a fraction of the requests to show how they look in
+// traces. The server span is tagged with chaos.fault so injected faults can be
+// told apart from real ones.
+func Chaos(cfg ChaosConfig) gin.HandlerFunc {
+	routes := map[string]bool{}
+	for _, route := range cfg.Routes {
+		routes[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled || (len(routes) > 0 && !routes[c.FullPath()]) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+
+		roll := rand.Float64()
+		switch {
+		case roll < cfg.LatencyRatio:
+			span.SetAttributes(
+				attribute.String(chaosFaultKey, FaultLatency),
+				attribute.Int64("chaos.fault.latency_ms", cfg.Latency.Milliseconds()),
+			)
+			select {
+			case <-time.After(cfg.Latency):
+			case <-ctx.Done():
+			}
+
+		case roll < cfg.LatencyRatio+cfg.ErrorRatio:
+			span.SetAttributes(
+				attribute.String(chaosFaultKey, FaultError),
+				attribute.Int("chaos.fault.status", cfg.ErrorStatus),
+			)
+			c.AbortWithStatusJSON(cfg.ErrorStatus, gin.H{"error": "fault injected by chaos middleware"})
+			return
+
+		case roll < cfg.LatencyRatio+cfg.ErrorRatio+cfg.DBDropRatio:
+			span.SetAttributes(attribute.String(chaosFaultKey, FaultDBDrop))
+			c.Request = c.Request.WithContext(context.WithValue(ctx, chaosDropDBKey{}, true))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+// Package chiadapter instruments chi routers with the semconv server spans of
+// pkg/middleware.
+package chiadapter
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+)
+
+// Server is the chi middleware starting the server spans, install it with
+// Router.Use. chi only knows the route pattern once the request is routed, so
+// it's read after the handler has run.
+func Server() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				middleware.SetRoute(r.Context(), rctx.RoutePattern())
+			}
+		}))
+	}
+}
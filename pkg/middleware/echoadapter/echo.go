@@ -0,0 +1,38 @@
+// Package echoadapter instruments Echo servers with the semconv server spans
+// of pkg/middleware.
+package echoadapter
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+)
+
+// Server is the Echo middleware starting the server spans
+func Server() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			middleware.Instrument(&exchange{c: c, next: next})
+			return nil
+		}
+	}
+}
+
+type exchange struct {
+	c    echo.Context
+	next echo.HandlerFunc
+}
+
+func (x *exchange) Request() *http.Request     { return x.c.Request() }
+func (x *exchange) SetRequest(r *http.Request) { x.c.SetRequest(r) }
+func (x *exchange) Route() string              { return x.c.Path() }
+func (x *exchange) Status() int                { return x.c.Response().Status }
+
+// Next runs the handler, letting Echo write the error it returned so the
+// span sees the status actually sent
+func (x *exchange) Next() {
+	if err := x.next(x.c); err != nil {
+		x.c.Error(err)
+	}
+}
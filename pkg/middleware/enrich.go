@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Enricher returns attributes Instrument adds to the server span of r and to
+// its http.server.request.duration point. It runs on every request before
+// the span starts, so it must be cheap and keep the cardinality bounded.
+type Enricher func(r *http.Request) []attribute.KeyValue
+
+var (
+	enrichersMu sync.RWMutex
+	enrichers   []Enricher
+)
+
+// AddEnricher registers e for every request instrumented from now on,
+// typically from main before the server starts
+func AddEnricher(e Enricher) {
+	enrichersMu.Lock()
+	defer enrichersMu.Unlock()
+
+	enrichers = append(enrichers, e)
+}
+
+// enrich appends the attributes of the registered enrichers to attrs
+func enrich(attrs []attribute.KeyValue, r *http.Request) []attribute.KeyValue {
+	enrichersMu.RLock()
+	defer enrichersMu.RUnlock()
+
+	for _, e := range enrichers {
+		attrs = append(attrs, e(r)...)
+	}
+
+	return attrs
+}
+
+// StaticAttributes is an enricher adding the same attributes to every
+// request, e.g. the team, cost center and region of tel.Config.StaticAttributes
+func StaticAttributes(attrs ...attribute.KeyValue) Enricher {
+	return func(*http.Request) []attribute.KeyValue {
+		return attrs
+	}
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorIDs adds the ids of the server span to the answers outside of 2xx: in an
+// X-Trace-ID header, and in trace_id and span_id fields of 4xx and 5xx bodies
+// so users can quote them in bug reports. Empty and plain text error bodies
+// become {"error": "..."}, other bodies than JSON objects are left alone.
+// Install it after Server.
+func ErrorIDs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sc := trace.SpanContextFromContext(c.Request.Context())
+		if !sc.IsValid() {
+			c.Next()
+			return
+		}
+
+		w := &errorWriter{ResponseWriter: c.Writer, spanContext: sc}
+		// gin sets the status of unmatched routes (404, 405) before running the chain
+		if status := c.Writer.Status(); status != http.StatusOK {
+			w.WriteHeader(status)
+		}
+		c.Writer = w
+		// on a panic Recovery answers through the original writer
+		defer func() {
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+
+		w.finish()
+	}
+}
+
+// errorWriter holds back the body of error answers until the handlers are done
+type errorWriter struct {
+	gin.ResponseWriter
+	spanContext trace.SpanContext
+
+	buffering bool
+	// started is set once the handler sent the header or some of the body
+	started bool
+	body    bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	if code < 200 || code > 299 {
+		w.Header().Set("X-Trace-ID", w.spanContext.TraceID().String())
+	}
+	w.buffering = code >= http.StatusBadRequest
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorWriter) WriteHeaderNow() {
+	if w.buffering {
+		w.started = true
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if w.buffering {
+		w.started = true
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorWriter) WriteString(s string) (int, error) {
+	if w.buffering {
+		w.started = true
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Written is true once an error answer has been started, even if it's held back
+func (w *errorWriter) Written() bool {
+	return w.started || w.ResponseWriter.Written()
+}
+
+func (w *errorWriter) Flush() {
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// finish writes the held back error body with the ids
+func (w *errorWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	w.buffering = false
+
+	body := w.body.Bytes()
+	if out, ok := w.withIDs(body); ok {
+		body = out
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+	w.ResponseWriter.Write(body)
+}
+
+// withIDs returns body with trace_id and span_id, unless it already has them
+// (an upstream answer relayed by a proxy) or isn't something they fit in
+func (w *errorWriter) withIDs(body []byte) ([]byte, bool) {
+	fields := map[string]any{}
+	contentType := w.Header().Get("Content-Type")
+
+	switch {
+	case len(bytes.TrimSpace(body)) == 0:
+		fields["error"] = http.StatusText(w.Status())
+		contentType = "application/json; charset=utf-8"
+	case strings.HasPrefix(contentType, "text/plain"):
+		fields["error"] = strings.TrimSpace(string(body))
+		contentType = "application/json; charset=utf-8"
+	case strings.Contains(contentType, "json"):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, false
+		}
+		if _, ok := fields["trace_id"]; ok {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	fields["trace_id"] = w.spanContext.TraceID().String()
+	fields["span_id"] = w.spanContext.SpanID().String()
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	return out, true
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// lateKey holds the late attributes of the server span of a request
+type lateKey struct{}
+
+// lateAttributes are the functions called right before the server span ends
+type lateAttributes struct {
+	mu  sync.Mutex
+	fns []func() []attribute.KeyValue
+}
+
+// LateAttributes registers fn to be called right before the server span of
+// ctx ends, once the handler returned or panicked, and adds what it returns
+// to the span. Streaming handlers use it for what is only known once the
+// stream is over (bytes and events sent, why it ended) and is still wanted
+// when they are cut short. It does nothing outside of Instrument.
+func LateAttributes(ctx context.Context, fn func() []attribute.KeyValue) {
+	late, ok := ctx.Value(lateKey{}).(*lateAttributes)
+	if !ok {
+		return
+	}
+
+	late.mu.Lock()
+	defer late.mu.Unlock()
+	late.fns = append(late.fns, fn)
+}
+
+// collect calls the registered functions in order
+func (late *lateAttributes) collect() []attribute.KeyValue {
+	late.mu.Lock()
+	defer late.mu.Unlock()
+
+	var attrs []attribute.KeyValue
+	for _, fn := range late.fns {
+		attrs = append(attrs, fn()...)
+	}
+
+	return attrs
+}
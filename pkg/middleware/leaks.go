@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// LeakDetectionConfig turns on the development diagnostics of LeakDetection
+type LeakDetectionConfig struct {
+	Enabled bool
+	// Grace is how long goroutines may outlive their request, and handlers
+	// keep running after their context is done, before being reported
+	Grace time.Duration
+}
+
+// LeakDetectionConfigFromEnv reads LEAK_DETECTION (off by default, it's meant
+// for development) and LEAK_DETECTION_GRACE (default 1s)
+func LeakDetectionConfigFromEnv() LeakDetectionConfig {
+	cfg := LeakDetectionConfig{Grace: time.Second}
+
+	if v, err := strconv.ParseBool(os.Getenv("LEAK_DETECTION")); err == nil {
+		cfg.Enabled = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("LEAK_DETECTION_GRACE")); err == nil && v > 0 {
+		cfg.Grace = v
+	}
+
+	return cfg
+}
+
+// leakLabel is the pprof label marking the goroutines started for a request.
+// Goroutines inherit the labels of the one starting them, so every goroutine
+// a handler starts, directly or not, carries it.
+const leakLabel = "leak.request"
+
+// LeakDetection reports, as warning log records in the trace of the request,
+// the handlers leaving goroutines behind once Grace has passed after the
+// answer, and the ones still running Grace after their context was canceled.
+// Goroutines meant to outlive a request, like connection pools started by the
+// first one, are reported once too. Install it after Server.
+func LeakDetection(cfg LeakDetectionConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	logger := global.GetLoggerProvider().Logger(scopeName)
+	var requests atomic.Uint64
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		route, method := c.FullPath(), c.Request.Method
+		id := strconv.FormatUint(requests.Add(1), 10)
+
+		// started before the labels are set so it isn't counted as a leak
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+			}
+
+			select {
+			case <-done:
+			case <-time.After(cfg.Grace):
+				emitLeak(ctx, logger, "context_ignored",
+					fmt.Sprintf("%s %s still running %s after its context was done (%v)", method, route, cfg.Grace, context.Cause(ctx)),
+					log.String("http.route", route), log.String("http.request.method", method))
+			}
+		}()
+
+		pprof.Do(ctx, pprof.Labels(leakLabel, id), func(context.Context) {
+			c.Next()
+		})
+		close(done)
+
+		go func() {
+			time.Sleep(cfg.Grace)
+			count, functions := labeledGoroutines(id)
+			if count == 0 {
+				return
+			}
+
+			emitLeak(ctx, logger, "goroutine_leak",
+				fmt.Sprintf("%s %s left %d goroutines running %s after answering", method, route, count, cfg.Grace),
+				log.String("http.route", route), log.String("http.request.method", method),
+				log.Int("goroutine.count", count), log.String("code.function", strings.Join(functions, ",")),
+			)
+		}()
+	}
+}
+
+func emitLeak(ctx context.Context, logger log.Logger, kind, body string, attrs ...log.KeyValue) {
+	var record log.Record
+	record.SetTimestamp(time.Now())
+	record.SetSeverity(log.SeverityWarn)
+	record.SetSeverityText(log.SeverityWarn.String())
+	record.SetBody(log.StringValue(body))
+	record.AddAttributes(log.String("diagnostic.type", kind))
+	record.AddAttributes(attrs...)
+
+	// ctx still holds the server span, the record lands in its trace
+	logger.Emit(ctx, record)
+}
+
+// labeledGoroutines returns the number of goroutines carrying the leak label
+// of request id, and the functions they were started with
+func labeledGoroutines(id string) (int, []string) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return 0, nil
+	}
+
+	// debug=1 groups identical stacks: "N @ pcs", "# labels: {...}" and the
+	// frames, outermost last, separated by blank lines
+	want := fmt.Sprintf("%q:%q", leakLabel, id)
+	count := 0
+	functions := map[string]bool{}
+	for _, group := range strings.Split(buf.String(), "\n\n") {
+		scanner := bufio.NewScanner(strings.NewReader(group))
+		n, labeled, outermost := 0, false, ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case n == 0 && strings.Contains(line, " @ "):
+				n, _ = strconv.Atoi(strings.Fields(line)[0])
+			case strings.HasPrefix(line, "# labels: "):
+				labeled = strings.Contains(line, want+",") || strings.Contains(line, want+"}")
+			case strings.HasPrefix(line, "#\t"):
+				if fields := strings.Fields(line); len(fields) >= 3 {
+					outermost = fields[2]
+				}
+			}
+		}
+
+		if labeled {
+			count += n
+			if i := strings.LastIndex(outermost, "+0x"); i > 0 {
+				outermost = outermost[:i]
+			}
+			functions[outermost] = true
+		}
+	}
+
+	names := make([]string, 0, len(functions))
+	for f := range functions {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+
+	return count, names
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// latencyWindow is how long a latency sample counts towards the p99
+	latencyWindow = 10 * time.Second
+	// latencySamples bounds the number of samples kept for the p99
+	latencySamples = 1024
+	// p99RefreshInterval limits how often the p99 is recomputed
+	p99RefreshInterval = time.Second
+)
+
+// LoadShedConfig holds the thresholds above which requests are rejected. A zero
+// value disables the corresponding check.
+type LoadShedConfig struct {
+	MaxInFlight int64
+	MaxP99      time.Duration
+}
+
+// LoadShedConfigFromEnv reads LOADSHED_MAX_INFLIGHT and LOADSHED_MAX_P99 (e.g. "2s"),
+// defaulting to 100 in-flight requests and a 2s p99.
+func LoadShedConfigFromEnv() LoadShedConfig {
+	cfg := LoadShedConfig{
+		MaxInFlight: 100,
+		MaxP99:      2 * time.Second,
+	}
+
+	if v, err := strconv.ParseInt(os.Getenv("LOADSHED_MAX_INFLIGHT"), 10, 64); err == nil {
+		cfg.MaxInFlight = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("LOADSHED_MAX_P99")); err == nil {
+		cfg.MaxP99 = v
+	}
+
+	return cfg
+}
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// loadShedder tracks in-flight requests and recent latencies
+type loadShedder struct {
+	cfg      LoadShedConfig
+	inFlight atomic.Int64
+
+	mu        sync.Mutex
+	samples   [latencySamples]latencySample
+	next      int
+	p99       time.Duration
+	p99Expiry time.Time
+
+	activeRequests metric.Int64UpDownCounter
+	shedRequests   metric.Int64Counter
+}
+
+// LoadShed rejects requests with 503 while the number of in-flight requests or
+// the recent p99 latency is above the configured thresholds.
+func LoadShed(cfg LoadShedConfig) gin.HandlerFunc {
+	meter := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/middleware")
+
+	activeRequests, _ := meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests"),
+		metric.WithUnit("{request}"),
+	)
+	shedRequests, _ := meter.Int64Counter("http.server.shed_requests",
+		metric.WithDescription("Number of HTTP server requests rejected by load shedding"),
+		metric.WithUnit("{request}"),
+	)
+
+	ls := &loadShedder{
+		cfg:            cfg,
+		activeRequests: activeRequests,
+		shedRequests:   shedRequests,
+	}
+
+	return ls.handle
+}
+
+func (ls *loadShedder) handle(c *gin.Context) {
+	ctx := c.Request.Context()
+	attrs := metric.WithAttributes(attribute.String("http.request.method", c.Request.Method))
+
+	// counted before the check, so a burst can't pass it all at once; the
+	// others are the requests in flight besides this one
+	others := ls.inFlight.Add(1) - 1
+	if reason := ls.shedReason(others); reason != "" {
+		ls.inFlight.Add(-1)
+		ls.shedRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.String("http.server.shed.reason", reason),
+		))
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("http.server.shed", true),
+			attribute.String("http.server.shed.reason", reason),
+		)
+
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is overloaded, retry later"})
+		return
+	}
+
+	ls.activeRequests.Add(ctx, 1, attrs)
+	defer func() {
+		ls.inFlight.Add(-1)
+		ls.activeRequests.Add(ctx, -1, attrs)
+	}()
+
+	start := time.Now()
+	c.Next()
+	ls.observe(start, time.Since(start))
+}
+
+// shedReason returns why a request should be rejected, or "" to admit it
+func (ls *loadShedder) shedReason(inFlight int64) string {
+	if ls.cfg.MaxInFlight > 0 && inFlight >= ls.cfg.MaxInFlight {
+		return "in_flight"
+	}
+
+	if ls.cfg.MaxP99 > 0 && ls.currentP99() > ls.cfg.MaxP99 {
+		return "latency"
+	}
+
+	return ""
+}
+
+func (ls *loadShedder) observe(at time.Time, d time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.samples[ls.next] = latencySample{at: at, duration: d}
+	ls.next = (ls.next + 1) % latencySamples
+}
+
+// currentP99 returns the p99 over the samples in the latency window. It's only
+// recomputed every p99RefreshInterval, and old samples age out so shedding on
+// latency stops once the slow requests are out of the window.
+func (ls *loadShedder) currentP99() time.Duration {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(ls.p99Expiry) {
+		return ls.p99
+	}
+
+	durations := make([]time.Duration, 0, latencySamples)
+	for _, s := range ls.samples {
+		if !s.at.IsZero() && now.Sub(s.at) <= latencyWindow {
+			durations = append(durations, s.duration)
+		}
+	}
+
+	ls.p99 = 0
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		ls.p99 = durations[(len(durations)*99)/100]
+	}
+	ls.p99Expiry = now.Add(p99RefreshInterval)
+
+	return ls.p99
+}
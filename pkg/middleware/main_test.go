@@ -0,0 +1,30 @@
+package middleware_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spans gets every span ended by the instrumentation, which uses the global
+// providers
+var spans = tracetest.NewInMemoryExporter()
+
+// metrics reads the measurements made since the last collection
+var metrics = sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+	func(sdkmetric.InstrumentKind) metricdata.Temporality { return metricdata.DeltaTemporality },
+))
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)))
+
+	os.Exit(m.Run())
+}
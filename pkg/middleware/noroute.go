@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NoRoute names the server span of the requests no route matched
+// "HTTP {method}", "HTTP" for methods outside of knownMethods, and answers
+// 404. Their span has no http.route and the path only shows in url.path, so
+// scanners probing /../../etc/passwd and the like don't make a span name per
+// URL. Install it with router.NoRoute, the router middleware runs first.
+func NoRoute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := "HTTP"
+		if _, known := knownMethods[c.Request.Method]; known {
+			name += " " + c.Request.Method
+		}
+		trace.SpanFromContext(c.Request.Context()).SetName(name)
+
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "no route matches the request"})
+	}
+}
@@ -0,0 +1,66 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNoRoute(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.Server())
+	router.NoRoute(middleware.NoRoute())
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, tc := range []struct {
+		method, path string
+		name         string
+	}{
+		{method: http.MethodGet, path: "/nope", name: "HTTP GET"},
+		{method: http.MethodPost, path: "/users/1", name: "HTTP POST"},
+		{method: http.MethodGet, path: "/../../etc/passwd", name: "HTTP GET"},
+		{method: http.MethodGet, path: "/users/..%2f..%2fadmin", name: "HTTP GET"},
+		{method: "PROPFIND", path: "/", name: "HTTP"},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			spans.Reset()
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusNotFound {
+				t.Errorf("answered %d, want 404", resp.Code)
+			}
+
+			ended := spans.GetSpans()
+			if len(ended) != 1 {
+				t.Fatalf("got %d spans, want the server span", len(ended))
+			}
+			span := ended[0]
+
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("span kind is %s, want server", span.SpanKind)
+			}
+			if span.Name != tc.name {
+				t.Errorf("span name is %q, want %q", span.Name, tc.name)
+			}
+
+			attrs := attribute.NewSet(span.Attributes...)
+			if route, ok := attrs.Value("http.route"); ok {
+				t.Errorf("http.route is %q, want none", route.AsString())
+			}
+			if status, _ := attrs.Value("http.response.status_code"); status.AsInt64() != http.StatusNotFound {
+				t.Errorf("http.response.status_code is %d, want 404", status.AsInt64())
+			}
+			if path, _ := attrs.Value("url.path"); path.AsString() != req.URL.Path {
+				t.Errorf("url.path is %q, want %q", path.AsString(), req.URL.Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Protocol records the HTTP version of the request on the server span as
+// network.protocol.name and network.protocol.version ("1.1", "2"), along with
+// url.scheme and, over HTTPS, the tls.* attributes of the connection.
+func Protocol() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := trace.SpanFromContext(c.Request.Context())
+		span.SetAttributes(
+			attribute.String("network.protocol.name", "http"),
+			attribute.String("network.protocol.version", protocolVersion(c.Request.ProtoMajor, c.Request.ProtoMinor)),
+		)
+
+		if state := c.Request.TLS; state != nil {
+			span.SetAttributes(
+				attribute.String("url.scheme", "https"),
+				attribute.String("tls.protocol.name", "tls"),
+				attribute.String("tls.protocol.version", tlsVersion(state.Version)),
+				attribute.String("tls.cipher", tls.CipherSuiteName(state.CipherSuite)),
+				attribute.String("tls.next_protocol", state.NegotiatedProtocol),
+			)
+		} else {
+			span.SetAttributes(attribute.String("url.scheme", "http"))
+		}
+
+		c.Next()
+	}
+}
+
+// tlsVersion returns the version without its "TLS " prefix, e.g. "1.3"
+func tlsVersion(version uint16) string {
+	return strings.TrimPrefix(tls.VersionName(version), "TLS ")
+}
+
+// protocolVersion formats the version the way semantic conventions expect:
+// HTTP/2 and HTTP/3 have no minor version
+func protocolVersion(major, minor int) string {
+	if major >= 2 {
+		return strconv.Itoa(major)
+	}
+
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig is a token bucket shared by every request it applies to. A
+// zero Rate disables the limit.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second let through on average
+	Rate float64
+	// Burst is the number of requests let through at once
+	Burst int
+
+	// RedisURL, e.g. redis://localhost:6379/0, keeps the bucket in Redis so
+	// every instance counts against the same limit. Empty keeps it in memory,
+	// per instance.
+	RedisURL string
+	// Name is the Redis key of the bucket, ratelimit:<Name>, the instances
+	// sharing a limit must use the same
+	Name string
+}
+
+// RateLimitConfigFromEnv reads <prefix>_RATE_LIMIT (requests per second) and
+// <prefix>_RATE_BURST, falling back to fallback for the ones not set, and
+// RATE_LIMIT_REDIS_URL. The bucket is named after prefix.
+func RateLimitConfigFromEnv(prefix string, fallback RateLimitConfig) RateLimitConfig {
+	cfg := fallback
+	if cfg.Name == "" {
+		cfg.Name = strings.ToLower(prefix)
+	}
+	if v := os.Getenv("RATE_LIMIT_REDIS_URL"); v != "" {
+		cfg.RedisURL = v
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv(prefix+"_RATE_LIMIT"), 64); err == nil && v >= 0 {
+		cfg.Rate = v
+	}
+
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_RATE_BURST")); err == nil && v > 0 {
+		cfg.Burst = v
+	}
+
+	return cfg
+}
+
+// RateLimit answers 429 once requests come in faster than cfg allows
+func RateLimit(cfg RateLimitConfig) gin.HandlerFunc {
+	if cfg.Rate <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limitedRequests, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/middleware").Int64Counter(
+		"http.server.rate_limited_requests",
+		metric.WithDescription("Number of HTTP server requests rejected by rate limiting"),
+		metric.WithUnit("{request}"),
+	)
+
+	burst := max(cfg.Burst, 1)
+	limiter := rate.NewLimiter(rate.Limit(cfg.Rate), burst)
+	retryAfter := time.Duration(float64(time.Second) / cfg.Rate)
+
+	// the in-memory bucket stands in for Redis while it can't be reached
+	allow := func(context.Context) (bool, time.Duration) {
+		return limiter.Allow(), retryAfter
+	}
+	if cfg.RedisURL != "" {
+		redisLimiter, err := newRedisLimiter(cfg, burst)
+		if err != nil {
+			logging.Default().Error("Rate limiting in memory, the Redis URL is invalid", "error", err)
+		} else {
+			// after a failure Redis is left alone for a moment, rather than
+			// making every request wait for it to time out
+			var retryRedisAt atomic.Int64
+			allow = func(ctx context.Context) (bool, time.Duration) {
+				if time.Now().UnixNano() < retryRedisAt.Load() {
+					return limiter.Allow(), retryAfter
+				}
+				ok, wait, err := redisLimiter.allow(ctx)
+				if err != nil {
+					retryRedisAt.Store(time.Now().Add(redisRetryInterval).UnixNano())
+					return limiter.Allow(), retryAfter
+				}
+				return ok, wait
+			}
+		}
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ok, wait := allow(ctx)
+		if ok {
+			c.Next()
+			return
+		}
+
+		limitedRequests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+		))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("http.server.rate_limited", true))
+
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(max(wait, time.Second).Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, retry later"})
+	}
+}
+
+// gcraScript is the generic cell rate algorithm: the bucket is the theoretical
+// arrival time of the next request, in microseconds of the Redis clock, and
+// a request is let through unless it would push it more than burst
+// intervals ahead. It returns {1, 0} or {0, microseconds to wait}.
+const gcraScript = `
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then tat = now end
+local next_tat = tat + interval
+local allow_at = next_tat - interval * burst
+if allow_at > now then return {0, allow_at - now} end
+redis.call('SET', KEYS[1], string.format('%.0f', next_tat), 'PX', math.ceil(interval * burst / 1000))
+return {1, 0}
+`
+
+// redisRetryInterval is how long the in-memory bucket is used after Redis failed
+const redisRetryInterval = time.Second
+
+var gcraSHA = fmt.Sprintf("%x", sha1.Sum([]byte(gcraScript)))
+
+// redisLimiter is a GCRA bucket kept in Redis, shared by the instances
+type redisLimiter struct {
+	client   *redisClient
+	key      string
+	interval string
+	burst    string
+}
+
+func newRedisLimiter(cfg RateLimitConfig, burst int) (*redisLimiter, error) {
+	client, err := redisClientFor(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisLimiter{
+		client:   client,
+		key:      "ratelimit:" + cfg.Name,
+		interval: strconv.FormatInt(max(int64(1e6/cfg.Rate), 1), 10),
+		burst:    strconv.Itoa(burst),
+	}, nil
+}
+
+// allow runs the script, loading it the first time the server misses it
+func (l *redisLimiter) allow(ctx context.Context) (bool, time.Duration, error) {
+	reply, err := l.client.do(ctx, "EVALSHA", gcraSHA, "1", l.key, l.interval, l.burst)
+	var re redisError
+	if errors.As(err, &re) && re.prefix() == "NOSCRIPT" {
+		reply, err = l.client.do(ctx, "EVAL", gcraScript, "1", l.key, l.interval, l.burst)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	items, ok := reply.([]any)
+	if !ok || len(items) != 2 {
+		return false, 0, fmt.Errorf("redis: unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := items[0].(int64)
+	wait, _ := items[1].(int64)
+
+	return allowed == 1, time.Duration(wait) * time.Microsecond, nil
+}
@@ -0,0 +1,71 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/testenv"
+)
+
+// rateLimitSteps run against a bucket of 5 requests per second, one every
+// 200ms, with bursts of 3. The instance alternates so a bucket kept in Redis
+// must be shared for the burst to run out.
+var rateLimitSteps = []struct {
+	name     string
+	instance int
+	sleep    time.Duration
+	status   int
+}{
+	{name: "burst 1", instance: 0, status: http.StatusOK},
+	{name: "burst 2", instance: 1, status: http.StatusOK},
+	{name: "burst 3", instance: 0, status: http.StatusOK},
+	{name: "burst spent", instance: 1, status: http.StatusTooManyRequests},
+	// 300ms later one interval has passed, and not yet two
+	{name: "one interval later", instance: 0, sleep: 300 * time.Millisecond, status: http.StatusOK},
+	{name: "within the interval", instance: 1, status: http.StatusTooManyRequests},
+}
+
+func rateLimitedRouter(cfg middleware.RateLimitConfig) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware.RateLimit(cfg))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	return router
+}
+
+func runRateLimitSteps(t *testing.T, instances [2]*gin.Engine) {
+	t.Helper()
+
+	for _, step := range rateLimitSteps {
+		time.Sleep(step.sleep)
+
+		resp := httptest.NewRecorder()
+		instances[step.instance].ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+		if resp.Code != step.status {
+			t.Fatalf("%s: answered %d, want %d", step.name, resp.Code, step.status)
+		}
+		if step.status == http.StatusTooManyRequests && resp.Header().Get("Retry-After") != "1" {
+			t.Errorf("%s: Retry-After is %q, want 1", step.name, resp.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRateLimitMemory(t *testing.T) {
+	router := rateLimitedRouter(middleware.RateLimitConfig{Rate: 5, Burst: 3})
+	runRateLimitSteps(t, [2]*gin.Engine{router, router})
+}
+
+// TestRateLimitRedis runs the GCRA script, two instances sharing its bucket
+func TestRateLimitRedis(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts Redis in docker")
+	}
+
+	cfg := middleware.RateLimitConfig{Rate: 5, Burst: 3, RedisURL: testenv.StartRedis(t), Name: "test"}
+	runRateLimitSteps(t, [2]*gin.Engine{rateLimitedRouter(cfg), rateLimitedRouter(cfg)})
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redisClient speaks just enough RESP to run the rate limiting script, over a
+// small pool of connections. Every command is a CLIENT span following the
+// database semantic conventions.
+type redisClient struct {
+	addr     string
+	host     string
+	port     int
+	username string
+	password string
+	db       int
+
+	idle chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisPoolSize bounds the idle connections kept per server
+const redisPoolSize = 8
+
+// redisTimeout bounds a command when ctx has no deadline, a rate limiter
+// waiting on Redis is worse than none
+const redisTimeout = 100 * time.Millisecond
+
+var redisClients sync.Map
+
+// redisClientFor returns the client of rawURL (redis://[user:password@]host:port[/db]),
+// shared by every limiter using it
+func redisClientFor(rawURL string) (*redisClient, error) {
+	if c, ok := redisClients.Load(rawURL); ok {
+		return c.(*redisClient), nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("redis URL %q: the scheme must be redis", rawURL)
+	}
+
+	c := &redisClient{addr: u.Host, host: u.Hostname(), port: 6379, idle: make(chan *redisConn, redisPoolSize)}
+	if p := u.Port(); p != "" {
+		if c.port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("redis URL %q: %w", rawURL, err)
+		}
+	} else {
+		c.addr = net.JoinHostPort(c.host, "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis URL %q: the path must be a database number", rawURL)
+		}
+	}
+
+	actual, _ := redisClients.LoadOrStore(rawURL, c)
+	return actual.(*redisClient), nil
+}
+
+// redisError is an error reply of the server, e.g. NOSCRIPT
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// prefix is the error code, the first word of the reply
+func (e redisError) prefix() string {
+	code, _, _ := strings.Cut(string(e), " ")
+	return code
+}
+
+// do sends the command in a span named after it and returns the reply:
+// a string, an int64, nil or a []any of those
+func (c *redisClient) do(ctx context.Context, args ...string) (reply any, err error) {
+	operation := strings.ToUpper(args[0])
+	ctx, span := otel.Tracer(scopeName).Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.namespace", strconv.Itoa(c.db)),
+			attribute.String("server.address", c.host),
+			attribute.Int("server.port", c.port),
+		),
+	)
+	defer func() {
+		if err != nil {
+			errorType := "_OTHER"
+			if re, ok := err.(redisError); ok {
+				errorType = re.prefix()
+			}
+			span.SetAttributes(attribute.String("error.type", errorType))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, redisTimeout)
+		defer cancel()
+	}
+
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	reply, err = conn.roundTrip(args)
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		// the connection may hold half a reply, it can't be reused
+		conn.Close()
+		return nil, err
+	}
+
+	c.release(conn)
+	return reply, err
+}
+
+// conn takes an idle connection, or opens one and selects the database
+func (c *redisClient) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if c.password != "" {
+		auth := []string{"AUTH", c.password}
+		if c.username != "" {
+			auth = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.roundTrip(auth); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.roundTrip([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *redisClient) release(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// roundTrip writes the command as an array of bulk strings and reads the reply
+func (conn *redisConn) roundTrip(args []string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return conn.read()
+}
+
+// read parses one RESP2 reply
+func (conn *redisConn) read() (any, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(conn.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			// an error inside an array is a value, not a failed command
+			if items[i], err = conn.read(); err != nil {
+				var re redisError
+				if !errors.As(err, &re) {
+					return nil, err
+				}
+				items[i] = re
+			}
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/conventions"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/neha-gupta1/otel-semantics/pkg/middleware"
+
+// Exchange is what the server instrumentation needs from a web framework: the
+// request, a way to run the rest of the chain and the status it answered with.
+// Adapting a framework only takes implementing it, see Server and Handler.
+type Exchange interface {
+	Request() *http.Request
+	SetRequest(r *http.Request)
+	// Route is the matched route template, "" when the framework only knows
+	// it once the request has been routed, see SetRoute
+	Route() string
+	Next()
+	Status() int
+}
+
+// knownMethods are reported as is, others as _OTHER to bound the cardinality.
+// Their attributes are built once, like the ones of the schemes.
+var knownMethods = map[string]attribute.KeyValue{}
+
+var (
+	otherMethod = attribute.String("http.request.method", "_OTHER")
+	schemeHTTP  = attribute.String("url.scheme", "http")
+	schemeHTTPS = attribute.String("url.scheme", "https")
+)
+
+func init() {
+	for _, method := range []string{
+		http.MethodConnect, http.MethodDelete, http.MethodGet,
+		http.MethodHead, http.MethodOptions, http.MethodPatch,
+		http.MethodPost, http.MethodPut, http.MethodTrace,
+	} {
+		knownMethods[method] = attribute.String("http.request.method", method)
+	}
+}
+
+var (
+	instrumentsOnce sync.Once
+	requestDuration metric.Float64Histogram
+)
+
+// routeKey holds where SetRoute writes the route of the request
+type routeKey struct{}
+
+// SetRoute records the route template matched for the request of ctx, for
+// routers that only know it after the server span has started
+func SetRoute(ctx context.Context, route string) {
+	if holder, ok := ctx.Value(routeKey{}).(*string); ok {
+		*holder = route
+	}
+}
+
+// Instrument runs the rest of the chain of x in a server span following the
+// HTTP semantic conventions, and records http.server.request.duration
+func Instrument(x Exchange) {
+	instrumentsOnce.Do(func() {
+		requestDuration, _ = otel.Meter(scopeName).Float64Histogram("http.server.request.duration",
+			metric.WithDescription("Duration of HTTP server requests"),
+			metric.WithUnit("s"),
+		)
+	})
+
+	r := x.Request()
+	start := time.Now()
+
+	// The attributes are built in pooled slices, the SDK copies them
+	buf := conventions.AcquireAttributes()
+	defer conventions.ReleaseAttributes(buf)
+	attrs := *buf
+
+	method := r.Method
+	methodAttr, known := knownMethods[method]
+	if !known {
+		attrs = append(attrs, attribute.String("http.request.method_original", method))
+		method, methodAttr = "_OTHER", otherMethod
+	}
+
+	scheme := schemeHTTP
+	if r.TLS != nil {
+		scheme = schemeHTTPS
+	}
+
+	// the requirement levels of the HTTP server span, the profile keeps some
+	attrs = append(attrs,
+		methodAttr,
+		attribute.String("url.path", r.URL.Path),
+		scheme,
+	)
+	attrs = conventions.Add(attrs, conventions.Recommended,
+		attribute.String("network.protocol.version", protocolVersion(r.ProtoMajor, r.ProtoMinor)))
+	if host, port, err := net.SplitHostPort(r.Host); err == nil {
+		attrs = conventions.Add(attrs, conventions.Recommended, attribute.String("server.address", host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = conventions.Add(attrs, conventions.Recommended, attribute.Int("server.port", p))
+		}
+	} else if r.Host != "" {
+		attrs = conventions.Add(attrs, conventions.Recommended, attribute.String("server.address", r.Host))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attrs = conventions.Add(attrs, conventions.Recommended, attribute.String("user_agent.original", ua))
+	}
+	if host, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		attrs = conventions.Add(attrs, conventions.Recommended,
+			attribute.String("client.address", host),
+			attribute.String("network.peer.address", host),
+		)
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = conventions.Add(attrs, conventions.Recommended, attribute.Int("network.peer.port", p))
+			attrs = conventions.Add(attrs, conventions.OptIn, attribute.Int("client.port", p))
+		}
+	}
+	// the spec wants the query whenever there's one, but it often holds
+	// personal data, so it's left to the full profile
+	if r.URL.RawQuery != "" {
+		attrs = conventions.Add(attrs, conventions.OptIn, attribute.String("url.query", r.URL.RawQuery))
+	}
+	if r.ContentLength > 0 {
+		attrs = conventions.Add(attrs, conventions.OptIn, attribute.Int64("http.request.body.size", r.ContentLength))
+	}
+
+	route := x.Route()
+	if route != "" {
+		attrs = append(attrs, attribute.String("http.route", route))
+	}
+	enrichedFrom := len(attrs)
+	attrs = enrich(attrs, r)
+	enriched := attrs[enrichedFrom:]
+	// keep what append grew for the next request
+	*buf = attrs
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = context.WithValue(ctx, routeKey{}, &route)
+	late := &lateAttributes{}
+	ctx = context.WithValue(ctx, lateKey{}, late)
+	startRoute := route
+	ctx, span := otel.Tracer(scopeName).Start(ctx, spanName(method, route),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+	defer func() {
+		span.SetAttributes(late.collect()...)
+		span.End()
+	}()
+
+	x.SetRequest(r.WithContext(ctx))
+	x.Next()
+
+	status := x.Status()
+	statusAttr := attribute.Int("http.response.status_code", status)
+	span.SetAttributes(statusAttr)
+	// only routers calling SetRoute learn the route this late
+	if route != startRoute {
+		span.SetAttributes(attribute.String("http.route", route))
+		span.SetName(spanName(method, route))
+	}
+
+	metricBuf := conventions.AcquireAttributes()
+	defer conventions.ReleaseAttributes(metricBuf)
+	metricAttrs := append(*metricBuf, methodAttr, scheme, statusAttr)
+	metricAttrs = append(metricAttrs, enriched...)
+	if route != "" {
+		metricAttrs = append(metricAttrs, attribute.String("http.route", route))
+	}
+
+	// Servers only own the 5xx, a 4xx is the client's mistake
+	if status >= http.StatusInternalServerError {
+		errorType := attribute.String("error.type", strconv.Itoa(status))
+		span.SetAttributes(errorType)
+		span.SetStatus(codes.Error, http.StatusText(status))
+		metricAttrs = append(metricAttrs, errorType)
+	}
+
+	*metricBuf = metricAttrs
+	requestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(metricAttrs...))
+}
+
+// spanName is "{method} {route}", or only the method when the route is unknown
+func spanName(method, route string) string {
+	if route == "" {
+		return method
+	}
+
+	return method + " " + route
+}
+
+// Server instruments gin routers
+func Server() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		Instrument(ginExchange{c})
+	}
+}
+
+type ginExchange struct {
+	c *gin.Context
+}
+
+func (x ginExchange) Request() *http.Request     { return x.c.Request }
+func (x ginExchange) SetRequest(r *http.Request) { x.c.Request = r }
+func (x ginExchange) Route() string              { return x.c.FullPath() }
+func (x ginExchange) Next()                      { x.c.Next() }
+func (x ginExchange) Status() int                { return x.c.Writer.Status() }
+
+// Handler instruments a net/http handler. Wrap the handlers of the routes with
+// Route so the spans know which one was matched.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Instrument(&httpExchange{w: &statusRecorder{ResponseWriter: w}, r: r, next: next})
+	})
+}
+
+// Route records route as the http.route of the requests handled by h
+func Route(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), route)
+		h.ServeHTTP(w, r)
+	})
+}
+
+type httpExchange struct {
+	w    *statusRecorder
+	r    *http.Request
+	next http.Handler
+}
+
+func (x *httpExchange) Request() *http.Request     { return x.r }
+func (x *httpExchange) SetRequest(r *http.Request) { x.r = r }
+func (x *httpExchange) Route() string              { return "" }
+func (x *httpExchange) Next()                      { x.next.ServeHTTP(x.w, x.r) }
+func (x *httpExchange) Status() int                { return x.w.status() }
+
+// statusRecorder remembers the status written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the recorder
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusRecorder) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
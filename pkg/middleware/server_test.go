@@ -0,0 +1,57 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// BenchmarkServer measures the overhead of the server instrumentation: the
+// same gin handler without instrumentation, with otelgin and with Server.
+// OTEL_SEMCONV_ATTRIBUTE_PROFILE picks the attributes of Server.
+func BenchmarkServer(b *testing.B) {
+	// Spans go through the real SDK pipeline, only the export is skipped
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(discardExporter{}))
+	defer tp.Shutdown(context.Background())
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(tp)
+
+	defer gin.SetMode(gin.Mode())
+	gin.SetMode(gin.ReleaseMode)
+
+	for _, bm := range []struct {
+		name  string
+		setup func(router *gin.Engine)
+	}{
+		{"off", func(*gin.Engine) {}},
+		{"otelgin", func(router *gin.Engine) { router.Use(otelgin.Middleware("bench")) }},
+		{"middleware", func(router *gin.Engine) { router.Use(middleware.Server()) }},
+	} {
+		router := gin.New()
+		bm.setup(router)
+		router.GET("/api/v1/user/:id", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user": gin.H{"id": c.Param("id")}})
+		})
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				req := httptest.NewRequest(http.MethodGet, "/api/v1/user/6650a1b2c3d4e5f6a7b8c9d0", nil)
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
+
+// discardExporter drops the exported spans
+type discardExporter struct{}
+
+func (discardExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error { return nil }
+func (discardExporter) Shutdown(context.Context) error                             { return nil }
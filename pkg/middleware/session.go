@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SessionConfig controls how requests are grouped into sessions
+type SessionConfig struct {
+	// Enabled turns the middleware on
+	Enabled bool
+	// Cookie is the name of the cookie the server keeps the session in
+	Cookie string
+	// Header carries the session of clients managing it themselves, e.g.
+	// mobile apps. It's taken as is and never rotated.
+	Header string
+	// Lifetime is how long a session lasts without requests
+	Lifetime time.Duration
+	// Rotation is the age after which a cookie session gets a new id, the old
+	// one being recorded as session.previous_id. 0 never rotates.
+	Rotation time.Duration
+}
+
+// SessionConfigFromEnv reads SESSION_ENABLED, SESSION_COOKIE (default
+// session), SESSION_HEADER (default X-Session-ID), SESSION_LIFETIME (default
+// 30m) and SESSION_ROTATION (default 24h)
+func SessionConfigFromEnv() SessionConfig {
+	cfg := SessionConfig{
+		Cookie:   "session",
+		Header:   "X-Session-ID",
+		Lifetime: 30 * time.Minute,
+		Rotation: 24 * time.Hour,
+	}
+
+	if v, err := strconv.ParseBool(os.Getenv("SESSION_ENABLED")); err == nil {
+		cfg.Enabled = v
+	}
+
+	if v := os.Getenv("SESSION_COOKIE"); v != "" {
+		cfg.Cookie = v
+	}
+
+	if v := os.Getenv("SESSION_HEADER"); v != "" {
+		cfg.Header = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("SESSION_LIFETIME")); err == nil && v > 0 {
+		cfg.Lifetime = v
+	}
+
+	if v, err := time.ParseDuration(os.Getenv("SESSION_ROTATION")); err == nil && v >= 0 {
+		cfg.Rotation = v
+	}
+
+	return cfg
+}
+
+// maxSessionIDLength bounds the ids clients send in the header
+const maxSessionIDLength = 128
+
+// Session records the session of every request as session.id on the server
+// span and in the request context, so the log lines and access logs carry it
+// too. A request with neither the header nor a live cookie starts a session,
+// kept in a cookie refreshed on every request. Install it after Server.
+func Session(cfg SessionConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	sessions, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/middleware").Int64Counter(
+		"http.server.sessions",
+		metric.WithDescription("Number of sessions started or rotated, by session.event"),
+		metric.WithUnit("{session}"),
+	)
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+
+		if id := c.GetHeader(cfg.Header); validSessionID(id) {
+			span.SetAttributes(attribute.String("session.id", id))
+			c.Request = c.Request.WithContext(logging.WithSession(ctx, id))
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		id, started, ok := parseSessionCookie(c, cfg.Cookie)
+		switch {
+		case !ok:
+			id, started = newSessionID(), now
+			sessions.Add(ctx, 1, metric.WithAttributes(attribute.String("session.event", "start")))
+		case cfg.Rotation > 0 && now.Sub(started) >= cfg.Rotation:
+			span.SetAttributes(attribute.String("session.previous_id", id))
+			id, started = newSessionID(), now
+			sessions.Add(ctx, 1, metric.WithAttributes(attribute.String("session.event", "rotate")))
+		}
+
+		// the cookie is sent again on every request, so the session only
+		// expires after Lifetime without any
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     cfg.Cookie,
+			Value:    id + "." + strconv.FormatInt(started.Unix(), 10),
+			Path:     "/",
+			MaxAge:   int(cfg.Lifetime.Seconds()),
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		span.SetAttributes(attribute.String("session.id", id))
+		c.Request = c.Request.WithContext(logging.WithSession(ctx, id))
+		c.Next()
+	}
+}
+
+// parseSessionCookie returns the id and start of the session in the cookie,
+// "<id>.<unix start>"
+func parseSessionCookie(c *gin.Context, name string) (string, time.Time, bool) {
+	value, err := c.Cookie(name)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	id, started, ok := strings.Cut(value, ".")
+	if !ok || !validSessionID(id) {
+		return "", time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(started, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return id, time.Unix(unix, 0), true
+}
+
+// validSessionID accepts the ids made of letters, digits, - and _, short
+// enough to be an attribute
+func validSessionID(id string) bool {
+	if id == "" || len(id) > maxSessionIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
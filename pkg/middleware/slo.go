@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Objective is the availability and latency objective of one route
+type Objective struct {
+	Method string `yaml:"method"`
+	Route  string `yaml:"route"`
+	// Availability is the target ratio of requests not answered with a 5xx,
+	// e.g. 0.999. 0 leaves availability out.
+	Availability float64 `yaml:"availability"`
+	// Latency is the threshold a request must be answered within, counted
+	// against LatencyTarget. 0 leaves latency out.
+	Latency       time.Duration `yaml:"latency"`
+	LatencyTarget float64       `yaml:"latency_target"`
+}
+
+// SLOConfig lists the objectives and the windows their burn rates are
+// computed over
+type SLOConfig struct {
+	Windows    []time.Duration `yaml:"windows"`
+	Objectives []Objective     `yaml:"objectives"`
+}
+
+// defaultSLOWindows are the short and long windows of multiwindow burn rate
+// alerts
+var defaultSLOWindows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour}
+
+// maxSLOWindow bounds the windows, one bucket is kept per minute of the longest
+const maxSLOWindow = 7 * 24 * time.Hour
+
+// SLOConfigFromEnv reads the YAML file at SLO_CONFIG, no objectives when unset:
+//
+//	windows: [5m, 1h, 6h]
+//	objectives:
+//	  - method: GET
+//	    route: /api/v1/user/:id
+//	    availability: 0.999
+//	    latency: 300ms
+//	    latency_target: 0.99
+func SLOConfigFromEnv() (SLOConfig, error) {
+	path := os.Getenv("SLO_CONFIG")
+	if path == "" {
+		return SLOConfig{}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return SLOConfig{}, fmt.Errorf("SLO_CONFIG: %w", err)
+	}
+
+	var cfg SLOConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return SLOConfig{}, fmt.Errorf("SLO_CONFIG: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return SLOConfig{}, fmt.Errorf("SLO_CONFIG: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the targets are ratios and the windows can be kept
+func (cfg SLOConfig) Validate() error {
+	for _, w := range cfg.Windows {
+		if w < time.Minute || w > maxSLOWindow {
+			return fmt.Errorf("window %s is out of [1m, %s]", w, maxSLOWindow)
+		}
+	}
+
+	for _, o := range cfg.Objectives {
+		name := o.Method + " " + o.Route
+		switch {
+		case o.Route == "" || o.Method == "":
+			return fmt.Errorf("objective %q: method and route are required", name)
+		case o.Availability < 0 || o.Availability >= 1:
+			return fmt.Errorf("objective %q: availability must be in [0, 1)", name)
+		case o.Latency < 0:
+			return fmt.Errorf("objective %q: latency must be positive", name)
+		case o.Latency > 0 && (o.LatencyTarget <= 0 || o.LatencyTarget >= 1):
+			return fmt.Errorf("objective %q: latency_target must be in (0, 1)", name)
+		case o.Availability == 0 && o.Latency == 0:
+			return fmt.Errorf("objective %q: set availability, latency or both", name)
+		}
+	}
+
+	return nil
+}
+
+// sloBucket counts the requests of one minute
+type sloBucket struct {
+	minute           int64
+	total, bad, slow int64
+}
+
+// objectiveState keeps a ring of per minute buckets of an objective
+type objectiveState struct {
+	Objective
+
+	mu      sync.Mutex
+	buckets []sloBucket
+}
+
+func (s *objectiveState) record(now time.Time, bad, slow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minute := now.Unix() / 60
+	b := &s.buckets[minute%int64(len(s.buckets))]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+
+	b.total++
+	if bad {
+		b.bad++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+// ratios returns the ratio of bad and slow requests over the last window,
+// ok is false when there were none
+func (s *objectiveState) ratios(now time.Time, window time.Duration) (bad, slow float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minute := now.Unix() / 60
+	oldest := minute - int64(window/time.Minute)
+	var total, badCount, slowCount int64
+	for _, b := range s.buckets {
+		if b.minute > oldest && b.minute <= minute {
+			total += b.total
+			badCount += b.bad
+			slowCount += b.slow
+		}
+	}
+	if total == 0 {
+		return 0, 0, false
+	}
+
+	return float64(badCount) / float64(total), float64(slowCount) / float64(total), true
+}
+
+// windowName renders a window the way it's configured, 1h rather than 1h0m0s
+func windowName(w time.Duration) string {
+	if w%time.Hour == 0 {
+		return fmt.Sprintf("%dh", w/time.Hour)
+	}
+
+	return fmt.Sprintf("%dm", w/time.Minute)
+}
+
+// SLO tracks the requests of the routes with an objective and exports their
+// burn rates as slo.burn_rate: the ratio of bad requests over each window
+// divided by the error budget (1 - target), by slo.type (availability or
+// latency) and slo.window. 1 spends the budget exactly over the SLO period.
+// Server spans of requests slower than the latency objective get
+// slo.violated=true. Install it after Server.
+func SLO(cfg SLOConfig) gin.HandlerFunc {
+	if len(cfg.Objectives) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	windows := cfg.Windows
+	if len(windows) == 0 {
+		windows = defaultSLOWindows
+	}
+	longest := windows[0]
+	for _, w := range windows {
+		longest = max(longest, w)
+	}
+
+	objectives := map[string]*objectiveState{}
+	for _, o := range cfg.Objectives {
+		objectives[o.Method+" "+o.Route] = &objectiveState{
+			Objective: o,
+			buckets:   make([]sloBucket, int(longest/time.Minute)+1),
+		}
+	}
+
+	meter := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/middleware")
+	burnRate, _ := meter.Float64ObservableGauge("slo.burn_rate",
+		metric.WithDescription("Rate at which the error budget of the route objective is spent over slo.window, 1 spends it exactly"),
+		metric.WithUnit("1"),
+	)
+	meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		now := time.Now()
+		for _, s := range objectives {
+			for _, w := range windows {
+				bad, slow, ok := s.ratios(now, w)
+				if !ok {
+					continue
+				}
+
+				attrs := []attribute.KeyValue{
+					attribute.String("http.request.method", s.Method),
+					attribute.String("http.route", s.Route),
+					attribute.String("slo.window", windowName(w)),
+				}
+				if s.Availability > 0 {
+					o.ObserveFloat64(burnRate, bad/(1-s.Availability), metric.WithAttributes(append(attrs, attribute.String("slo.type", "availability"))...))
+				}
+				if s.Latency > 0 {
+					o.ObserveFloat64(burnRate, slow/(1-s.LatencyTarget), metric.WithAttributes(append(attrs, attribute.String("slo.type", "latency"))...))
+				}
+			}
+		}
+		return nil
+	}, burnRate)
+
+	return func(c *gin.Context) {
+		s, ok := objectives[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		duration := time.Since(start)
+
+		slow := s.Latency > 0 && duration > s.Latency
+		if slow {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(
+				attribute.Bool("slo.violated", true),
+				attribute.Float64("slo.latency.threshold", s.Latency.Seconds()),
+			)
+		}
+
+		s.record(start, c.Writer.Status() >= http.StatusInternalServerError, slow)
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// APIVersionConfig describes a version of the API and its lifecycle
+type APIVersionConfig struct {
+	// Version is recorded as api.version, e.g. "v1"
+	Version string
+	// Deprecation, when set, is announced with the Deprecation header (RFC 9745)
+	Deprecation time.Time
+	// Sunset, when set, is announced with the Sunset header (RFC 8594)
+	Sunset time.Time
+	// Successor is the path of the version replacing this one, sent as a Link
+	Successor string
+}
+
+// APIVersionConfigFromEnv reads <prefix>_DEPRECATION and <prefix>_SUNSET as
+// dates (2006-01-02) or RFC 3339 times, falling back to fallback
+func APIVersionConfigFromEnv(prefix string, fallback APIVersionConfig) APIVersionConfig {
+	cfg := fallback
+
+	if t, ok := parseDate(os.Getenv(prefix + "_DEPRECATION")); ok {
+		cfg.Deprecation = t
+	}
+
+	if t, ok := parseDate(os.Getenv(prefix + "_SUNSET")); ok {
+		cfg.Sunset = t
+	}
+
+	return cfg
+}
+
+func parseDate(v string) (time.Time, bool) {
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// APIVersion tags the requests with the API version they use and counts them,
+// so the traffic still on a deprecated version is known before removing it
+func APIVersion(cfg APIVersionConfig) gin.HandlerFunc {
+	requests, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/middleware").Int64Counter(
+		"http.server.api_version.requests",
+		metric.WithDescription("Number of HTTP server requests by API version"),
+		metric.WithUnit("{request}"),
+	)
+
+	deprecated := !cfg.Deprecation.IsZero()
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("api.version", cfg.Version),
+			attribute.Bool("api.deprecated", deprecated),
+		)
+		requests.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("api.version", cfg.Version),
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+		))
+
+		if deprecated {
+			c.Header("Deprecation", "@"+strconv.FormatInt(cfg.Deprecation.Unix(), 10))
+		}
+		if !cfg.Sunset.IsZero() {
+			c.Header("Sunset", cfg.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if cfg.Successor != "" {
+			c.Header("Link", "<"+cfg.Successor+`>; rel="successor-version"`)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,126 @@
+// Package migrate runs versioned data migrations against MongoDB. Applied
+// versions are kept in the migrations collection, so each migration runs once,
+// and every run is traced: a "migrate" span with one child per migration.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Collection tracks the applied migrations, one document per version
+const Collection = "migrations"
+
+// scope is the instrumentation scope of the migration spans
+var scope = tel.NewScope("app/migrate")
+
+// Migration is a single change to the data, identified by its version
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// applied is the document stored for each applied migration
+type applied struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+	Duration  float64   `bson:"duration_seconds"`
+}
+
+// Latest returns the highest version of migrations, which is the schema
+// version of the data once they have all run
+func Latest(migrations []Migration) int {
+	latest := 0
+	for _, m := range migrations {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+
+	return latest
+}
+
+// Current returns the highest version applied to db, 0 when none is
+func Current(ctx context.Context, db *mongo.Database) (int, error) {
+	var last applied
+	err := db.Collection(Collection).FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"_id": -1})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+
+	return last.Version, err
+}
+
+// Run applies the migrations that haven't run on db yet, in version order,
+// and returns how many were applied. It stops at the first failure.
+func Run(ctx context.Context, db *mongo.Database, migrations []Migration) (int, error) {
+	pending := append([]Migration(nil), migrations...)
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+
+	count := 0
+	err := scope.Time(ctx, "migrate", func(ctx context.Context) error {
+		span := trace.SpanFromContext(ctx)
+
+		current, err := Current(ctx, db)
+		if err != nil {
+			return fmt.Errorf("reading the applied migrations: %w", err)
+		}
+		span.SetAttributes(
+			attribute.Int("db.migration.from_version", current),
+			attribute.Int("db.migration.target_version", Latest(migrations)),
+		)
+
+		for _, m := range pending {
+			if m.Version <= current {
+				continue
+			}
+			if err := apply(ctx, db, m); err != nil {
+				return err
+			}
+			count++
+		}
+
+		span.SetAttributes(attribute.Int("db.migration.applied_count", count))
+		return nil
+	})
+
+	return count, err
+}
+
+// apply runs m in its own span and records it as applied
+func apply(ctx context.Context, db *mongo.Database, m Migration) error {
+	return scope.Time(ctx, "migrate "+m.Name, func(ctx context.Context) error {
+		start := time.Now()
+		if err := m.Up(ctx, db); err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		_, err := db.Collection(Collection).InsertOne(ctx, applied{
+			Version:   m.Version,
+			Name:      m.Name,
+			AppliedAt: time.Now(),
+			Duration:  time.Since(start).Seconds(),
+		})
+		if err != nil {
+			return fmt.Errorf("recording migration %d %s: %w", m.Version, m.Name, err)
+		}
+
+		logging.FromContext(ctx).Info("Applied migration", "version", m.Version, "name", m.Name)
+		return nil
+	}, trace.WithAttributes(
+		attribute.Int("db.migration.version", m.Version),
+		attribute.String("db.migration.name", m.Name),
+	))
+}
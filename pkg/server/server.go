@@ -0,0 +1,193 @@
+// Package server runs the routers of the services over HTTP/1.1 or HTTP/2,
+// with TLS or in cleartext (h2c).
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Config selects how a router is served
+type Config struct {
+	Addr string
+
+	// H2C accepts HTTP/2 without TLS, e.g. behind a proxy terminating TLS
+	H2C bool
+
+	// CertFile and KeyFile serve HTTPS, where HTTP/2 is negotiated with ALPN
+	CertFile string
+	KeyFile  string
+
+	// AutocertDomains gets certificates for these domains from Let's Encrypt
+	// instead, cached in AutocertCacheDir
+	AutocertDomains  []string
+	AutocertCacheDir string
+
+	// RedirectAddr, when serving HTTPS, listens for plain HTTP and redirects
+	// it to HTTPS. With autocert it also answers the ACME challenges.
+	RedirectAddr string
+
+	// prefix is the one given to ConfigFromEnv, to name the variables in errors
+	prefix string
+}
+
+// ConfigFromEnv reads <prefix>_ADDR (defaulting to addr), <prefix>_H2C,
+// <prefix>_TLS_CERT, <prefix>_TLS_KEY, <prefix>_AUTOCERT_DOMAINS,
+// <prefix>_AUTOCERT_CACHE_DIR (default "certs") and <prefix>_HTTP_REDIRECT_ADDR
+func ConfigFromEnv(prefix, addr string) Config {
+	cfg := Config{
+		Addr:             os.Getenv(prefix + "_ADDR"),
+		CertFile:         os.Getenv(prefix + "_TLS_CERT"),
+		KeyFile:          os.Getenv(prefix + "_TLS_KEY"),
+		AutocertCacheDir: os.Getenv(prefix + "_AUTOCERT_CACHE_DIR"),
+		RedirectAddr:     os.Getenv(prefix + "_HTTP_REDIRECT_ADDR"),
+		prefix:           prefix,
+	}
+
+	if cfg.Addr == "" {
+		cfg.Addr = addr
+	}
+
+	if cfg.AutocertCacheDir == "" {
+		cfg.AutocertCacheDir = "certs"
+	}
+
+	for _, domain := range strings.Split(os.Getenv(prefix+"_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cfg.AutocertDomains = append(cfg.AutocertDomains, domain)
+		}
+	}
+
+	cfg.H2C, _ = strconv.ParseBool(os.Getenv(prefix + "_H2C"))
+
+	return cfg
+}
+
+// TLS reports whether cfg serves HTTPS
+func (cfg Config) TLS() bool {
+	return cfg.CertFile != "" || len(cfg.AutocertDomains) > 0
+}
+
+// Run serves router until the server fails
+func Run(router *gin.Engine, cfg Config) error {
+	return RunHandler(router, cfg)
+}
+
+// RunHandler serves any http.Handler like Run, e.g. a plain http.ServeMux
+func RunHandler(handler http.Handler, cfg Config) error {
+	return New(handler, cfg).Serve()
+}
+
+// Server serves a handler until it fails or is shut down
+type Server struct {
+	srv      *http.Server
+	redirect *http.Server
+	cfg      Config
+}
+
+// New prepares the server of handler, Serve starts it
+func New(handler http.Handler, cfg Config) *Server {
+	if cfg.H2C && !cfg.TLS() {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	s := &Server{
+		srv: &http.Server{
+			Addr:    cfg.Addr,
+			Handler: handler,
+		},
+		cfg: cfg,
+	}
+
+	if !cfg.TLS() {
+		return s
+	}
+
+	// The redirect handler, or nil to not listen for plain HTTP
+	var redirect http.Handler
+	if cfg.RedirectAddr != "" {
+		redirect = redirectHandler(cfg.Addr)
+	}
+
+	if len(cfg.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		s.srv.TLSConfig = manager.TLSConfig()
+		if redirect != nil {
+			redirect = manager.HTTPHandler(redirect)
+		}
+	} else {
+		s.srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if redirect != nil {
+		s.redirect = &http.Server{Addr: cfg.RedirectAddr, Handler: redirect}
+	}
+
+	return s
+}
+
+// Serve blocks until the server fails, or returns nil once Shutdown is called
+func (s *Server) Serve() error {
+	var err error
+	if !s.cfg.TLS() {
+		err = s.srv.ListenAndServe()
+	} else {
+		if s.redirect != nil {
+			go func() {
+				if err := s.redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logging.Default().Error("Error serving HTTP redirects", "error", err)
+				}
+			}()
+		}
+		err = s.srv.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the requests in flight
+// to finish, or for ctx to be done
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.redirect != nil {
+		err = s.redirect.Shutdown(ctx)
+	}
+
+	return errors.Join(s.srv.Shutdown(ctx), err)
+}
+
+// redirectHandler sends clients to the same URL over HTTPS on the port of addr
+func redirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
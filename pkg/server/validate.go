@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Validate checks cfg before serving and returns every problem found at once
+func (cfg Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if err := validateAddr(cfg.Addr); err != nil {
+		add("invalid listen address %q (%s): %s", cfg.Addr, cfg.env("ADDR"), err)
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		add("%s and %s must be set together", cfg.env("TLS_CERT"), cfg.env("TLS_KEY"))
+	}
+	for _, f := range []struct{ path, name string }{{cfg.CertFile, "TLS_CERT"}, {cfg.KeyFile, "TLS_KEY"}} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			add("can't read %s: %s", cfg.env(f.name), err)
+		}
+	}
+
+	if cfg.CertFile != "" && len(cfg.AutocertDomains) > 0 {
+		add("set either %s or %s, not both", cfg.env("TLS_CERT"), cfg.env("AUTOCERT_DOMAINS"))
+	}
+
+	if cfg.H2C && cfg.TLS() {
+		add("%s is for cleartext HTTP/2, over TLS it's negotiated already: unset it", cfg.env("H2C"))
+	}
+
+	if cfg.RedirectAddr != "" {
+		if !cfg.TLS() {
+			add("%s redirects to HTTPS but TLS isn't configured (%s or %s)", cfg.env("HTTP_REDIRECT_ADDR"), cfg.env("TLS_CERT"), cfg.env("AUTOCERT_DOMAINS"))
+		}
+		if err := validateAddr(cfg.RedirectAddr); err != nil {
+			add("invalid redirect address %q (%s): %s", cfg.RedirectAddr, cfg.env("HTTP_REDIRECT_ADDR"), err)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid server config:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+// env names the variable setting a field, or the field itself when cfg
+// didn't come from ConfigFromEnv
+func (cfg Config) env(suffix string) string {
+	if cfg.prefix == "" {
+		return suffix
+	}
+
+	return cfg.prefix + "_" + suffix
+}
+
+// validateAddr checks addr is [host]:port
+func validateAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("expected [host]:port, e.g. :8080")
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("port %q isn't a number between 0 and 65535", port)
+	}
+
+	return nil
+}
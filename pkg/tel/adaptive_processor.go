@@ -0,0 +1,235 @@
+package tel
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Bounds of the adaptive processor's decisions
+const (
+	adaptiveMinBatch    = 64
+	adaptiveMaxBatch    = sdktrace.DefaultMaxExportBatchSize
+	adaptiveMinInterval = 200 * time.Millisecond
+	adaptiveMaxInterval = 5 * time.Second
+	adaptiveExportLimit = 30 * time.Second
+
+	// latencyWeight is the weight of the last export in the latency average
+	latencyWeight = 0.3
+)
+
+// adaptiveSpanProcessor batches spans like the SDK batch processor, but
+// re-tunes its batch size and flush interval after every flush: batches hold
+// about a second of spans, the interval shrinks as the rate grows so spans
+// don't wait long to be exported, and it never drops under twice the export
+// latency so a slow backend doesn't get overlapping exports.
+type adaptiveSpanProcessor struct {
+	exporter sdktrace.SpanExporter
+	queue    chan sdktrace.ReadOnlySpan
+
+	// batchSize, interval (ns) and rate (spans per second) are the current
+	// decisions, read by the metrics callback
+	batchSize atomic.Int64
+	interval  atomic.Int64
+	rate      atomic.Uint64
+
+	// latency is the moving average of the export duration, only used by the worker
+	latency time.Duration
+
+	// metrics is the callback of the gauges, unregistered on shutdown so a
+	// reload doesn't leave the replaced processor observed
+	metrics metric.Registration
+
+	flush    chan chan error
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newAdaptiveSpanProcessor(exporter sdktrace.SpanExporter) *adaptiveSpanProcessor {
+	p := &adaptiveSpanProcessor{
+		exporter: exporter,
+		queue:    make(chan sdktrace.ReadOnlySpan, sdktrace.DefaultMaxQueueSize),
+		flush:    make(chan chan error),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	p.batchSize.Store(adaptiveMaxBatch)
+	p.interval.Store(int64(adaptiveMaxInterval))
+
+	meter := otel.Meter(instrumentationName)
+	batchSize, _ := meter.Int64ObservableGauge("otel.sdk.processor.span.batch.size",
+		metric.WithDescription("Batch size currently chosen by the adaptive span processor"),
+		metric.WithUnit("{span}"),
+	)
+	interval, _ := meter.Float64ObservableGauge("otel.sdk.processor.span.flush.interval",
+		metric.WithDescription("Flush interval currently chosen by the adaptive span processor"),
+		metric.WithUnit("s"),
+	)
+	rate, _ := meter.Float64ObservableGauge("otel.sdk.processor.span.rate",
+		metric.WithDescription("Rate of spans produced, as measured by the adaptive span processor"),
+		metric.WithUnit("{span}/s"),
+	)
+	p.metrics, _ = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(batchSize, p.batchSize.Load())
+		o.ObserveFloat64(interval, time.Duration(p.interval.Load()).Seconds())
+		o.ObserveFloat64(rate, math.Float64frombits(p.rate.Load()))
+		return nil
+	}, batchSize, interval, rate)
+
+	go p.run()
+
+	return p
+}
+
+func (p *adaptiveSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd queues the span, dropping it when the queue is full like the SDK does
+func (p *adaptiveSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+
+	select {
+	case p.queue <- s:
+	default:
+	}
+}
+
+func (p *adaptiveSpanProcessor) ForceFlush(ctx context.Context) error {
+	result := make(chan error, 1)
+
+	select {
+	case p.flush <- result:
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *adaptiveSpanProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		if p.metrics != nil {
+			p.metrics.Unregister()
+		}
+	})
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return p.exporter.Shutdown(ctx)
+}
+
+// run is the worker exporting the batches
+func (p *adaptiveSpanProcessor) run() {
+	defer close(p.done)
+
+	batch := make([]sdktrace.ReadOnlySpan, 0, adaptiveMaxBatch)
+	produced := 0
+	lastTune := time.Now()
+
+	timer := time.NewTimer(time.Duration(p.interval.Load()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			produced++
+			if int64(len(batch)) >= p.batchSize.Load() {
+				p.export(&batch)
+			}
+
+		case <-timer.C:
+			p.export(&batch)
+			p.tune(produced, time.Since(lastTune))
+			produced, lastTune = 0, time.Now()
+			timer.Reset(time.Duration(p.interval.Load()))
+
+		case result := <-p.flush:
+			produced += p.drain(&batch)
+			result <- p.export(&batch)
+
+		case <-p.stop:
+			p.drain(&batch)
+			p.export(&batch)
+			return
+		}
+	}
+}
+
+// drain moves the queued spans into the batch, exporting full batches
+func (p *adaptiveSpanProcessor) drain(batch *[]sdktrace.ReadOnlySpan) int {
+	n := 0
+	for {
+		select {
+		case s := <-p.queue:
+			*batch = append(*batch, s)
+			n++
+			if len(*batch) >= adaptiveMaxBatch {
+				p.export(batch)
+			}
+		default:
+			return n
+		}
+	}
+}
+
+func (p *adaptiveSpanProcessor) export(batch *[]sdktrace.ReadOnlySpan) error {
+	if len(*batch) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adaptiveExportLimit)
+	defer cancel()
+
+	start := time.Now()
+	err := p.exporter.ExportSpans(ctx, *batch)
+	elapsed := time.Since(start)
+
+	if p.latency == 0 {
+		p.latency = elapsed
+	} else {
+		p.latency = time.Duration(latencyWeight*float64(elapsed) + (1-latencyWeight)*float64(p.latency))
+	}
+
+	*batch = (*batch)[:0]
+
+	return err
+}
+
+// tune picks the batch size and interval for the production rate measured
+// over the last period
+func (p *adaptiveSpanProcessor) tune(produced int, period time.Duration) {
+	rate := float64(produced) / period.Seconds()
+	p.rate.Store(math.Float64bits(rate))
+
+	batchSize := int64(math.Min(math.Max(rate, adaptiveMinBatch), adaptiveMaxBatch))
+
+	interval := adaptiveMaxInterval
+	if rate > 0 {
+		interval = time.Duration(float64(batchSize) / rate * float64(time.Second))
+	}
+	interval = max(min(interval, adaptiveMaxInterval), adaptiveMinInterval, 2*p.latency)
+
+	p.batchSize.Store(batchSize)
+	p.interval.Store(int64(interval))
+}
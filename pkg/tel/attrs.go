@@ -0,0 +1,99 @@
+package tel
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanAttributes collects attributes for a span from any number of goroutines,
+// and sets them on the span when it ends. Layers below a handler should add to
+// it rather than mutate the span they were handed: the span may be ended by
+// the time an async task finishes, and attributes set from several goroutines
+// land in no particular order. Within an accumulator the last value added for
+// a key wins.
+type SpanAttributes struct {
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+	ended bool
+	span  trace.Span
+
+	// direct sets the attributes on the span as they're added, for spans not
+	// started by the helpers
+	direct bool
+}
+
+type spanAttributesKey struct{}
+
+// Attrs returns the accumulator of the span in ctx. Spans started by the
+// Scope helpers have one; for others the attributes are set on the span
+// right away.
+func Attrs(ctx context.Context) *SpanAttributes {
+	span := trace.SpanFromContext(ctx)
+
+	// a span started since, e.g. by otelhttp, doesn't get its parent's accumulator
+	if a, ok := ctx.Value(spanAttributesKey{}).(*SpanAttributes); ok && a.span.SpanContext().Equal(span.SpanContext()) {
+		return a
+	}
+
+	return &SpanAttributes{span: span, direct: true}
+}
+
+// Add records kvs, to be set on the span when it ends. Attributes added after
+// that are dropped, like the span itself would.
+func (a *SpanAttributes) Add(kvs ...attribute.KeyValue) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.direct:
+		// the span does its own locking
+		a.span.SetAttributes(kvs...)
+	case !a.ended:
+		a.attrs = append(a.attrs, kvs...)
+	}
+}
+
+// flush sets the collected attributes on the span, once
+func (a *SpanAttributes) flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ended {
+		return
+	}
+	a.ended = true
+
+	if len(a.attrs) > 0 {
+		a.span.SetAttributes(a.attrs...)
+	}
+	a.attrs = nil
+}
+
+// accumulatingSpan flushes its attributes before ending
+type accumulatingSpan struct {
+	trace.Span
+	attrs *SpanAttributes
+}
+
+func (s accumulatingSpan) End(opts ...trace.SpanEndOption) {
+	s.attrs.flush()
+	s.Span.End(opts...)
+}
+
+// withAttrs gives span an accumulator, reachable from the returned context
+func withAttrs(ctx context.Context, span trace.Span) (context.Context, trace.Span) {
+	if !span.IsRecording() {
+		return ctx, span
+	}
+
+	attrs := &SpanAttributes{span: span}
+	wrapped := accumulatingSpan{Span: span, attrs: attrs}
+
+	ctx = trace.ContextWithSpan(ctx, wrapped)
+	ctx = context.WithValue(ctx, spanAttributesKey{}, attrs)
+
+	return ctx, wrapped
+}
@@ -0,0 +1,140 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/automaxprocs/maxprocs"
+)
+
+// maxProcsOnce applies automaxprocs a single time, the first signal set up does it
+var maxProcsOnce sync.Once
+
+// setMaxProcs sizes GOMAXPROCS to the container CPU quota, unless GOMAXPROCS
+// is set in the environment
+func setMaxProcs() {
+	maxProcsOnce.Do(func() {
+		_, err := maxprocs.Set(maxprocs.Logger(func(format string, args ...any) {
+			logging.Default().Info(fmt.Sprintf(format, args...))
+		}))
+		if err != nil {
+			logging.Default().Warn("Can't size GOMAXPROCS to the CPU quota", "error", err)
+		}
+	})
+}
+
+// capacityAttributes describe the resources the process may use, so latencies
+// can be read against the container limits
+func capacityAttributes(cfg Config) []attribute.KeyValue {
+	if cfg.AutoMaxProcs {
+		setMaxProcs()
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.Int("process.runtime.go.gomaxprocs", runtime.GOMAXPROCS(0)),
+		attribute.Int("host.cpu.count", runtime.NumCPU()),
+	}
+
+	if quota, ok := cpuQuota(); ok {
+		attrs = append(attrs, attribute.Float64("container.cpu.limit", quota))
+	}
+
+	if limit, ok := memoryLimit(); ok {
+		attrs = append(attrs, attribute.Int64("container.memory.limit", limit))
+	}
+
+	// math.MaxInt64 means no GOMEMLIMIT
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		attrs = append(attrs, attribute.Int64("process.runtime.go.mem_limit", limit))
+	}
+
+	return attrs
+}
+
+// registerCapacityGauges reports GOMAXPROCS and the CPU quota as gauges, they
+// may change at runtime
+func registerCapacityGauges() {
+	meter := otel.Meter(instrumentationName)
+
+	maxProcs, _ := meter.Int64ObservableGauge("process.runtime.go.gomaxprocs",
+		metric.WithDescription("Value of GOMAXPROCS"),
+		metric.WithUnit("{thread}"),
+	)
+	cpuLimit, _ := meter.Float64ObservableGauge("container.cpu.limit",
+		metric.WithDescription("CPU quota of the container, in cores"),
+		metric.WithUnit("{cpu}"),
+	)
+	meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(maxProcs, int64(runtime.GOMAXPROCS(0)))
+		if quota, ok := cpuQuota(); ok {
+			o.ObserveFloat64(cpuLimit, quota)
+		}
+		return nil
+	}, maxProcs, cpuLimit)
+}
+
+// cpuQuota returns the CPU cores allowed by the cgroup, from cpu.max on cgroup
+// v2 or cpu.cfs_quota_us and cpu.cfs_period_us on v1
+func cpuQuota() (float64, bool) {
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		quota, period, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+		return ratio(quota, period)
+	}
+
+	quota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+
+	return ratio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func ratio(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		// "max" or -1 means no quota
+		return 0, false
+	}
+
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return q / p, true
+}
+
+// memoryLimit returns the memory limit of the cgroup in bytes
+func memoryLimit() (int64, bool) {
+	for _, path := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		// v1 reports a huge number rather than "max" when there's no limit
+		if err != nil || limit <= 0 || limit >= math.MaxInt64/2 {
+			return 0, false
+		}
+
+		return limit, true
+	}
+
+	return 0, false
+}
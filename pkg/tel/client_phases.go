@@ -0,0 +1,80 @@
+package tel
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clientPhases times the phases of an outbound request from the httptrace
+// hooks, which the transport may call from its dialing goroutines
+type clientPhases struct {
+	span  trace.Span
+	start time.Time
+
+	mu                               sync.Mutex
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+// withClientPhases returns the hooks recording, on span, an event as each
+// phase ends and its duration in seconds as an attribute:
+// http.client.dns.duration, http.client.connect.duration,
+// http.client.tls.duration and http.client.time_to_first_byte, counted from
+// when the request was handed to the transport. Reused connections only get
+// the last one, and http.client.connection.reused=true.
+func withClientPhases(span trace.Span) *httptrace.ClientTrace {
+	p := &clientPhases{span: span, start: time.Now()}
+
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.SetAttributes(attribute.Bool("http.client.connection.reused", info.Reused))
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.done("dns", "http.client.dns.duration", &p.dnsStart, info.Err)
+		},
+		ConnectStart: func(_, _ string) { p.mark(&p.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			p.done("connect", "http.client.connect.duration", &p.connectStart, err)
+		},
+		TLSHandshakeStart: func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.done("tls", "http.client.tls.duration", &p.tlsStart, err)
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("http.client.first_byte")
+			span.SetAttributes(attribute.Float64("http.client.time_to_first_byte", time.Since(p.start).Seconds()))
+		},
+	}
+}
+
+func (p *clientPhases) mark(start *time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// with several addresses the first attempt counts, the phase spans them all
+	if start.IsZero() {
+		*start = time.Now()
+	}
+}
+
+func (p *clientPhases) done(phase, key string, start *time.Time, err error) {
+	p.mu.Lock()
+	began := *start
+	p.mu.Unlock()
+	if began.IsZero() {
+		return
+	}
+
+	var event []attribute.KeyValue
+	if err != nil {
+		event = append(event, attribute.String("error.message", err.Error()))
+	}
+
+	p.span.AddEvent("http.client."+phase+".done", trace.WithAttributes(event...))
+	p.span.SetAttributes(attribute.Float64(key, time.Since(began).Seconds()))
+}
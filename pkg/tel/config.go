@@ -0,0 +1,338 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Config selects how telemetry is propagated and exported
+type Config struct {
+	// ServiceName is reported as service.name on every span
+	ServiceName string
+
+	// ServiceInstanceID is reported as service.instance.id, to tell the
+	// instances of a service apart. When empty it's read from
+	// ServiceInstanceIDFile, or derived from the hostname without one.
+	ServiceInstanceID     string
+	ServiceInstanceIDFile string
+
+	// Environment is reported as deployment.environment.name, e.g. blue or green
+	Environment string
+
+	// Exporter is where spans are sent: "otlp" (default), "xray" or "cloudtrace"
+	Exporter string
+
+	// Propagators lists the propagators to install, using the names from
+	// OTEL_PROPAGATORS: tracecontext, baggage, b3, b3multi, xray and cloudtrace
+	Propagators []string
+
+	// Protocol is the OTLP transport: "http/protobuf" (default), "http/json"
+	// or "grpc". Only the traces use JSON, metrics and logs stay on protobuf.
+	Protocol string
+
+	// Endpoint is the host:port of the OTLP/HTTP receiver. Metrics and logs
+	// always go there, and the traces unless Protocol is grpc.
+	Endpoint string
+
+	// GRPCEndpoint is the host:port of the OTLP/gRPC receiver the traces go
+	// to when Protocol is grpc
+	GRPCEndpoint string
+
+	// UnixSocket, when set, is the path of a unix domain socket the collector
+	// listens on, e.g. in a sidecar. It requires the grpc protocol.
+	UnixSocket string
+
+	// ProxyURL sends the OTLP/HTTP exports through an HTTP proxy. When empty the
+	// usual HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables apply.
+	ProxyURL string
+
+	// TLS makes the OTLP exports over https and gRPC with TLS, checking the
+	// receiver's certificate against the system roots. It's off unless
+	// OTEL_EXPORTER_OTLP_INSECURE=false, and required by OAuth2.
+	TLS bool
+
+	// OAuth2 authenticates the OTLP exports with a bearer token fetched with
+	// the client credentials flow instead of the static credentials
+	OAuth2 OAuth2Config
+
+	// Dialer replaces the dialer used to reach the collector over grpc, e.g. to
+	// go through a custom tunnel. It can only be set from code.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+
+	// SpanAttributes, MetricAttributes and LogAttributes drop attribute keys
+	// from each signal before export
+	SpanAttributes   AttributeFilter
+	MetricAttributes AttributeFilter
+	LogAttributes    AttributeFilter
+
+	// SpanRedaction masks PII found in span attributes before export
+	SpanRedaction Redaction
+
+	// RetentionHints marks the root spans of failed and slow requests for tail sampling
+	RetentionHints RetentionHints
+
+	// DBSummary adds the count, total duration and collections of the database
+	// calls of a request to its root span (default true)
+	DBSummary bool
+
+	// CodeAttributes adds code.function.name, code.file.path and
+	// code.line.number to the INTERNAL spans, from where they were started.
+	// It costs a stack lookup per span, so it's off unless
+	// OTEL_SPAN_CODE_ATTRIBUTES is set.
+	CodeAttributes bool
+
+	// Sampler is "always_on" (default), "always_off", "consistent_probability"
+	// or "parentbased_consistent_probability"
+	Sampler string
+
+	// SamplerRatio is the probability used by the consistent probability samplers
+	SamplerRatio float64
+
+	// TraceSampler, set from code or by the config file, replaces Sampler,
+	// e.g. with a NewRuleBasedSampler sampling each route differently
+	TraceSampler sdktrace.Sampler
+
+	// Disabled makes Init install no-op providers: the instrumentation keeps
+	// working but records nothing and never reaches the network. It's set by
+	// OTEL_SDK_DISABLED=true, TELEMETRY_ENABLED=false or disabled in the
+	// config file.
+	Disabled bool
+
+	// ConfigFile is the OpenTelemetry declarative config file applied on top
+	// of the environment, OTEL_EXPERIMENTAL_CONFIG_FILE
+	ConfigFile string
+
+	// SpanProcessor is "batch" (default), the SDK batch processor, "simple",
+	// exporting every span as it ends, or "adaptive", which tunes its batch
+	// size and interval to the span rate
+	SpanProcessor string
+
+	// Batch tunes the batch processor, the SDK defaults apply to the zero fields
+	Batch BatchConfig
+
+	// SpanLimits caps the attributes, events and links kept per span, and
+	// the length of the attribute values. What goes over is dropped and
+	// counted in otel.sdk.span.limit.dropped. A negative limit means none.
+	SpanLimits sdktrace.SpanLimits
+
+	// MetricTemporality is the temporality preference: "cumulative" (default),
+	// "delta" or "lowmemory". MetricTemporalityByKind overrides it per
+	// instrument kind (counter, updowncounter, histogram, gauge,
+	// observable_counter, observable_updowncounter, observable_gauge).
+	MetricTemporality       string
+	MetricTemporalityByKind map[string]string
+
+	// HistogramAggregation is the default aggregation of the histograms and
+	// MetricAggregationByKind the aggregation of some instrument kinds: default,
+	// drop, sum, last_value, explicit_bucket_histogram or
+	// base2_exponential_bucket_histogram
+	HistogramAggregation    string
+	MetricAggregationByKind map[string]string
+
+	// Heartbeat is how often Init emits a heartbeat trace and metric, showing
+	// the pipeline works even without traffic. 0 (default) turns it off.
+	Heartbeat time.Duration
+
+	// AttributeProfile is how many of the optional semantic convention
+	// attributes are recorded: "minimal", "recommended" (default) or "full",
+	// see pkg/conventions
+	AttributeProfile string
+
+	// AutoMaxProcs sizes GOMAXPROCS to the container CPU quota (default true)
+	AutoMaxProcs bool
+
+	// ResourceAttributes are added to the resource of every signal
+	ResourceAttributes []attribute.KeyValue
+
+	// StaticAttributes, e.g. team, cost_center or region, are added to every
+	// metric data point, and to every server span by the enricher of
+	// middleware.StaticAttributes. OTEL_STATIC_ATTRIBUTES sets them as
+	// key=value pairs separated by commas.
+	StaticAttributes []attribute.KeyValue
+
+	// GCPProjectID is the project spans are written to by the cloudtrace exporter
+	GCPProjectID string
+
+	// envProblems are the variables ConfigFromEnv couldn't parse, reported by Validate
+	envProblems []string
+}
+
+// BatchConfig holds the settings of the batch span processor
+type BatchConfig struct {
+	ScheduleDelay      time.Duration
+	ExportTimeout      time.Duration
+	MaxQueueSize       int
+	MaxExportBatchSize int
+}
+
+// ConfigFromEnv builds the config for serviceName from the environment
+func ConfigFromEnv(serviceName string) Config {
+	cfg := Config{
+		ServiceName:   serviceName,
+		Environment:   os.Getenv("OTEL_DEPLOYMENT_ENVIRONMENT"),
+		Exporter:      os.Getenv("OTEL_TRACES_EXPORTER"),
+		Protocol:      os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"),
+		Endpoint:      os.Getenv("OTEL_OTLP_HTTP_ENDPOINT"),
+		GRPCEndpoint:  os.Getenv("OTEL_OTLP_GRPC_ENDPOINT"),
+		UnixSocket:    os.Getenv("OTEL_EXPORTER_OTLP_UNIX_SOCKET"),
+		ProxyURL:      os.Getenv("OTEL_EXPORTER_OTLP_PROXY"),
+		OAuth2:        oauth2FromEnv(),
+		GCPProjectID:  os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		Sampler:       os.Getenv("OTEL_TRACES_SAMPLER"),
+		SpanProcessor: os.Getenv("OTEL_SPAN_PROCESSOR"),
+		SamplerRatio:  1,
+		AutoMaxProcs:  true,
+
+		SpanAttributes:   attributeFilterFromEnv("SPAN"),
+		MetricAttributes: attributeFilterFromEnv("METRIC"),
+		LogAttributes:    attributeFilterFromEnv("LOG"),
+
+		MetricTemporality:       os.Getenv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"),
+		MetricTemporalityByKind: parseKindSettings(os.Getenv("OTEL_METRICS_TEMPORALITY")),
+		HistogramAggregation:    os.Getenv("OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION"),
+		MetricAggregationByKind: parseKindSettings(os.Getenv("OTEL_METRICS_AGGREGATION")),
+
+		SpanRedaction: Redaction{Exempt: splitList(os.Getenv("OTEL_SPAN_REDACT_EXEMPT"))},
+
+		AttributeProfile: os.Getenv("OTEL_SEMCONV_ATTRIBUTE_PROFILE"),
+	}
+
+	cfg.SpanRedaction.Enabled = cfg.boolFromEnv("OTEL_SPAN_REDACT_PII", false)
+	cfg.TLS = !cfg.boolFromEnv("OTEL_EXPORTER_OTLP_INSECURE", true)
+
+	cfg.RetentionHints = RetentionHints{
+		Enabled:          cfg.boolFromEnv("OTEL_SPAN_RETENTION_HINTS", true),
+		LatencyThreshold: cfg.durationFromEnv("OTEL_SPAN_RETENTION_LATENCY", time.Second),
+	}
+
+	cfg.Heartbeat = cfg.durationFromEnv("OTEL_HEARTBEAT_INTERVAL", 0)
+	cfg.ServiceInstanceID = os.Getenv("OTEL_SERVICE_INSTANCE_ID")
+	cfg.ServiceInstanceIDFile = os.Getenv("OTEL_SERVICE_INSTANCE_ID_FILE")
+	cfg.DBSummary = cfg.boolFromEnv("OTEL_SPAN_DB_SUMMARY", true)
+	cfg.CodeAttributes = cfg.boolFromEnv("OTEL_SPAN_CODE_ATTRIBUTES", false)
+	cfg.StaticAttributes = cfg.staticAttributesFromEnv("OTEL_STATIC_ATTRIBUTES")
+
+	if cfg.Environment == "" {
+		cfg.Environment = "test"
+	}
+
+	if cfg.Exporter == "" {
+		cfg.Exporter = "otlp"
+	}
+
+	if cfg.Protocol == "" {
+		cfg.Protocol = "http/protobuf"
+	}
+
+	if cfg.GRPCEndpoint == "" {
+		cfg.GRPCEndpoint = "127.0.0.1:5081"
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "localhost:5080" //without trailing slash
+	}
+
+	cfg.Propagators = splitList(os.Getenv("OTEL_PROPAGATORS"))
+
+	cfg.AutoMaxProcs = cfg.boolFromEnv("AUTOMAXPROCS", cfg.AutoMaxProcs)
+
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		switch {
+		case err != nil:
+			cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("OTEL_TRACES_SAMPLER_ARG=%q isn't a number", v))
+		case ratio < 0 || ratio > 1:
+			cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("OTEL_TRACES_SAMPLER_ARG=%q must be between 0 and 1", v))
+		default:
+			cfg.SamplerRatio = ratio
+		}
+	}
+
+	// the variables of the spec, with the SDK defaults: 128 attributes, events
+	// and links, and no limit on the values
+	defaults := sdktrace.NewSpanLimits()
+	cfg.SpanLimits = sdktrace.SpanLimits{
+		AttributeValueLengthLimit:   cfg.intFromEnv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", defaults.AttributeValueLengthLimit),
+		AttributeCountLimit:         cfg.intFromEnv("OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", defaults.AttributeCountLimit),
+		EventCountLimit:             cfg.intFromEnv("OTEL_SPAN_EVENT_COUNT_LIMIT", defaults.EventCountLimit),
+		LinkCountLimit:              cfg.intFromEnv("OTEL_SPAN_LINK_COUNT_LIMIT", defaults.LinkCountLimit),
+		AttributePerEventCountLimit: cfg.intFromEnv("OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT", defaults.AttributePerEventCountLimit),
+		AttributePerLinkCountLimit:  cfg.intFromEnv("OTEL_LINK_ATTRIBUTE_COUNT_LIMIT", defaults.AttributePerLinkCountLimit),
+	}
+
+	cfg.Disabled = cfg.boolFromEnv("OTEL_SDK_DISABLED", false) || !cfg.boolFromEnv("TELEMETRY_ENABLED", true)
+
+	cfg.ConfigFile = os.Getenv("OTEL_EXPERIMENTAL_CONFIG_FILE")
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(&cfg, cfg.ConfigFile); err != nil {
+			cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("config file %s (OTEL_EXPERIMENTAL_CONFIG_FILE): %s", cfg.ConfigFile, err))
+		}
+	}
+
+	return cfg
+}
+
+// boolFromEnv parses the boolean in key, remembering it for Validate when it isn't one
+func (cfg *Config) boolFromEnv(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("%s=%q isn't a boolean, use true or false", key, v))
+		return fallback
+	}
+
+	return b
+}
+
+// spanLimits returns the SDK defaults for a config built without them, where
+// the zero limits would drop every attribute
+func (cfg Config) spanLimits() sdktrace.SpanLimits {
+	if cfg.SpanLimits == (sdktrace.SpanLimits{}) {
+		return sdktrace.NewSpanLimits()
+	}
+
+	return cfg.SpanLimits
+}
+
+// intFromEnv parses the integer in key, remembering it for Validate when it isn't one
+func (cfg *Config) intFromEnv(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("%s=%q isn't an integer", key, v))
+		return fallback
+	}
+
+	return n
+}
+
+// durationFromEnv parses the duration in key, remembering it for Validate when it isn't one
+func (cfg *Config) durationFromEnv(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("%s=%q isn't a duration, e.g. 500ms or 2s", key, v))
+		return fallback
+	}
+
+	return d
+}
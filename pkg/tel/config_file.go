@@ -0,0 +1,220 @@
+package tel
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileFormats are the versions of the OpenTelemetry declarative
+// configuration format understood by applyConfigFile
+var configFileFormats = map[string]bool{"0.1": true, "0.2": true, "0.3": true}
+
+// configFile is the part of the declarative configuration (the otel
+// config.yaml of opentelemetry-configuration) that maps onto Config: the
+// resource, the propagators, and the sampler, limits, processor and exporter
+// of the tracer provider. Unknown keys are ignored like the spec asks.
+type configFile struct {
+	FileFormat string `yaml:"file_format"`
+	Disabled   bool   `yaml:"disabled"`
+
+	Resource struct {
+		Attributes []struct {
+			Name  string `yaml:"name"`
+			Value any    `yaml:"value"`
+		} `yaml:"attributes"`
+	} `yaml:"resource"`
+
+	Propagator struct {
+		Composite []string `yaml:"composite"`
+	} `yaml:"propagator"`
+
+	TracerProvider struct {
+		Processors []map[string]processorModel `yaml:"processors"`
+		Sampler    *samplerModel               `yaml:"sampler"`
+		Limits     struct {
+			AttributeValueLengthLimit *int `yaml:"attribute_value_length_limit"`
+			AttributeCountLimit       *int `yaml:"attribute_count_limit"`
+			EventCountLimit           *int `yaml:"event_count_limit"`
+			LinkCountLimit            *int `yaml:"link_count_limit"`
+			EventAttributeCountLimit  *int `yaml:"event_attribute_count_limit"`
+			LinkAttributeCountLimit   *int `yaml:"link_attribute_count_limit"`
+		} `yaml:"limits"`
+	} `yaml:"tracer_provider"`
+}
+
+type processorModel struct {
+	// milliseconds, like in the spec
+	ScheduleDelay      int `yaml:"schedule_delay"`
+	ExportTimeout      int `yaml:"export_timeout"`
+	MaxQueueSize       int `yaml:"max_queue_size"`
+	MaxExportBatchSize int `yaml:"max_export_batch_size"`
+
+	Exporter struct {
+		OTLP *struct {
+			Protocol string `yaml:"protocol"`
+			Endpoint string `yaml:"endpoint"`
+		} `yaml:"otlp"`
+		Console *struct{} `yaml:"console"`
+	} `yaml:"exporter"`
+}
+
+// envReference is a ${VAR} or ${VAR:-default} substitution of the spec
+var envReference = regexp.MustCompile(`\$\{(?:env:)?([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// applyConfigFile loads the declarative configuration at path on top of cfg,
+// the file wins over the environment variables it overlaps with
+func applyConfigFile(cfg *Config, path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	raw = envReference.ReplaceAllFunc(raw, func(ref []byte) []byte {
+		m := envReference.FindSubmatch(ref)
+		if v, ok := os.LookupEnv(string(m[1])); ok {
+			return []byte(v)
+		}
+		return m[2]
+	})
+
+	var f configFile
+	if err := yaml.Unmarshal(raw, &f); err != nil {
+		return err
+	}
+	if !configFileFormats[f.FileFormat] {
+		return fmt.Errorf("unsupported file_format %q, use 0.3", f.FileFormat)
+	}
+
+	if f.Disabled {
+		cfg.Disabled = true
+		return nil
+	}
+
+	for _, a := range f.Resource.Attributes {
+		cfg.ResourceAttributes = append(cfg.ResourceAttributes, yamlAttribute(a.Name, a.Value))
+	}
+
+	if len(f.Propagator.Composite) > 0 {
+		cfg.Propagators = f.Propagator.Composite
+	}
+
+	if len(f.TracerProvider.Processors) > 1 {
+		return fmt.Errorf("tracer_provider.processors: only one processor is supported, got %d", len(f.TracerProvider.Processors))
+	}
+	for _, p := range f.TracerProvider.Processors {
+		for kind, model := range p {
+			if err := applyProcessor(cfg, kind, model); err != nil {
+				return fmt.Errorf("tracer_provider.processors: %w", err)
+			}
+		}
+	}
+
+	limits := f.TracerProvider.Limits
+	for _, l := range []struct {
+		from *int
+		to   *int
+	}{
+		{limits.AttributeValueLengthLimit, &cfg.SpanLimits.AttributeValueLengthLimit},
+		{limits.AttributeCountLimit, &cfg.SpanLimits.AttributeCountLimit},
+		{limits.EventCountLimit, &cfg.SpanLimits.EventCountLimit},
+		{limits.LinkCountLimit, &cfg.SpanLimits.LinkCountLimit},
+		{limits.EventAttributeCountLimit, &cfg.SpanLimits.AttributePerEventCountLimit},
+		{limits.LinkAttributeCountLimit, &cfg.SpanLimits.AttributePerLinkCountLimit},
+	} {
+		if l.from != nil {
+			*l.to = *l.from
+		}
+	}
+
+	if f.TracerProvider.Sampler != nil {
+		sampler, err := f.TracerProvider.Sampler.build()
+		if err != nil {
+			return fmt.Errorf("tracer_provider.sampler: %w", err)
+		}
+		cfg.TraceSampler = sampler
+	}
+
+	return nil
+}
+
+func applyProcessor(cfg *Config, kind string, p processorModel) error {
+	switch kind {
+	case "batch":
+		cfg.SpanProcessor = "batch"
+		cfg.Batch = BatchConfig{
+			ScheduleDelay:      time.Duration(p.ScheduleDelay) * time.Millisecond,
+			ExportTimeout:      time.Duration(p.ExportTimeout) * time.Millisecond,
+			MaxQueueSize:       p.MaxQueueSize,
+			MaxExportBatchSize: p.MaxExportBatchSize,
+		}
+	case "simple":
+		cfg.SpanProcessor = "simple"
+	default:
+		return fmt.Errorf("unknown processor %q, use batch or simple", kind)
+	}
+
+	if otlp := p.Exporter.OTLP; otlp != nil {
+		cfg.Exporter = "otlp"
+		if otlp.Protocol != "" {
+			cfg.Protocol = otlp.Protocol
+		}
+		if otlp.Endpoint != "" {
+			// the spec takes URLs, Config the host:port
+			endpoint := otlp.Endpoint
+			if u, err := url.Parse(otlp.Endpoint); err == nil && u.Host != "" {
+				endpoint = u.Host
+			}
+			if cfg.Protocol == "grpc" {
+				cfg.GRPCEndpoint = endpoint
+			} else {
+				cfg.Endpoint = endpoint
+			}
+		}
+	} else if p.Exporter.Console != nil {
+		return fmt.Errorf("the console exporter isn't supported")
+	}
+
+	return nil
+}
+
+// yamlAttribute converts the value of a resource attribute read from YAML
+func yamlAttribute(key string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case string:
+		return attribute.String(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// options are the batch processor options of the fields that are set
+func (b BatchConfig) options() []sdktrace.BatchSpanProcessorOption {
+	var opts []sdktrace.BatchSpanProcessorOption
+	if b.ScheduleDelay > 0 {
+		opts = append(opts, sdktrace.WithBatchTimeout(b.ScheduleDelay))
+	}
+	if b.ExportTimeout > 0 {
+		opts = append(opts, sdktrace.WithExportTimeout(b.ExportTimeout))
+	}
+	if b.MaxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(b.MaxQueueSize))
+	}
+	if b.MaxExportBatchSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(b.MaxExportBatchSize))
+	}
+
+	return opts
+}
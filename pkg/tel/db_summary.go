@@ -0,0 +1,117 @@
+package tel
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dbSummaryProcessor promotes a summary of the database calls of a request
+// onto its local root span, usually the server span: how many operations ran,
+// how long they took together and which collections they touched. It saves
+// opening every db span of a trace to see that a slow request was slow in the
+// database.
+//
+// Database spans are the CLIENT spans with db.system, like the ones of the
+// repository decorator. Database spans started under another one, e.g. the
+// GridFS chunk inserts, are part of their parent and aren't counted again.
+type dbSummaryProcessor struct {
+	mu    sync.Mutex
+	spans map[trace.SpanID]dbSpanEntry
+}
+
+type dbSpanEntry struct {
+	root *dbSummary
+	// inDB is set for the spans below a database span
+	inDB bool
+	db   bool
+}
+
+type dbSummary struct {
+	span        sdktrace.ReadWriteSpan
+	operations  int
+	seconds     float64
+	collections map[string]bool
+}
+
+func newDBSummaryProcessor() *dbSummaryProcessor {
+	return &dbSummaryProcessor{spans: map[trace.SpanID]dbSpanEntry{}}
+}
+
+func (p *dbSummaryProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := s.SpanContext().SpanID()
+	parent := s.Parent()
+	if !parent.IsValid() || parent.IsRemote() {
+		p.spans[id] = dbSpanEntry{root: &dbSummary{span: s, collections: map[string]bool{}}}
+		return
+	}
+
+	// spans of requests started before the processor aren't followed
+	pe, ok := p.spans[parent.SpanID()]
+	if !ok {
+		return
+	}
+	p.spans[id] = dbSpanEntry{root: pe.root, inDB: pe.inDB || pe.db, db: isDBSpan(s)}
+}
+
+func (p *dbSummaryProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := s.SpanContext().SpanID()
+	e, ok := p.spans[id]
+	if !ok {
+		return
+	}
+	delete(p.spans, id)
+
+	if !e.db || e.inDB {
+		return
+	}
+
+	sum := e.root
+	sum.operations++
+	sum.seconds += s.EndTime().Sub(s.StartTime()).Seconds()
+	for _, kv := range s.Attributes() {
+		if kv.Key == "db.collection.name" {
+			sum.collections[kv.Value.AsString()] = true
+		}
+	}
+
+	collections := make([]string, 0, len(sum.collections))
+	for c := range sum.collections {
+		collections = append(collections, c)
+	}
+	sort.Strings(collections)
+
+	// the root is still running, it ends after its children
+	sum.span.SetAttributes(
+		attribute.Int("db.client.operations", sum.operations),
+		attribute.Float64("db.client.duration", sum.seconds),
+		attribute.StringSlice("db.client.collections", collections),
+	)
+}
+
+func (p *dbSummaryProcessor) Shutdown(context.Context) error   { return nil }
+func (p *dbSummaryProcessor) ForceFlush(context.Context) error { return nil }
+
+// isDBSpan reports whether s is a database client span
+func isDBSpan(s sdktrace.ReadOnlySpan) bool {
+	if s.SpanKind() != trace.SpanKindClient {
+		return false
+	}
+	for _, kv := range s.Attributes() {
+		if kv.Key == "db.system" {
+			return true
+		}
+	}
+
+	return false
+}
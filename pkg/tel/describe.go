@@ -0,0 +1,159 @@
+package tel
+
+import (
+	"net/url"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Description is the effective telemetry setup of the service, for debugging
+// why data doesn't show up where it's expected. It holds no secrets.
+type Description struct {
+	Enabled         bool           `json:"enabled"`
+	ConfigFile      string         `json:"config_file,omitempty"`
+	Resource        map[string]any `json:"resource"`
+	ResourceSchema  string         `json:"resource_schema_url"`
+	Scopes          []ScopeInfo    `json:"scopes"`
+	Signals         []string       `json:"signals"`
+	Exporter        string         `json:"exporter"`
+	Targets         []TargetInfo   `json:"targets,omitempty"`
+	ProxyURL        string         `json:"proxy_url,omitempty"`
+	Sampler         string         `json:"sampler"`
+	SpanProcessor   string         `json:"span_processor"`
+	Propagators     []string       `json:"propagators"`
+	PropagatedField []string       `json:"propagated_fields"`
+	Profile         string         `json:"attribute_profile"`
+	Temporality     string         `json:"metric_temporality"`
+	SpanLimits      map[string]int `json:"span_limits"`
+	Heartbeat       string         `json:"heartbeat,omitempty"`
+	DBSummary       bool           `json:"db_summary"`
+	CodeAttributes  bool           `json:"code_attributes"`
+	Redaction       bool           `json:"span_redaction"`
+	RetentionHints  bool           `json:"retention_hints"`
+}
+
+// TargetInfo is an OTLPTarget with the values of the headers masked
+type TargetInfo struct {
+	Signal   string   `json:"signal"`
+	Protocol string   `json:"protocol"`
+	Endpoint string   `json:"endpoint"`
+	URLPath  string   `json:"url_path,omitempty"`
+	Headers  []string `json:"headers"`
+	Insecure bool     `json:"insecure"`
+}
+
+// ScopeInfo is an instrumentation scope the service starts spans under
+type ScopeInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Describe returns the setup Init, or the last Reload, made, with the exporter
+// headers masked
+func (t *Telemetry) Describe() Description {
+	cfg := t.config()
+	res := newResource(cfg)
+	limits := cfg.spanLimits()
+
+	d := Description{
+		Enabled:        !cfg.Disabled,
+		ConfigFile:     cfg.ConfigFile,
+		Resource:       map[string]any{},
+		ResourceSchema: res.SchemaURL(),
+		Exporter:       cfg.Exporter,
+		SpanProcessor:  orDefault(cfg.SpanProcessor, "batch"),
+		Profile:        orDefault(cfg.AttributeProfile, "recommended"),
+		Temporality:    orDefault(cfg.MetricTemporality, "cumulative"),
+		DBSummary:      cfg.DBSummary,
+		CodeAttributes: cfg.CodeAttributes,
+		Redaction:      cfg.SpanRedaction.Enabled,
+		RetentionHints: cfg.RetentionHints.Enabled,
+		SpanLimits: map[string]int{
+			"attribute_value_length": limits.AttributeValueLengthLimit,
+			"attribute_count":        limits.AttributeCountLimit,
+			"event_count":            limits.EventCountLimit,
+			"link_count":             limits.LinkCountLimit,
+			"event_attribute_count":  limits.AttributePerEventCountLimit,
+			"link_attribute_count":   limits.AttributePerLinkCountLimit,
+		},
+	}
+	for _, kv := range res.Attributes() {
+		d.Resource[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	scopeNamesMu.Lock()
+	for _, name := range scopeNames {
+		d.Scopes = append(d.Scopes, ScopeInfo{Name: name, Version: scopeVersion})
+	}
+	scopeNamesMu.Unlock()
+	sort.Slice(d.Scopes, func(i, j int) bool { return d.Scopes[i].Name < d.Scopes[j].Name })
+	if cfg.Disabled {
+		return d
+	}
+
+	if t.TracerProvider != nil {
+		d.Signals = append(d.Signals, "traces")
+	}
+	if t.MeterProvider != nil {
+		d.Signals = append(d.Signals, "metrics")
+	}
+	if t.LoggerProvider != nil {
+		d.Signals = append(d.Signals, "logs")
+	}
+
+	if targets, err := OTLPTargets(cfg); err == nil {
+		for _, target := range targets {
+			info := TargetInfo{
+				Signal:   target.Signal,
+				Protocol: target.Protocol,
+				Endpoint: target.Endpoint,
+				URLPath:  target.URLPath,
+				Insecure: target.Insecure,
+			}
+			for k := range target.Headers {
+				info.Headers = append(info.Headers, k+": REDACTED")
+			}
+			if target.OAuth2 {
+				info.Headers = append(info.Headers, "Authorization: OAuth2 bearer token")
+			}
+			sort.Strings(info.Headers)
+			d.Targets = append(d.Targets, info)
+		}
+	}
+	if u, err := url.Parse(cfg.ProxyURL); err == nil && cfg.ProxyURL != "" {
+		d.ProxyURL = u.Redacted()
+	}
+
+	// the same fallbacks as InitTracer
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		sampler = sdktrace.AlwaysSample()
+	}
+	sampler = routeSampler{next: sampler}
+	if cfg.Heartbeat > 0 {
+		sampler = heartbeatSampler{next: sampler}
+		d.Heartbeat = cfg.Heartbeat.String()
+	}
+	d.Sampler = sampler.Description()
+
+	d.Propagators = cfg.Propagators
+	if len(d.Propagators) == 0 {
+		d.Propagators = defaultPropagators(cfg.Exporter)
+	}
+	if _, err := newPropagator(d.Propagators); err != nil {
+		d.Propagators = defaultPropagators(cfg.Exporter)
+	}
+	d.PropagatedField = otel.GetTextMapPropagator().Fields()
+	sort.Strings(d.PropagatedField)
+
+	return d
+}
+
+func orDefault(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+
+	return v
+}
@@ -0,0 +1,95 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newExporter returns the span exporter selected by cfg.Exporter, along with any
+// provider options the backend needs.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, []sdktrace.TracerProviderOption, error) {
+	switch cfg.Exporter {
+	case "otlp":
+		exp, err := newOTLPExporter(ctx, cfg)
+		return exp, nil, err
+	case "xray":
+		return newXRayExporter(ctx)
+	case "cloudtrace":
+		exp, err := newCloudTraceExporter(cfg.GCPProjectID)
+		return exp, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+}
+
+// newOTLPExporter returns the OTLP exporter for the configured protocol
+func newOTLPExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Protocol {
+	case "http/protobuf", "http/json":
+		if cfg.UnixSocket != "" || cfg.Dialer != nil {
+			return nil, fmt.Errorf("unix sockets and custom dialers need the grpc protocol")
+		}
+
+		var proxy otlptracehttp.HTTPTransportProxyFunc
+		if cfg.ProxyURL != "" {
+			u, err := url.Parse(cfg.ProxyURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy URL: %w", err)
+			}
+			proxy = http.ProxyURL(u)
+		}
+
+		build := func(ctx context.Context, headers map[string]string) (sdktrace.SpanExporter, error) {
+			if cfg.Protocol == "http/json" {
+				return newOTLPJSONExporter(ctx, cfg.Endpoint, cfg.TLS, proxy, headers)
+			}
+			return newOTLPHTTPExporter(ctx, cfg.Endpoint, cfg.TLS, proxy, headers)
+		}
+		if cfg.OAuth2.Enabled() {
+			return bearerSpanExporter{newBearerExporter(cfg, build)}, nil
+		}
+		return build(ctx, exportHeaders(cfg, nil))
+	case "grpc":
+		return newOTLPGRPCExporter(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+// newXRayExporter sends spans to AWS X-Ray through the OTLP endpoint of the
+// CloudWatch agent (AWS_XRAY_OTLP_ENDPOINT, by default localhost:4318), which
+// signs and forwards them. X-Ray needs trace IDs that start with the epoch
+// time, so the X-Ray ID generator is installed as well.
+func newXRayExporter(ctx context.Context) (sdktrace.SpanExporter, []sdktrace.TracerProviderOption, error) {
+	endpoint := os.Getenv("AWS_XRAY_OTLP_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "localhost:4318"
+	}
+
+	exp, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithInsecure(),
+		otlptracehttp.WithEndpoint(endpoint),
+	)
+
+	return exp, []sdktrace.TracerProviderOption{sdktrace.WithIDGenerator(xray.NewIDGenerator())}, err
+}
+
+// newCloudTraceExporter writes spans directly to Google Cloud Trace using the
+// application default credentials. The project is detected from the metadata
+// server when projectID is empty.
+func newCloudTraceExporter(projectID string) (sdktrace.SpanExporter, error) {
+	var opts []texporter.Option
+	if projectID != "" {
+		opts = append(opts, texporter.WithProjectID(projectID))
+	}
+
+	return texporter.New(opts...)
+}
@@ -0,0 +1,144 @@
+package tel
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// AttributeFilter selects the attribute keys kept on a signal before export.
+// When Allow is set only those keys are kept, and keys in Deny are always dropped.
+type AttributeFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// attributeFilterFromEnv reads OTEL_<SIGNAL>_ATTRIBUTES_ALLOW and OTEL_<SIGNAL>_ATTRIBUTES_DENY,
+// both comma separated lists of keys
+func attributeFilterFromEnv(signal string) AttributeFilter {
+	return AttributeFilter{
+		Allow: splitList(os.Getenv("OTEL_" + signal + "_ATTRIBUTES_ALLOW")),
+		Deny:  splitList(os.Getenv("OTEL_" + signal + "_ATTRIBUTES_DENY")),
+	}
+}
+
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// IsZero reports whether the filter keeps every attribute
+func (f AttributeFilter) IsZero() bool {
+	return len(f.Allow) == 0 && len(f.Deny) == 0
+}
+
+// keep reports whether key survives the filter
+func (f AttributeFilter) keep(key string) bool {
+	for _, k := range f.Deny {
+		if k == key {
+			return false
+		}
+	}
+
+	if len(f.Allow) == 0 {
+		return true
+	}
+
+	for _, k := range f.Allow {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f AttributeFilter) filter(attrs []attribute.KeyValue) []attribute.KeyValue {
+	kept := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if f.keep(string(kv.Key)) {
+			kept = append(kept, kv)
+		}
+	}
+
+	return kept
+}
+
+// filteringSpanExporter drops filtered attributes from spans and their events
+type filteringSpanExporter struct {
+	sdktrace.SpanExporter
+	filter AttributeFilter
+}
+
+// filteredSpan overrides the attributes of the wrapped span
+type filteredSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+}
+
+func (s filteredSpan) Attributes() []attribute.KeyValue { return s.attrs }
+
+func (s filteredSpan) Events() []sdktrace.Event { return s.events }
+
+func (e filteringSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	filtered := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		// the events are shared with the other exporters of the span
+		events := slices.Clone(span.Events())
+		for j := range events {
+			events[j].Attributes = e.filter.filter(events[j].Attributes)
+		}
+
+		filtered[i] = filteredSpan{
+			ReadOnlySpan: span,
+			attrs:        e.filter.filter(span.Attributes()),
+			events:       events,
+		}
+	}
+
+	return e.SpanExporter.ExportSpans(ctx, filtered)
+}
+
+// filteringLogProcessor drops filtered attributes before handing records to next
+type filteringLogProcessor struct {
+	sdklog.Processor
+	filter AttributeFilter
+}
+
+func (p filteringLogProcessor) OnEmit(ctx context.Context, record sdklog.Record) error {
+	record = record.Clone()
+
+	var kept []log.KeyValue
+	record.WalkAttributes(func(kv log.KeyValue) bool {
+		if p.filter.keep(kv.Key) {
+			kept = append(kept, kv)
+		}
+		return true
+	})
+	record.SetAttributes(kept...)
+
+	return p.Processor.OnEmit(ctx, record)
+}
+
+// metricAttributeView applies the filter to every instrument
+func metricAttributeView(f AttributeFilter) sdkmetric.View {
+	return sdkmetric.NewView(sdkmetric.Instrument{Name: "*"}, sdkmetric.Stream{
+		AttributeFilter: func(kv attribute.KeyValue) bool {
+			return f.keep(string(kv.Key))
+		},
+	})
+}
@@ -0,0 +1,201 @@
+package tel
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// fixtureVolatileAttributes change from one run to the next, or from one
+// language to another, and are left out of the fixtures
+var fixtureVolatileAttributes = map[string]bool{
+	"client.address":                 true,
+	"client.port":                    true,
+	"network.peer.address":           true,
+	"network.peer.port":              true,
+	"server.address":                 true,
+	"server.port":                    true,
+	"user_agent.original":            true,
+	"db.operation.time_remaining":    true,
+	"http.client.dns.duration":       true,
+	"http.client.connect.duration":   true,
+	"http.client.tls.duration":       true,
+	"http.client.time_to_first_byte": true,
+	"http.client.connection.reused":  true,
+	"code.filepath":                  true,
+	"code.lineno":                    true,
+	"code.function":                  true,
+	"code.namespace":                 true,
+}
+
+// fixtureResourceAttributes are the only resource attributes kept, the rest
+// describes the host and the SDK
+var fixtureResourceAttributes = map[string]bool{"service.name": true}
+
+// WriteFixture writes spans as an OTLP/JSON export request that only depends
+// on what the spans say: ids are renumbered in order of appearance,
+// timestamps and flags are zeroed, volatile attributes are dropped, and scopes, spans
+// and attributes are sorted. Two runs of the same requests, in any language,
+// write the same bytes.
+func WriteFixture(ctx context.Context, w io.Writer, spans []sdktrace.ReadOnlySpan) error {
+	client := &capturingTraceClient{}
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err := exporter.ExportSpans(ctx, spans); err != nil {
+		return err
+	}
+
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: client.spans}
+	normalizeFixture(req)
+
+	raw, err := marshalOTLPJSON(req)
+	if err != nil {
+		return err
+	}
+
+	// MarshalIndent sorts the keys of the maps it's given
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+// capturingTraceClient keeps the spans the exporter converted to OTLP
+type capturingTraceClient struct {
+	spans []*tracepb.ResourceSpans
+}
+
+func (c *capturingTraceClient) Start(context.Context) error { return nil }
+func (c *capturingTraceClient) Stop(context.Context) error  { return nil }
+
+func (c *capturingTraceClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	c.spans = append(c.spans, spans...)
+	return nil
+}
+
+func normalizeFixture(req *coltracepb.ExportTraceServiceRequest) {
+	traceIDs, spanIDs := fixtureIDs{}, fixtureIDs{}
+
+	// concurrent spans start in any order, so spans are sorted by the names
+	// from the root of their trace down to them, which puts children right
+	// after their parent, and only then by start time
+	byID := map[string]*tracepb.Span{}
+	traceStart := map[string]uint64{}
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				byID[string(span.SpanId)] = span
+				if start, ok := traceStart[string(span.TraceId)]; !ok || span.StartTimeUnixNano < start {
+					traceStart[string(span.TraceId)] = span.StartTimeUnixNano
+				}
+			}
+		}
+	}
+	path := func(span *tracepb.Span) string {
+		p := span.Name
+		for parent, depth := byID[string(span.ParentSpanId)], 0; parent != nil && depth < 64; parent, depth = byID[string(parent.ParentSpanId)], depth+1 {
+			p = parent.Name + "\x00" + p
+		}
+		return p
+	}
+
+	for _, rs := range req.ResourceSpans {
+		if rs.Resource != nil {
+			rs.Resource.Attributes = keepAttributes(rs.Resource.Attributes, func(key string) bool { return fixtureResourceAttributes[key] })
+		}
+		rs.SchemaUrl = ""
+
+		sort.SliceStable(rs.ScopeSpans, func(i, j int) bool {
+			return rs.ScopeSpans[i].GetScope().GetName() < rs.ScopeSpans[j].GetScope().GetName()
+		})
+		for _, ss := range rs.ScopeSpans {
+			sort.SliceStable(ss.Spans, func(i, j int) bool {
+				a, b := ss.Spans[i], ss.Spans[j]
+				if ta, tb := traceStart[string(a.TraceId)], traceStart[string(b.TraceId)]; ta != tb {
+					return ta < tb
+				}
+				if pa, pb := path(a), path(b); pa != pb {
+					return pa < pb
+				}
+				return a.StartTimeUnixNano < b.StartTimeUnixNano
+			})
+		}
+	}
+
+	// ids are renumbered once every span is in its final order
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				span.TraceId = traceIDs.renumber(span.TraceId, 16)
+				span.SpanId = spanIDs.renumber(span.SpanId, 8)
+			}
+		}
+	}
+
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				if len(span.ParentSpanId) > 0 {
+					span.ParentSpanId = spanIDs.renumber(span.ParentSpanId, 8)
+				}
+				// the flags say whether parents are remote, not every SDK sets them
+				span.TraceState, span.Flags = "", 0
+				span.StartTimeUnixNano, span.EndTimeUnixNano = 0, 0
+				span.Attributes = keepAttributes(span.Attributes, func(key string) bool { return !fixtureVolatileAttributes[key] })
+				for _, event := range span.Events {
+					event.TimeUnixNano = 0
+					event.Attributes = keepAttributes(event.Attributes, func(key string) bool { return !fixtureVolatileAttributes[key] })
+				}
+				for _, link := range span.Links {
+					link.TraceId = traceIDs.renumber(link.TraceId, 16)
+					link.SpanId = spanIDs.renumber(link.SpanId, 8)
+					link.TraceState, link.Flags = "", 0
+				}
+			}
+		}
+	}
+}
+
+// fixtureIDs maps the ids seen to 1, 2, 3... in order of appearance
+type fixtureIDs map[string][]byte
+
+func (ids fixtureIDs) renumber(id []byte, size int) []byte {
+	if n, ok := ids[string(id)]; ok {
+		return n
+	}
+
+	n := make([]byte, size)
+	binary.BigEndian.PutUint64(n[size-8:], uint64(len(ids)+1))
+	ids[string(id)] = n
+	return n
+}
+
+// keepAttributes returns the attributes whose key passes keep, sorted by key
+func keepAttributes(attrs []*commonpb.KeyValue, keep func(string) bool) []*commonpb.KeyValue {
+	out := attrs[:0]
+	for _, kv := range attrs {
+		if keep(kv.Key) {
+			out = append(out, kv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+
+	return out
+}
@@ -0,0 +1,81 @@
+package tel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// heartbeatKey marks the heartbeat spans, which heartbeatSampler always samples
+const heartbeatKey = attribute.Key("otel.heartbeat")
+
+// heartbeatSampler samples the heartbeat spans whatever next decides, so they
+// keep proving the pipeline works with a low sampling ratio
+type heartbeatSampler struct {
+	next sdktrace.Sampler
+}
+
+func (s heartbeatSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, kv := range p.Attributes {
+		if kv.Key == heartbeatKey {
+			return sdktrace.AlwaysSample().ShouldSample(p)
+		}
+	}
+
+	return s.next.ShouldSample(p)
+}
+
+func (s heartbeatSampler) Description() string {
+	return "Heartbeat{" + s.next.Description() + "}"
+}
+
+// startHeartbeat emits a heartbeat trace through tp and counts it every
+// interval until the returned function is called
+func startHeartbeat(tp trace.TracerProvider, interval time.Duration) (stop func()) {
+	tracer := tp.Tracer(instrumentationName)
+	beats, _ := otel.Meter(instrumentationName).Int64Counter("otel.heartbeat",
+		metric.WithDescription("Number of heartbeat traces emitted, to tell a quiet service from a broken pipeline"),
+		metric.WithUnit("{heartbeat}"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for seq := int64(1); ; seq++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			_, span := tracer.Start(ctx, "heartbeat",
+				trace.WithNewRoot(),
+				trace.WithSpanKind(trace.SpanKindInternal),
+				trace.WithAttributes(
+					heartbeatKey.Bool(true),
+					attribute.Int64("heartbeat.sequence", seq),
+					attribute.Float64("heartbeat.interval", interval.Seconds()),
+				),
+			)
+			span.End()
+			beats.Add(ctx, 1)
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,189 @@
+package tel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log/global"
+	lognoop "go.opentelemetry.io/otel/log/noop"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// Option configures Init
+type Option func(*initOptions)
+
+type initOptions struct {
+	serviceName string
+	cfg         *Config
+	attrs       []attribute.KeyValue
+
+	traces, metrics, logs bool
+}
+
+// WithServiceName reports the signals under name
+func WithServiceName(name string) Option {
+	return func(o *initOptions) { o.serviceName = name }
+}
+
+// WithConfig starts from cfg instead of ConfigFromEnv
+func WithConfig(cfg Config) Option {
+	return func(o *initOptions) { o.cfg = &cfg }
+}
+
+// WithResourceAttributes adds attrs to the resource of every signal
+func WithResourceAttributes(attrs ...attribute.KeyValue) Option {
+	return func(o *initOptions) { o.attrs = append(o.attrs, attrs...) }
+}
+
+// WithTraces sets up the tracing pipeline
+func WithTraces() Option {
+	return func(o *initOptions) { o.traces = true }
+}
+
+// WithMetrics sets up the metrics pipeline
+func WithMetrics() Option {
+	return func(o *initOptions) { o.metrics = true }
+}
+
+// WithLogs sets up the logs pipeline
+func WithLogs() Option {
+	return func(o *initOptions) { o.logs = true }
+}
+
+// Telemetry holds the providers set up by Init, nil for the signals left out
+// and when telemetry is disabled
+type Telemetry struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	LoggerProvider *sdklog.LoggerProvider
+
+	// stopHeartbeat stops the heartbeat, when Config.Heartbeat enabled it
+	stopHeartbeat func()
+
+	// cfg is the config Init set the pipelines up with, for Describe
+	cfg Config
+
+	// exports is the export pipeline of the spans, rebuilt by Reload from
+	// the environment when fromEnv, and reloaded the config it used
+	exports  *swappableProcessor
+	fromEnv  bool
+	reloaded atomic.Pointer[Config]
+}
+
+// Init validates the config and sets up the pipelines of the signals picked
+// with WithTraces, WithMetrics and WithLogs, registering their providers
+// globally:
+//
+//	telemetry, err := tel.Init(ctx, tel.WithServiceName("api"), tel.WithTraces(), tel.WithMetrics(), tel.WithLogs())
+//	...
+//	defer telemetry.Shutdown(ctx)
+func Init(ctx context.Context, opts ...Option) (*Telemetry, error) {
+	o := initOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var cfg Config
+	if o.cfg != nil {
+		cfg = *o.cfg
+		if o.serviceName != "" {
+			cfg.ServiceName = o.serviceName
+		}
+	} else {
+		cfg = ConfigFromEnv(o.serviceName)
+	}
+	cfg.ResourceAttributes = append(cfg.ResourceAttributes, o.attrs...)
+
+	if cfg.Disabled {
+		installNoop(cfg)
+		return &Telemetry{cfg: cfg}, nil
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := &Telemetry{cfg: cfg, fromEnv: o.cfg == nil}
+	if o.traces {
+		t.TracerProvider, t.exports = initTracer(cfg)
+	}
+	if o.logs {
+		t.LoggerProvider = InitLogger(cfg)
+	}
+	if o.metrics {
+		t.MeterProvider = InitMeter(cfg)
+	}
+	if o.traces && cfg.Heartbeat > 0 {
+		t.stopHeartbeat = startHeartbeat(t.TracerProvider, cfg.Heartbeat)
+	}
+
+	return t, nil
+}
+
+// installNoop registers no-op providers for every signal. The propagators stay,
+// so the trace context of incoming requests still reaches the outgoing ones.
+func installNoop(cfg Config) {
+	otel.SetTracerProvider(tracenoop.NewTracerProvider())
+	otel.SetMeterProvider(metricnoop.NewMeterProvider())
+	global.SetLoggerProvider(lognoop.NewLoggerProvider())
+
+	propagators := cfg.Propagators
+	if len(propagators) == 0 {
+		propagators = defaultPropagators(cfg.Exporter)
+	}
+	if propagator, err := newPropagator(propagators); err == nil {
+		otel.SetTextMapPropagator(propagator)
+	}
+}
+
+// Enabled is false when Init installed the no-op providers
+func (t *Telemetry) Enabled() bool {
+	return !t.cfg.Disabled
+}
+
+// ForceFlush exports what the pipelines hold, it does nothing for the signals
+// left out or with telemetry disabled
+func (t *Telemetry) ForceFlush(ctx context.Context) error {
+	var errs []error
+
+	if t.TracerProvider != nil {
+		errs = append(errs, t.TracerProvider.ForceFlush(ctx))
+	}
+	if t.LoggerProvider != nil {
+		errs = append(errs, t.LoggerProvider.ForceFlush(ctx))
+	}
+	if t.MeterProvider != nil {
+		errs = append(errs, t.MeterProvider.ForceFlush(ctx))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shutdown stops the heartbeat, then flushes and stops the pipelines: traces
+// first, then logs, then metrics, so what the first two record about their own
+// exports still goes out
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if t.stopHeartbeat != nil {
+		t.stopHeartbeat()
+	}
+	if t.TracerProvider != nil {
+		errs = append(errs, t.TracerProvider.Shutdown(ctx))
+	}
+	if t.LoggerProvider != nil {
+		errs = append(errs, t.LoggerProvider.Shutdown(ctx))
+	}
+	if t.MeterProvider != nil {
+		errs = append(errs, t.MeterProvider.Shutdown(ctx))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package tel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+)
+
+// instanceIDNamespace is the UUIDv5 namespace the semantic conventions
+// suggest for deriving service.instance.id
+var instanceIDNamespace = uuid.MustParse("4d63009a-8d0f-11ee-aad7-4c796ed8e320")
+
+// serviceInstanceID returns the service.instance.id of cfg: the configured one,
+// else the UUID kept in cfg.ServiceInstanceIDFile, created on the first start,
+// else a UUID derived from the service name and the hostname, which is stable
+// across restarts of a pod or a VM but not of a container without a set hostname.
+func serviceInstanceID(cfg Config) string {
+	if cfg.ServiceInstanceID != "" {
+		return cfg.ServiceInstanceID
+	}
+
+	if cfg.ServiceInstanceIDFile != "" {
+		id, err := persistedInstanceID(cfg.ServiceInstanceIDFile)
+		if err == nil {
+			return id
+		}
+		logging.Default().Error("Error reading the service instance id, deriving it from the hostname", "file", cfg.ServiceInstanceIDFile, "error", err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		// without a hostname every start is a new instance
+		return uuid.NewString()
+	}
+
+	return uuid.NewSHA1(instanceIDNamespace, []byte(cfg.ServiceName+"/"+host)).String()
+}
+
+// persistedInstanceID reads the id stored in path, writing a new one the first time
+func persistedInstanceID(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(b)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id := uuid.NewString()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
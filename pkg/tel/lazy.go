@@ -0,0 +1,38 @@
+package tel
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LazyAttribute is an attribute whose value is only computed when the span
+// records it, for values that are expensive to build, like a serialized query.
+// Sampled out spans never call Value.
+type LazyAttribute struct {
+	Key   attribute.Key
+	Value func() attribute.Value
+}
+
+// Lazy returns an attribute computed by value
+func Lazy(key string, value func() attribute.Value) LazyAttribute {
+	return LazyAttribute{Key: attribute.Key(key), Value: value}
+}
+
+// LazyString returns a string attribute computed by value
+func LazyString(key string, value func() string) LazyAttribute {
+	return Lazy(key, func() attribute.Value { return attribute.StringValue(value()) })
+}
+
+// SetLazyAttributes computes attrs and sets them on span, if it's recording.
+// The sampler doesn't see them: they're set after the span started.
+func SetLazyAttributes(span trace.Span, attrs ...LazyAttribute) {
+	if !span.IsRecording() || len(attrs) == 0 {
+		return
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, attribute.KeyValue{Key: a.Key, Value: a.Value()})
+	}
+	span.SetAttributes(kvs...)
+}
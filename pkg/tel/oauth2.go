@@ -0,0 +1,272 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth2Config fetches the bearer token sent with the OTLP exports with the
+// client credentials flow, for backends like Grafana Cloud and the collectors
+// behind an identity provider. It replaces the static Authorization header.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Audience is sent as the audience parameter of the token request, which
+	// some identity providers require
+	Audience string
+}
+
+// Enabled reports whether the exports authenticate with OAuth2
+func (c OAuth2Config) Enabled() bool {
+	return c.TokenURL != ""
+}
+
+// oauth2FromEnv reads OTEL_EXPORTER_OTLP_OAUTH2_TOKEN_URL, _CLIENT_ID,
+// _CLIENT_SECRET, _SCOPES (comma separated) and _AUDIENCE
+func oauth2FromEnv() OAuth2Config {
+	return OAuth2Config{
+		TokenURL:     os.Getenv("OTEL_EXPORTER_OTLP_OAUTH2_TOKEN_URL"),
+		ClientID:     os.Getenv("OTEL_EXPORTER_OTLP_OAUTH2_CLIENT_ID"),
+		ClientSecret: os.Getenv("OTEL_EXPORTER_OTLP_OAUTH2_CLIENT_SECRET"),
+		Scopes:       splitList(os.Getenv("OTEL_EXPORTER_OTLP_OAUTH2_SCOPES")),
+		Audience:     os.Getenv("OTEL_EXPORTER_OTLP_OAUTH2_AUDIENCE"),
+	}
+}
+
+// validate returns what's wrong with c, nothing when it's not enabled
+func (c OAuth2Config) validate() []string {
+	if !c.Enabled() {
+		return nil
+	}
+
+	var problems []string
+	if u, err := url.Parse(c.TokenURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("the OAuth2 token URL %q (OTEL_EXPORTER_OTLP_OAUTH2_TOKEN_URL) must be an http or https URL", c.TokenURL))
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		problems = append(problems, "OAuth2 needs OTEL_EXPORTER_OTLP_OAUTH2_CLIENT_ID and OTEL_EXPORTER_OTLP_OAUTH2_CLIENT_SECRET")
+	}
+
+	return problems
+}
+
+// tokenRefreshMargin is how long before its expiry a token is replaced, so an
+// export never goes out with a token expiring on the way
+const tokenRefreshMargin = time.Minute
+
+// tokenSources are shared by the exporters of the three signals, and by the
+// pipelines rebuilt by Reload, so a token is fetched once for all of them
+var (
+	tokenSourcesMu sync.Mutex
+	tokenSources   = map[string]oauth2.TokenSource{}
+)
+
+// tokenSource returns the source of the tokens of c, which caches the token
+// until tokenRefreshMargin before it expires
+func tokenSource(c OAuth2Config) oauth2.TokenSource {
+	key := strings.Join([]string{c.TokenURL, c.ClientID, c.ClientSecret, strings.Join(c.Scopes, " "), c.Audience}, "\x00")
+
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+	if ts, ok := tokenSources[key]; ok {
+		return ts
+	}
+
+	cc := clientcredentials.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		TokenURL:     c.TokenURL,
+		Scopes:       c.Scopes,
+	}
+	if c.Audience != "" {
+		cc.EndpointParams = url.Values{"audience": {c.Audience}}
+	}
+
+	ts := oauth2.ReuseTokenSourceWithExpiry(nil, cc.TokenSource(context.Background()), tokenRefreshMargin)
+	tokenSources[key] = ts
+	return ts
+}
+
+// exportHeaders returns the headers sent with every OTLP export besides
+// extra: the OpenObserve credentials, unless the exports authenticate with
+// OAuth2, the token then being added by the bearer exporters
+func exportHeaders(cfg Config, extra map[string]string) map[string]string {
+	headers := map[string]string{}
+	if !cfg.OAuth2.Enabled() {
+		headers["Authorization"] = openObserveAuthorization
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+
+	return headers
+}
+
+// bearerExporter holds an exporter built with the current token in its
+// Authorization header. The SDK exporters only take fixed headers, so a new
+// one is built when the token is refreshed, and the previous one shut down.
+type bearerExporter[E interface{ Shutdown(context.Context) error }] struct {
+	tokens oauth2.TokenSource
+	build  func(ctx context.Context, headers map[string]string) (E, error)
+
+	mu      sync.Mutex
+	token   string
+	current E
+	built   bool
+}
+
+func newBearerExporter[E interface{ Shutdown(context.Context) error }](cfg Config, build func(context.Context, map[string]string) (E, error)) *bearerExporter[E] {
+	return &bearerExporter[E]{tokens: tokenSource(cfg.OAuth2), build: build}
+}
+
+// exporter returns the exporter to export with, built with the current token
+func (b *bearerExporter[E]) exporter(ctx context.Context) (E, error) {
+	var none E
+
+	token, err := b.tokens.Token()
+	if err != nil {
+		logging.Default().Error("Error fetching the OAuth2 token of the OTLP exporter", "error", err)
+		return none, fmt.Errorf("fetching the OAuth2 token: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.built && token.AccessToken == b.token {
+		return b.current, nil
+	}
+
+	next, err := b.build(ctx, map[string]string{"Authorization": token.Type() + " " + token.AccessToken})
+	if err != nil {
+		return none, err
+	}
+
+	// the exports of a signal are made one at a time, nothing is in flight
+	// on the previous exporter
+	if b.built {
+		b.current.Shutdown(ctx)
+	}
+	b.current, b.token, b.built = next, token.AccessToken, true
+
+	return next, nil
+}
+
+func (b *bearerExporter[E]) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.built {
+		return nil
+	}
+	return b.current.Shutdown(ctx)
+}
+
+// bearerSpanExporter is a span exporter authenticating with OAuth2
+type bearerSpanExporter struct {
+	*bearerExporter[sdktrace.SpanExporter]
+}
+
+func (e bearerSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	exporter, err := e.exporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	return exporter.ExportSpans(ctx, spans)
+}
+
+// bearerMetricExporter is a metric exporter authenticating with OAuth2. The
+// temporality and aggregation are those the exporters are built with, they're
+// asked for before the first export.
+type bearerMetricExporter struct {
+	*bearerExporter[sdkmetric.Exporter]
+	temporality sdkmetric.TemporalitySelector
+	aggregation sdkmetric.AggregationSelector
+}
+
+func (e bearerMetricExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.temporality(kind)
+}
+
+func (e bearerMetricExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return e.aggregation(kind)
+}
+
+func (e bearerMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	exporter, err := e.exporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	return exporter.Export(ctx, rm)
+}
+
+func (e bearerMetricExporter) ForceFlush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.built {
+		return nil
+	}
+	return e.current.ForceFlush(ctx)
+}
+
+// bearerLogExporter is a log exporter authenticating with OAuth2
+type bearerLogExporter struct {
+	*bearerExporter[sdklog.Exporter]
+}
+
+func (e bearerLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	exporter, err := e.exporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	return exporter.Export(ctx, records)
+}
+
+func (e bearerLogExporter) ForceFlush(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.built {
+		return nil
+	}
+	return e.current.ForceFlush(ctx)
+}
+
+// oauth2Credentials adds the bearer token to every gRPC export, gRPC asking
+// for it per call
+type oauth2Credentials struct {
+	tokens oauth2.TokenSource
+}
+
+func (c oauth2Credentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := c.tokens.Token()
+	if err != nil {
+		logging.Default().Error("Error fetching the OAuth2 token of the OTLP exporter", "error", err)
+		return nil, fmt.Errorf("fetching the OAuth2 token: %w", err)
+	}
+
+	return map[string]string{"authorization": token.Type() + " " + token.AccessToken}, nil
+}
+
+// RequireTransportSecurity keeps gRPC from sending the token over a
+// connection without TLS, Validate asks for Config.TLS along with OAuth2
+func (c oauth2Credentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,177 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tokenServer is an OAuth2 token endpoint issuing tok-1, tok-2... valid for
+// expiresIn seconds
+type tokenServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	issued   int
+	audience string
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" {
+			http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.issued++
+		token := fmt.Sprintf("tok-%d", s.issued)
+		s.audience = r.FormValue("audience")
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":%d}`, token, expiresIn)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *tokenServer) tokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issued
+}
+
+// headerExporter remembers the headers it was built with
+type headerExporter struct {
+	authorization string
+	shutdowns     int
+}
+
+func (e *headerExporter) Shutdown(context.Context) error {
+	e.shutdowns++
+	return nil
+}
+
+func newTestBearerExporter(s *tokenServer) (*bearerExporter[*headerExporter], *[]*headerExporter) {
+	cfg := Config{OAuth2: OAuth2Config{TokenURL: s.URL, ClientID: "client", ClientSecret: "secret", Audience: "otlp"}}
+
+	var built []*headerExporter
+	b := newBearerExporter(cfg, func(_ context.Context, headers map[string]string) (*headerExporter, error) {
+		e := &headerExporter{authorization: headers["Authorization"]}
+		built = append(built, e)
+		return e, nil
+	})
+
+	return b, &built
+}
+
+func TestBearerExporterReusesToken(t *testing.T) {
+	s := newTokenServer(t, 3600)
+	b, built := newTestBearerExporter(s)
+
+	for i := 0; i < 3; i++ {
+		e, err := b.exporter(context.Background())
+		if err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+		if e.authorization != "Bearer tok-1" {
+			t.Errorf("export %d went with %q, want Bearer tok-1", i, e.authorization)
+		}
+	}
+
+	if n := s.tokens(); n != 1 {
+		t.Errorf("fetched %d tokens, want 1", n)
+	}
+	if len(*built) != 1 {
+		t.Errorf("built %d exporters, want 1", len(*built))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audience != "otlp" {
+		t.Errorf("the token request had audience %q, want otlp", s.audience)
+	}
+}
+
+func TestBearerExporterRotatesToken(t *testing.T) {
+	// tokens expiring within tokenRefreshMargin are replaced on every export
+	s := newTokenServer(t, int(tokenRefreshMargin.Seconds()/2))
+	b, built := newTestBearerExporter(s)
+
+	for i := 1; i <= 3; i++ {
+		e, err := b.exporter(context.Background())
+		if err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("Bearer tok-%d", i); e.authorization != want {
+			t.Errorf("export %d went with %q, want %q", i, e.authorization, want)
+		}
+	}
+
+	if len(*built) != 3 {
+		t.Fatalf("built %d exporters, want one per token", len(*built))
+	}
+	for i, e := range (*built)[:2] {
+		if e.shutdowns != 1 {
+			t.Errorf("exporter %d was shut down %d times after its token was replaced, want once", i+1, e.shutdowns)
+		}
+	}
+
+	current := (*built)[2]
+	if current.shutdowns != 0 {
+		t.Errorf("the current exporter was shut down %d times before Shutdown", current.shutdowns)
+	}
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if current.shutdowns != 1 {
+		t.Errorf("Shutdown shut the current exporter down %d times, want once", current.shutdowns)
+	}
+}
+
+func TestBearerExporterTokenError(t *testing.T) {
+	s := newTokenServer(t, 3600)
+	cfg := Config{OAuth2: OAuth2Config{TokenURL: s.URL, ClientID: "client", ClientSecret: "wrong"}}
+
+	var built int
+	b := newBearerExporter(cfg, func(context.Context, map[string]string) (*headerExporter, error) {
+		built++
+		return &headerExporter{}, nil
+	})
+
+	if _, err := b.exporter(context.Background()); err == nil || !strings.Contains(err.Error(), "OAuth2 token") {
+		t.Errorf("exporting with rejected credentials returned %v, want the token error", err)
+	}
+	if built != 0 {
+		t.Errorf("built %d exporters without a token, want none", built)
+	}
+}
+
+func TestOAuth2RequiresTLS(t *testing.T) {
+	cfg := ConfigFromEnv("test")
+	cfg.OAuth2 = OAuth2Config{TokenURL: "https://idp.example.com/token", ClientID: "client", ClientSecret: "secret"}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "OTEL_EXPORTER_OTLP_INSECURE=false") {
+		t.Errorf("Validate of OAuth2 without TLS returned %v, want it rejected", err)
+	}
+
+	cfg.TLS = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate of OAuth2 over TLS returned %v", err)
+	}
+
+	if !(oauth2Credentials{}).RequireTransportSecurity() {
+		t.Error("the gRPC credentials don't require TLS")
+	}
+}
@@ -2,15 +2,16 @@ package tel
 
 import (
 	"context"
-	"fmt"
 	"os"
 
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"google.golang.org/grpc"
 )
 
 func InitTracerGRPC() *sdktrace.TracerProvider {
@@ -36,7 +37,7 @@ func InitTracerGRPC() *sdktrace.TracerProvider {
 	)
 
 	if err != nil {
-		fmt.Println("Error creating HTTP OTLP exporter: ", err)
+		logging.Default().Error("Error creating HTTP OTLP exporter", "error", err)
 	}
 
 	res := resource.NewWithAttributes(
@@ -54,3 +55,30 @@ func InitTracerGRPC() *sdktrace.TracerProvider {
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 	return tp
 }
+
+// newOTLPGRPCExporter exports over OTLP/gRPC to cfg.GRPCEndpoint, or to the
+// unix socket at cfg.UnixSocket, dialing with cfg.Dialer when it's set.
+func newOTLPGRPCExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	endpoint := cfg.GRPCEndpoint
+	if cfg.UnixSocket != "" {
+		endpoint = "unix:" + cfg.UnixSocket
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithHeaders(exportHeaders(cfg, map[string]string{"organization": "default"})),
+	}
+	if !cfg.TLS {
+		opts = append(opts, otlptracegrpc.WithInsecure()) // use http & not https
+	}
+	// gRPC asks for the token on every call, the exporter doesn't have to
+	// be rebuilt like the OTLP/HTTP ones
+	if cfg.OAuth2.Enabled() {
+		opts = append(opts, otlptracegrpc.WithDialOption(grpc.WithPerRPCCredentials(oauth2Credentials{tokens: tokenSource(cfg.OAuth2)})))
+	}
+	if cfg.Dialer != nil {
+		opts = append(opts, otlptracegrpc.WithDialOption(grpc.WithContextDialer(cfg.Dialer)))
+	}
+
+	return otlptracegrpc.New(ctx, opts...)
+}
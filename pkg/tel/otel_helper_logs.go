@@ -0,0 +1,51 @@
+package tel
+
+import (
+	"context"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// InitLogger sets up the logs pipeline as described by cfg
+func InitLogger(cfg Config) *sdklog.LoggerProvider {
+	opts := []sdklog.LoggerProviderOption{
+		sdklog.WithResource(newResource(cfg)),
+	}
+
+	build := func(ctx context.Context, headers map[string]string) (sdklog.Exporter, error) {
+		opts := []otlploghttp.Option{
+			otlploghttp.WithEndpoint(cfg.Endpoint),
+			otlploghttp.WithURLPath(logsURLPath),
+			otlploghttp.WithHeaders(headers),
+		}
+		if !cfg.TLS {
+			opts = append(opts, otlploghttp.WithInsecure()) // use http & not https
+		}
+		return otlploghttp.New(ctx, opts...)
+	}
+
+	var exporter sdklog.Exporter
+	var err error
+	if cfg.OAuth2.Enabled() {
+		exporter = bearerLogExporter{newBearerExporter(cfg, build)}
+	} else {
+		exporter, err = build(context.TODO(), exportHeaders(cfg, nil))
+	}
+	if err != nil {
+		logging.Default().Error("Error creating HTTP OTLP log exporter", "error", err)
+	} else {
+		var processor sdklog.Processor = sdklog.NewBatchProcessor(exporter)
+		if !cfg.LogAttributes.IsZero() {
+			processor = filteringLogProcessor{Processor: processor, filter: cfg.LogAttributes}
+		}
+		opts = append(opts, sdklog.WithProcessor(processor))
+	}
+
+	lp := sdklog.NewLoggerProvider(opts...)
+	global.SetLoggerProvider(lp)
+
+	return lp
+}
@@ -0,0 +1,69 @@
+package tel
+
+import (
+	"context"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// InitMeter sets up the metrics pipeline as described by cfg
+func InitMeter(cfg Config) *sdkmetric.MeterProvider {
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(newResource(cfg)),
+	}
+
+	exporterOpts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(cfg.Endpoint),
+		otlpmetrichttp.WithURLPath(metricsURLPath),
+	}
+	if !cfg.TLS {
+		exporterOpts = append(exporterOpts, otlpmetrichttp.WithInsecure()) // use http & not https
+	}
+
+	// Backends like Datadog want deltas where Prometheus wants cumulative sums
+	temporality, err := temporalitySelector(cfg.MetricTemporality, cfg.MetricTemporalityByKind)
+	if err != nil {
+		logging.Default().Error("Ignoring the metric temporality settings", "error", err)
+		temporality = sdkmetric.DefaultTemporalitySelector
+	}
+	exporterOpts = append(exporterOpts, otlpmetrichttp.WithTemporalitySelector(temporality))
+
+	aggregation, err := aggregationSelector(cfg.HistogramAggregation, cfg.MetricAggregationByKind)
+	if err != nil {
+		logging.Default().Error("Ignoring the metric aggregation settings", "error", err)
+		aggregation = sdkmetric.DefaultAggregationSelector
+	}
+	exporterOpts = append(exporterOpts, otlpmetrichttp.WithAggregationSelector(aggregation))
+
+	build := func(ctx context.Context, headers map[string]string) (sdkmetric.Exporter, error) {
+		return otlpmetrichttp.New(ctx, append(exporterOpts, otlpmetrichttp.WithHeaders(headers))...)
+	}
+
+	var exporter sdkmetric.Exporter
+	if cfg.OAuth2.Enabled() {
+		exporter = bearerMetricExporter{bearerExporter: newBearerExporter(cfg, build), temporality: temporality, aggregation: aggregation}
+	} else {
+		exporter, err = build(context.TODO(), exportHeaders(cfg, nil))
+	}
+	if err != nil {
+		logging.Default().Error("Error creating HTTP OTLP metric exporter", "error", err)
+	} else {
+		if len(cfg.StaticAttributes) > 0 {
+			exporter = staticAttributeExporter{Exporter: exporter, attrs: cfg.StaticAttributes}
+		}
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	}
+
+	if !cfg.MetricAttributes.IsZero() {
+		opts = append(opts, sdkmetric.WithView(metricAttributeView(cfg.MetricAttributes)))
+	}
+
+	mp := sdkmetric.NewMeterProvider(opts...)
+	otel.SetMeterProvider(mp)
+	registerCapacityGauges()
+
+	return mp
+}
@@ -0,0 +1,124 @@
+package tel
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// newOTLPJSONExporter exports to endpoint over OTLP/HTTP with the JSON encoding,
+// for collectors and debugging proxies that don't take protobuf. The SDK only
+// ships the protobuf encoding, so the client posting the requests is ours.
+func newOTLPJSONExporter(ctx context.Context, endpoint string, secure bool, proxy otlptracehttp.HTTPTransportProxyFunc, headers map[string]string) (sdktrace.SpanExporter, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+
+	return otlptrace.New(ctx, &jsonTraceClient{
+		url:     scheme + endpoint + tracesURLPath,
+		headers: headers,
+		client:  &http.Client{Transport: transport},
+	})
+}
+
+// jsonTraceClient uploads the spans as OTLP/JSON requests
+type jsonTraceClient struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (c *jsonTraceClient) Start(context.Context) error { return nil }
+
+func (c *jsonTraceClient) Stop(context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *jsonTraceClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	body, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OTLP/JSON export failed with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	return nil
+}
+
+// otlpIDFields are the bytes fields OTLP/JSON wants hex encoded, where
+// protojson writes base64
+var otlpIDFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// marshalOTLPJSON encodes req the way the OTLP/JSON spec asks: protojson with
+// the enums as numbers, and the trace and span ids in hex
+func marshalOTLPJSON(req *coltracepb.ExportTraceServiceRequest) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	hexIDs(doc)
+
+	return json.Marshal(doc)
+}
+
+func hexIDs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if s, ok := field.(string); ok && otlpIDFields[k] {
+				if id, err := base64.StdEncoding.DecodeString(s); err == nil {
+					v[k] = hex.EncodeToString(id)
+				}
+				continue
+			}
+			hexIDs(field)
+		}
+	case []any:
+		for _, item := range v {
+			hexIDs(item)
+		}
+	}
+}
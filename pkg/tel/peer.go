@@ -0,0 +1,123 @@
+package tel
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/conventions"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// peerServices maps "host:port" (or just "host") of a downstream dependency to
+// its logical service name, used for peer.service on outbound spans.
+var (
+	peerServicesMu sync.RWMutex
+	peerServices   = parsePeerServiceMapping(os.Getenv("OTEL_PEER_SERVICE_MAPPING"))
+)
+
+// parsePeerServiceMapping parses a comma separated list of addr=name pairs,
+// e.g. "localhost:8081=userstore,localhost:27017=mongodb"
+func parsePeerServiceMapping(mapping string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(mapping, ",") {
+		addr, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || addr == "" || name == "" {
+			continue
+		}
+		m[addr] = name
+	}
+
+	return m
+}
+
+// RegisterPeerService maps addr to a peer.service name unless the mapping from
+// OTEL_PEER_SERVICE_MAPPING already covers it, so the env always takes priority.
+func RegisterPeerService(addr, name string) {
+	peerServicesMu.Lock()
+	defer peerServicesMu.Unlock()
+
+	if _, ok := peerServices[addr]; !ok {
+		peerServices[addr] = name
+	}
+}
+
+// PeerService returns the peer.service name configured for host and port,
+// falling back to a host-only entry. It returns "" if there is no mapping.
+func PeerService(host, port string) string {
+	peerServicesMu.RLock()
+	defer peerServicesMu.RUnlock()
+
+	if name, ok := peerServices[net.JoinHostPort(host, port)]; ok {
+		return name
+	}
+
+	return peerServices[host]
+}
+
+// PeerAttributes returns server.address, server.port and, when mapped,
+// peer.service for an outbound call to host and port.
+func PeerAttributes(host, port string) []attribute.KeyValue {
+	attrs := conventions.Add(nil, conventions.Recommended,
+		attribute.String("server.address", host),
+		attribute.String("server.port", port),
+	)
+
+	if name := PeerService(host, port); name != "" {
+		attrs = conventions.Add(attrs, conventions.Recommended, attribute.String("peer.service", name))
+	}
+
+	return attrs
+}
+
+// clientRetry is the retry config of the transports of NewTransport
+var clientRetry = RetryConfigFromEnv()
+
+// NewTransport wraps base with otelhttp so each outbound request gets a CLIENT
+// span carrying the peer attributes of the host it's sent to. Idempotent
+// requests failing with a network error, 429, 502, 503 or 504 are sent again
+// as set by RetryConfigFromEnv, each resend in its own span.
+func NewTransport(base http.RoundTripper, opts ...otelhttp.Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	opts = append([]otelhttp.Option{
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	}, opts...)
+
+	return retryTransport{next: otelhttp.NewTransport(peerTransport{base: base}, opts...), cfg: clientRetry}
+}
+
+// peerTransport runs inside the otelhttp transport, where the request context
+// already holds the client span.
+type peerTransport struct {
+	base http.RoundTripper
+}
+
+func (t peerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	port := r.URL.Port()
+	if port == "" {
+		port = "80"
+		if r.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(PeerAttributes(r.URL.Hostname(), port)...)
+	if n, ok := r.Context().Value(resendKey{}).(int); ok {
+		span.SetAttributes(attribute.Int("http.request.resend_count", n))
+	}
+	if span.IsRecording() {
+		r = r.WithContext(httptrace.WithClientTrace(r.Context(), withClientPhases(span)))
+	}
+	return t.base.RoundTrip(r)
+}
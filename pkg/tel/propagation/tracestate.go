@@ -0,0 +1,227 @@
+// Package propagation reads and writes vendor entries of the W3C tracestate
+// carried by the span context, so they're propagated to downstream services
+// along with the trace.
+//
+// A span's tracestate can't change once it has started: the Set functions
+// return a context whose span reports the new tracestate, for starting child
+// spans and injecting outgoing requests, and the entry is then carried by
+// every descendant. The span of the context still records, but is exported
+// with the tracestate it started with.
+package propagation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// VendorKey is the tracestate key holding this service's fields, as
+// semicolon separated "field:value" pairs (e.g. "nsem=p:1;t:eu-3")
+const VendorKey = "nsem"
+
+// Fields stored under VendorKey
+const (
+	samplingPriorityField = "p"
+	tenantShardField      = "t"
+)
+
+// Limits of the W3C Trace Context specification
+const (
+	maxKeyLen    = 256
+	maxTenantLen = 241
+	maxSystemLen = 14
+	maxValueLen  = 256
+)
+
+// ValidateKey checks key against the tracestate key grammar: a lowercase
+// simple key, or a multi-tenant "tenant@system" key.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("tracestate key is empty")
+	}
+	if len(key) > maxKeyLen {
+		return fmt.Errorf("tracestate key %q is longer than %d characters", key, maxKeyLen)
+	}
+
+	tenant, system, multiTenant := strings.Cut(key, "@")
+	if !multiTenant {
+		if !isLowerAlpha(key[0]) || !validKeyChars(key[1:]) {
+			return fmt.Errorf("tracestate key %q must start with a lowercase letter and contain only a-z, 0-9, _, -, * and /", key)
+		}
+		return nil
+	}
+
+	if tenant == "" || len(tenant) > maxTenantLen || !(isLowerAlpha(tenant[0]) || isDigit(tenant[0])) || !validKeyChars(tenant[1:]) {
+		return fmt.Errorf("tracestate key %q has an invalid tenant id", key)
+	}
+	if system == "" || len(system) > maxSystemLen || !isLowerAlpha(system[0]) || !validKeyChars(system[1:]) {
+		return fmt.Errorf("tracestate key %q has an invalid system id", key)
+	}
+
+	return nil
+}
+
+// ValidateValue checks value against the tracestate value grammar: printable
+// ASCII without ',' and '=', not ending with a space.
+func ValidateValue(value string) error {
+	if value == "" {
+		return fmt.Errorf("tracestate value is empty")
+	}
+	if len(value) > maxValueLen {
+		return fmt.Errorf("tracestate value is longer than %d characters", maxValueLen)
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return fmt.Errorf("tracestate value %q contains an invalid character %q", value, c)
+		}
+	}
+
+	if value[len(value)-1] == ' ' {
+		return fmt.Errorf("tracestate value %q ends with a space", value)
+	}
+
+	return nil
+}
+
+func isLowerAlpha(c byte) bool { return c >= 'a' && c <= 'z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func validKeyChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isLowerAlpha(c) && !isDigit(c) && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Get returns the tracestate value of key in ctx, or "" when it isn't set
+func Get(ctx context.Context, key string) string {
+	return trace.SpanContextFromContext(ctx).TraceState().Get(key)
+}
+
+// Set puts key=value first in the tracestate of ctx, replacing any previous
+// value. When the tracestate is full its last entry is dropped. ctx is
+// returned unchanged when it has no valid span context.
+func Set(ctx context.Context, key, value string) (context.Context, error) {
+	if err := ValidateKey(key); err != nil {
+		return ctx, err
+	}
+	if err := ValidateValue(value); err != nil {
+		return ctx, err
+	}
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx, nil
+	}
+
+	ts, err := sc.TraceState().Insert(key, value)
+	if err != nil {
+		return ctx, err
+	}
+
+	return withTraceState(ctx, sc, ts), nil
+}
+
+// Delete removes key from the tracestate of ctx
+func Delete(ctx context.Context, key string) context.Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	return withTraceState(ctx, sc, sc.TraceState().Delete(key))
+}
+
+// withTraceState returns ctx with sc carrying ts, keeping it remote if it was.
+// A local span is kept, so it goes on recording through the returned context.
+func withTraceState(ctx context.Context, sc trace.SpanContext, ts trace.TraceState) context.Context {
+	sc = sc.WithTraceState(ts)
+	if sc.IsRemote() {
+		return trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if s, ok := span.(traceStateSpan); ok {
+		span = s.Span
+	}
+
+	return trace.ContextWithSpan(ctx, traceStateSpan{Span: span, sc: sc})
+}
+
+// traceStateSpan is a span reporting a span context with another tracestate,
+// which its children inherit and the propagators inject
+type traceStateSpan struct {
+	trace.Span
+	sc trace.SpanContext
+}
+
+func (s traceStateSpan) SpanContext() trace.SpanContext { return s.sc }
+
+// VendorField returns a field stored under VendorKey, and whether it's set
+func VendorField(ctx context.Context, field string) (string, bool) {
+	for _, pair := range strings.Split(Get(ctx, VendorKey), ";") {
+		if name, value, ok := strings.Cut(pair, ":"); ok && name == field {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// SetVendorField stores field=value under VendorKey, keeping the other
+// fields. Neither may contain ':' or ';'.
+func SetVendorField(ctx context.Context, field, value string) (context.Context, error) {
+	if field == "" || strings.ContainsAny(field, ":;") || strings.ContainsAny(value, ":;") {
+		return ctx, fmt.Errorf("invalid vendor field %q=%q", field, value)
+	}
+
+	pairs := []string{field + ":" + value}
+	for _, pair := range strings.Split(Get(ctx, VendorKey), ";") {
+		if name, _, ok := strings.Cut(pair, ":"); ok && name != field {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return Set(ctx, VendorKey, strings.Join(pairs, ";"))
+}
+
+// SamplingPriority returns the sampling priority set upstream, if any
+func SamplingPriority(ctx context.Context) (int, bool) {
+	v, ok := VendorField(ctx, samplingPriorityField)
+	if !ok {
+		return 0, false
+	}
+
+	priority, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return priority, true
+}
+
+// SetSamplingPriority records a sampling priority for the rest of the trace
+func SetSamplingPriority(ctx context.Context, priority int) (context.Context, error) {
+	return SetVendorField(ctx, samplingPriorityField, strconv.Itoa(priority))
+}
+
+// TenantShard returns the tenant shard set upstream, if any
+func TenantShard(ctx context.Context) (string, bool) {
+	return VendorField(ctx, tenantShardField)
+}
+
+// SetTenantShard records the tenant shard serving the request for the rest of
+// the trace
+func SetTenantShard(ctx context.Context, shard string) (context.Context, error) {
+	return SetVendorField(ctx, tenantShardField, shard)
+}
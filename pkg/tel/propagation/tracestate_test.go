@@ -0,0 +1,182 @@
+package propagation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestValidateKey(t *testing.T) {
+	for _, tc := range []struct {
+		key   string
+		valid bool
+	}{
+		{key: "nsem", valid: true},
+		{key: "ot", valid: true},
+		{key: "a0_-*/", valid: true},
+		{key: "tenant@system", valid: true},
+		{key: "0tenant@system", valid: true},
+		{key: strings.Repeat("a", maxKeyLen), valid: true},
+		{key: ""},
+		{key: "Nsem"},
+		{key: "0nsem"},
+		{key: "ns.em"},
+		{key: strings.Repeat("a", maxKeyLen+1)},
+		{key: "@system"},
+		{key: "tenant@"},
+		{key: "tenant@0system"},
+		{key: "tenant@" + strings.Repeat("s", maxSystemLen+1)},
+	} {
+		if err := ValidateKey(tc.key); (err == nil) != tc.valid {
+			t.Errorf("ValidateKey(%q) = %v, want valid %t", tc.key, err, tc.valid)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{value: "p:1;t:eu-3", valid: true},
+		{value: " leading space", valid: true},
+		{value: strings.Repeat("v", maxValueLen), valid: true},
+		{value: ""},
+		{value: "a,b"},
+		{value: "a=b"},
+		{value: "trailing "},
+		{value: "tab\t"},
+		{value: "é"},
+		{value: strings.Repeat("v", maxValueLen+1)},
+	} {
+		if err := ValidateValue(tc.value); (err == nil) != tc.valid {
+			t.Errorf("ValidateValue(%q) = %v, want valid %t", tc.value, err, tc.valid)
+		}
+	}
+}
+
+// remoteContext returns a context with a remote span context carrying tracestate
+func remoteContext(t *testing.T, tracestate string) context.Context {
+	t.Helper()
+
+	ts, err := trace.ParseTraceState(tracestate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: ts,
+		Remote:     true,
+	}))
+}
+
+func TestSetVendorField(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		tracestate string
+		field      string
+		value      string
+		want       string
+	}{
+		{
+			name:  "empty tracestate",
+			field: "p", value: "1",
+			want: "nsem=p:1",
+		},
+		{
+			name:       "other fields kept",
+			tracestate: "nsem=t:eu-3",
+			field:      "p", value: "1",
+			want: "nsem=p:1;t:eu-3",
+		},
+		{
+			name:       "field replaced",
+			tracestate: "nsem=p:0;t:eu-3",
+			field:      "p", value: "1",
+			want: "nsem=p:1;t:eu-3",
+		},
+		{
+			name:       "ot subkeys kept",
+			tracestate: "ot=th:8;rv:0123456789abcd,nsem=t:eu-3",
+			field:      "p", value: "1",
+			want: "nsem=p:1;t:eu-3,ot=th:8;rv:0123456789abcd",
+		},
+		{
+			name:       "other vendors kept",
+			tracestate: "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7",
+			field:      "t", value: "eu-3",
+			want: "nsem=t:eu-3,congo=t61rcWkgMzE,rojo=00f067aa0ba902b7",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := SetVendorField(remoteContext(t, tc.tracestate), tc.field, tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sc := trace.SpanContextFromContext(ctx)
+			if got := sc.TraceState().String(); got != tc.want {
+				t.Errorf("tracestate = %q, want %q", got, tc.want)
+			}
+			if !sc.IsRemote() {
+				t.Error("the span context is no longer remote")
+			}
+			if got, ok := VendorField(ctx, tc.field); !ok || got != tc.value {
+				t.Errorf("VendorField(%q) = %q, %t, want %q", tc.field, got, ok, tc.value)
+			}
+		})
+	}
+}
+
+func TestSetVendorFieldInvalid(t *testing.T) {
+	ctx := remoteContext(t, "nsem=p:1")
+
+	for _, tc := range []struct{ field, value string }{
+		{field: "", value: "1"},
+		{field: "p:", value: "1"},
+		{field: "p", value: "1;t:x"},
+		{field: "t", value: "a,b"},
+	} {
+		got, err := SetVendorField(ctx, tc.field, tc.value)
+		if err == nil {
+			t.Errorf("SetVendorField(%q, %q) succeeded", tc.field, tc.value)
+		}
+		if state := Get(got, VendorKey); state != "p:1" {
+			t.Errorf("SetVendorField(%q, %q) changed the tracestate to %q", tc.field, tc.value, state)
+		}
+	}
+}
+
+func TestSamplingPriority(t *testing.T) {
+	for _, tc := range []struct {
+		tracestate string
+		priority   int
+		ok         bool
+	}{
+		{tracestate: "nsem=p:1;t:eu-3", priority: 1, ok: true},
+		{tracestate: "nsem=t:eu-3;p:-1", priority: -1, ok: true},
+		{tracestate: "nsem=t:eu-3"},
+		{tracestate: "nsem=p:high"},
+		{tracestate: "ot=p:1"},
+	} {
+		priority, ok := SamplingPriority(remoteContext(t, tc.tracestate))
+		if priority != tc.priority || ok != tc.ok {
+			t.Errorf("SamplingPriority(%q) = %d, %t, want %d, %t", tc.tracestate, priority, ok, tc.priority, tc.ok)
+		}
+	}
+}
+
+func TestSetWithoutSpanContext(t *testing.T) {
+	ctx, err := SetTenantShard(context.Background(), "eu-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TenantShard(ctx); ok {
+		t.Error("a tenant shard was set without a span context")
+	}
+}
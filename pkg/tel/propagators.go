@@ -0,0 +1,50 @@
+package tel
+
+import (
+	"fmt"
+
+	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// defaultPropagators returns the propagators installed when none are configured.
+// The managed backends get their native header added so that traces started by
+// load balancers and other managed services are continued.
+func defaultPropagators(exporter string) []string {
+	switch exporter {
+	case "xray":
+		return []string{"tracecontext", "baggage", "xray"}
+	case "cloudtrace":
+		return []string{"tracecontext", "baggage", "cloudtrace"}
+	default:
+		return []string{"tracecontext", "baggage"}
+	}
+}
+
+// newPropagator builds a composite propagator from the configured names
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New())
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "xray":
+			propagators = append(propagators, xray.Propagator{})
+		case "cloudtrace":
+			propagators = append(propagators, gcppropagator.CloudTraceFormatPropagator{})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
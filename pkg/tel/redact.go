@@ -0,0 +1,207 @@
+package tel
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// redacted replaces every piece of PII found in an attribute value
+const redacted = "[REDACTED]"
+
+// Redaction masks emails, phone numbers, card numbers and password hashes in
+// string attributes of spans and their events before export, and the whole
+// value of attributes named after a password or a secret
+type Redaction struct {
+	Enabled bool
+	// Exempt lists the attribute keys that are never scanned, secret keys are
+	// masked all the same
+	Exempt []string
+}
+
+// piiPattern finds one kind of PII, check weeds out false positives
+type piiPattern struct {
+	kind  string
+	re    *regexp.Regexp
+	check func(match string) bool
+}
+
+// piiPatterns are tried in order, cards before phones since a card number also
+// looks like a long phone number, and hashes first since their salt can hold
+// digits
+var piiPatterns = []piiPattern{
+	{kind: "password_hash", re: regexp.MustCompile(`\$2[aby]?\$\d{2}\$[./A-Za-z0-9]{53}|\$argon2(?:id|i|d)\$v=\d+\$m=\d+,t=\d+,p=\d+\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+`)},
+	{kind: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{kind: "credit_card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), check: luhn},
+	{kind: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`)},
+}
+
+// secretKeys are the last segments of the attribute keys whose value is
+// masked whole, e.g. user.password or http.request.body.password
+var secretKeys = map[string]bool{
+	"password":      true,
+	"passwd":        true,
+	"pwd":           true,
+	"password_hash": true,
+	"secret":        true,
+}
+
+// secretKey reports whether key names a password or a secret
+func secretKey(key attribute.Key) bool {
+	k := strings.ToLower(string(key))
+	if i := strings.LastIndexByte(k, '.'); i >= 0 {
+		k = k[i+1:]
+	}
+
+	return secretKeys[k]
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum of card numbers
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// redactingSpanExporter masks PII in the attributes of spans and their events
+type redactingSpanExporter struct {
+	sdktrace.SpanExporter
+	exempt     map[attribute.Key]bool
+	redactions metric.Int64Counter
+}
+
+func newRedactingSpanExporter(next sdktrace.SpanExporter, r Redaction) redactingSpanExporter {
+	e := redactingSpanExporter{SpanExporter: next, exempt: map[attribute.Key]bool{}}
+	for _, key := range r.Exempt {
+		e.exempt[attribute.Key(key)] = true
+	}
+
+	e.redactions, _ = otel.Meter(instrumentationName).Int64Counter("otel.sdk.span.attribute.redacted",
+		metric.WithDescription("Number of PII values masked in span attributes, by pii.type"),
+		metric.WithUnit("{redaction}"),
+	)
+
+	return e
+}
+
+func (e redactingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redactedSpans := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		// other exporters may read the same events, mask a copy
+		events := slices.Clone(span.Events())
+		for j := range events {
+			events[j].Attributes = e.redact(ctx, events[j].Attributes)
+		}
+
+		redactedSpans[i] = filteredSpan{
+			ReadOnlySpan: span,
+			attrs:        e.redact(ctx, span.Attributes()),
+			events:       events,
+		}
+	}
+
+	return e.SpanExporter.ExportSpans(ctx, redactedSpans)
+}
+
+// redact returns attrs with the PII masked, copying only when something changed
+func (e redactingSpanExporter) redact(ctx context.Context, attrs []attribute.KeyValue) []attribute.KeyValue {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		var masked attribute.Value
+		var ok bool
+		switch {
+		case secretKey(kv.Key):
+			masked, ok = e.redactSecret(ctx, kv.Value)
+		case e.exempt[kv.Key]:
+			continue
+		default:
+			masked, ok = e.redactValue(ctx, kv.Value)
+		}
+		if !ok {
+			continue
+		}
+
+		if out == nil {
+			out = append([]attribute.KeyValue(nil), attrs...)
+		}
+		out[i] = attribute.KeyValue{Key: kv.Key, Value: masked}
+	}
+
+	if out == nil {
+		return attrs
+	}
+
+	return out
+}
+
+// redactSecret masks the whole value of a secret attribute, whatever its type
+func (e redactingSpanExporter) redactSecret(ctx context.Context, v attribute.Value) (attribute.Value, bool) {
+	if v.Type() == attribute.STRING && v.AsString() == redacted {
+		return v, false
+	}
+
+	e.redactions.Add(ctx, 1, metric.WithAttributes(attribute.String("pii.type", "password")))
+	return attribute.StringValue(redacted), true
+}
+
+func (e redactingSpanExporter) redactValue(ctx context.Context, v attribute.Value) (attribute.Value, bool) {
+	switch v.Type() {
+	case attribute.STRING:
+		s, ok := e.redactString(ctx, v.AsString())
+		return attribute.StringValue(s), ok
+	case attribute.STRINGSLICE:
+		values := v.AsStringSlice()
+		changed := false
+		for i, s := range values {
+			var ok bool
+			if values[i], ok = e.redactString(ctx, s); ok {
+				changed = true
+			}
+		}
+		return attribute.StringSliceValue(values), changed
+	default:
+		return v, false
+	}
+}
+
+// redactString masks every match of the patterns in s and counts them
+func (e redactingSpanExporter) redactString(ctx context.Context, s string) (string, bool) {
+	changed := false
+	for _, p := range piiPatterns {
+		count := 0
+		s = p.re.ReplaceAllStringFunc(s, func(match string) string {
+			if p.check != nil && !p.check(match) {
+				return match
+			}
+			count++
+			return redacted
+		})
+
+		if count > 0 {
+			changed = true
+			e.redactions.Add(ctx, int64(count), metric.WithAttributes(attribute.String("pii.type", p.kind)))
+		}
+	}
+
+	return s, changed
+}
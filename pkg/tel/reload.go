@@ -0,0 +1,234 @@
+package tel
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// swappableProcessor is the span processor of the export pipeline, which a
+// reload replaces while spans keep ending
+type swappableProcessor struct {
+	// pipeline outlives the processors, its metrics keep counting across reloads
+	pipeline *pipelineTelemetry
+
+	// mu is held for reading while a span is handed to current, so the old
+	// processor gets no span once it's swapped out and shut down
+	mu      sync.RWMutex
+	current exportPipeline
+}
+
+// exportPipeline is a processor and the exporter it feeds
+type exportPipeline struct {
+	processor sdktrace.SpanProcessor
+	exporter  sdktrace.SpanExporter
+}
+
+// build makes the exporter of cfg and the processor feeding it, with the
+// provider options the exporter needs, e.g. the X-Ray id generator
+func (p *swappableProcessor) build(ctx context.Context, cfg Config) (exportPipeline, []sdktrace.TracerProviderOption, error) {
+	exporter, exporterOpts, err := newExporter(ctx, cfg)
+	if err != nil {
+		return exportPipeline{}, nil, err
+	}
+
+	// innermost so the hints aren't filtered out
+	if cfg.RetentionHints.Enabled {
+		exporter = retentionSpanExporter{SpanExporter: exporter, hints: cfg.RetentionHints}
+	}
+	if cfg.SpanRedaction.Enabled {
+		exporter = newRedactingSpanExporter(exporter, cfg.SpanRedaction)
+	}
+	if !cfg.SpanAttributes.IsZero() {
+		exporter = filteringSpanExporter{SpanExporter: exporter, filter: cfg.SpanAttributes}
+	}
+
+	var processor sdktrace.SpanProcessor
+	switch cfg.SpanProcessor {
+	case "adaptive":
+		processor = newAdaptiveSpanProcessor(p.pipeline.exporter(exporter))
+	case "simple":
+		processor = sdktrace.NewSimpleSpanProcessor(p.pipeline.exporter(exporter))
+	default:
+		processor = sdktrace.NewBatchSpanProcessor(p.pipeline.exporter(exporter), cfg.Batch.options()...)
+	}
+
+	return exportPipeline{processor: p.pipeline.processor(processor), exporter: exporter}, exporterOpts, nil
+}
+
+// swap installs next and returns the processor it replaced, nil if none
+func (p *swappableProcessor) swap(next exportPipeline) sdktrace.SpanProcessor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := p.current.processor
+	p.current = next
+	return previous
+}
+
+// verify exports a probe span straight through the exporter and returns the
+// error of the export. Flushing the processor can't tell, it has nothing to
+// export when no span ended yet and then succeeds without reaching the backend.
+func (p *swappableProcessor) verify(ctx context.Context, res *resource.Resource) error {
+	p.mu.RLock()
+	exporter := p.current.exporter
+	p.mu.RUnlock()
+
+	if exporter == nil {
+		return errors.New("tel: the span exporter couldn't be created")
+	}
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+	now := time.Now()
+
+	probe := tracetest.SpanStub{
+		Name: "exporter.verify",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+		SpanKind:               trace.SpanKindInternal,
+		StartTime:              now,
+		EndTime:                now,
+		Resource:               res,
+		InstrumentationLibrary: instrumentation.Library{Name: instrumentationName, Version: scopeVersion},
+	}
+
+	return exporter.ExportSpans(ctx, []sdktrace.ReadOnlySpan{probe.Snapshot()})
+}
+
+func (p *swappableProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current.processor != nil {
+		p.current.processor.OnStart(ctx, s)
+	}
+}
+
+func (p *swappableProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current.processor != nil {
+		p.current.processor.OnEnd(s)
+	}
+}
+
+func (p *swappableProcessor) ForceFlush(ctx context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current.processor == nil {
+		return nil
+	}
+	return p.current.processor.ForceFlush(ctx)
+}
+
+func (p *swappableProcessor) Shutdown(ctx context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current.processor == nil {
+		return nil
+	}
+	return p.current.processor.Shutdown(ctx)
+}
+
+// Reload reads the config again, from the environment and the config file
+// when Init read it there, and rebuilds the span exporter and processor from
+// it, e.g. to pick up rotated certificates or a new collector endpoint. The
+// spans ending from then on go to the new pipeline, the ones the old one
+// still holds are exported before Reload returns. The sampler, the resource
+// and the metric and log pipelines stay as Init set them up, and so do the
+// provider options of the exporter, so changing OTEL_TRACES_EXPORTER is an
+// error: the X-Ray exporter needs its id generator from the start.
+func (t *Telemetry) Reload(ctx context.Context) error {
+	if t.exports == nil {
+		return errors.New("tel: tracing isn't set up, there is nothing to reload")
+	}
+
+	cfg := t.config()
+	if t.fromEnv {
+		cfg = ConfigFromEnv(cfg.ServiceName)
+		cfg.ResourceAttributes = t.config().ResourceAttributes
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if current := t.config().Exporter; cfg.Exporter != current {
+		return fmt.Errorf("tel: the exporter can't change from %s to %s without a restart", current, cfg.Exporter)
+	}
+
+	// the provider options only depend on the exporter, they're the ones of Init
+	pipeline, _, err := t.exports.build(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	t.reloaded.Store(&cfg)
+	if previous := t.exports.swap(pipeline); previous != nil {
+		return previous.Shutdown(ctx)
+	}
+
+	return nil
+}
+
+// VerifyExporter exports a probe span named exporter.verify to the backend
+// and returns the error when it can't be reached. It does nothing when
+// tracing isn't set up.
+func (t *Telemetry) VerifyExporter(ctx context.Context) error {
+	if t.exports == nil {
+		return nil
+	}
+
+	return t.exports.verify(ctx, newResource(t.config()))
+}
+
+// ReloadOn calls Reload whenever one of sigs is received, typically SIGHUP,
+// until ctx is done
+func (t *Telemetry) ReloadOn(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				if err := t.Reload(ctx); err != nil {
+					logging.Default().Error("Keeping the telemetry config, the reload failed", "signal", sig.String(), "error", err)
+					continue
+				}
+				logging.Default().Info("Reloaded the telemetry config", "signal", sig.String(), "exporter", t.config().Exporter, "endpoint", t.config().Endpoint, "grpc_endpoint", t.config().GRPCEndpoint)
+			}
+		}
+	}()
+}
+
+// config is the config of the last reload, or the one of Init
+func (t *Telemetry) config() Config {
+	if cfg := t.reloaded.Load(); cfg != nil {
+		return *cfg
+	}
+
+	return t.cfg
+}
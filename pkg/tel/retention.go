@@ -0,0 +1,77 @@
+package tel
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// RetentionHints marks the local root span of requests worth keeping, so a
+// tail sampling collector downstream can keep their traces with a simple
+// attribute policy
+type RetentionHints struct {
+	Enabled bool
+
+	// LatencyThreshold is the duration above which a request is slow, 0 only
+	// marks errors
+	LatencyThreshold time.Duration
+}
+
+// Reasons for retaining a trace, in retain.reason
+const (
+	retainError = "error"
+	retainSlow  = "slow"
+)
+
+// retentionSpanExporter adds sampling.priority, retain and retain.reason to
+// the local root spans that errored or were slow. The SDK doesn't let a
+// processor change a span once it has ended, hence an exporter.
+type retentionSpanExporter struct {
+	sdktrace.SpanExporter
+	hints RetentionHints
+}
+
+func (e retentionSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	hinted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		hinted[i] = span
+
+		reason := e.reason(span)
+		if reason == "" {
+			continue
+		}
+
+		// appending in place could write into the array behind the span's
+		// attributes, which the other exporters read
+		attrs := append(slices.Clone(span.Attributes()),
+			attribute.Int("sampling.priority", 1),
+			attribute.Bool("retain", true),
+			attribute.String("retain.reason", reason),
+		)
+		hinted[i] = filteredSpan{ReadOnlySpan: span, attrs: attrs, events: span.Events()}
+	}
+
+	return e.SpanExporter.ExportSpans(ctx, hinted)
+}
+
+// reason tells why the trace of span should be kept, "" if it needn't or span
+// isn't the local root
+func (e retentionSpanExporter) reason(span sdktrace.ReadOnlySpan) string {
+	if parent := span.Parent(); parent.IsValid() && !parent.IsRemote() {
+		return ""
+	}
+
+	if span.Status().Code == codes.Error {
+		return retainError
+	}
+
+	if e.hints.LatencyThreshold > 0 && span.EndTime().Sub(span.StartTime()) > e.hints.LatencyThreshold {
+		return retainSlow
+	}
+
+	return ""
+}
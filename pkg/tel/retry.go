@@ -0,0 +1,167 @@
+package tel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RetryConfig is how NewTransport resends idempotent requests that failed
+type RetryConfig struct {
+	// MaxResends is the number of resends after the first attempt, 0 turns
+	// retries off
+	MaxResends int
+	// Backoff is the wait before the first resend, doubled for each next one
+	// and jittered
+	Backoff time.Duration
+}
+
+// RetryConfigFromEnv reads HTTP_CLIENT_MAX_RESENDS (default 2) and
+// HTTP_CLIENT_RETRY_BACKOFF (default 100ms)
+func RetryConfigFromEnv() RetryConfig {
+	cfg := RetryConfig{MaxResends: 2, Backoff: 100 * time.Millisecond}
+
+	if v, err := strconv.Atoi(os.Getenv("HTTP_CLIENT_MAX_RESENDS")); err == nil && v >= 0 {
+		cfg.MaxResends = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("HTTP_CLIENT_RETRY_BACKOFF")); err == nil && v > 0 {
+		cfg.Backoff = v
+	}
+
+	return cfg
+}
+
+// retryableStatus are the answers worth sending the request again for, the
+// server or a proxy in front of it being unavailable for a moment
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// maxRetryWait bounds the wait between two attempts, whatever the server asks
+const maxRetryWait = 10 * time.Second
+
+// resendKey holds the number of times the request was sent before, for the
+// client span of the attempt
+type resendKey struct{}
+
+var (
+	resendsOnce sync.Once
+	resends     metric.Int64Counter
+)
+
+// retryTransport runs outside the otelhttp transport, so every attempt gets a
+// client span of its own, the resends with http.request.resend_count
+type retryTransport struct {
+	next http.RoundTripper
+	cfg  RetryConfig
+}
+
+func (t retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.cfg.MaxResends == 0 || !idempotent(r) || (r.Body != nil && r.Body != http.NoBody && r.GetBody == nil) {
+		return t.next.RoundTrip(r)
+	}
+
+	resendsOnce.Do(func() {
+		resends, _ = otel.Meter(instrumentationName).Int64Counter("http.client.request.resends",
+			metric.WithDescription("Number of HTTP requests sent again after a failed attempt, by the error.type of that attempt"),
+			metric.WithUnit("{request}"),
+		)
+	})
+
+	ctx := r.Context()
+	for attempt := 0; ; attempt++ {
+		req := r
+		if attempt > 0 {
+			req = r.Clone(context.WithValue(ctx, resendKey{}, attempt))
+			if r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		errorType := retryReason(ctx, resp, err)
+		if errorType == "" || attempt == t.cfg.MaxResends {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		resends.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("server.address", r.URL.Hostname()),
+			attribute.String("error.type", errorType),
+		))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+// backoff is the wait before resend attempt+1: the Retry-After of the answer
+// when it gives seconds, else the doubled backoff with full jitter, at most
+// maxRetryWait
+func (t retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			return min(time.Duration(s)*time.Second, maxRetryWait)
+		}
+	}
+	if t.cfg.Backoff <= 0 {
+		return 0
+	}
+
+	return min(time.Duration(rand.Int64N(int64(t.cfg.Backoff<<attempt))), maxRetryWait)
+}
+
+// retryReason returns the error.type of a failed attempt worth repeating, ""
+// when the attempt succeeded, or failed in a way resending won't fix
+func retryReason(ctx context.Context, resp *http.Response, err error) string {
+	if err != nil {
+		// the caller gave up, resending would ignore it
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return ""
+		}
+		return fmt.Sprintf("%T", err)
+	}
+
+	if retryableStatus[resp.StatusCode] {
+		return strconv.Itoa(resp.StatusCode)
+	}
+
+	return ""
+}
+
+// idempotent reports whether r can be sent twice without changing the
+// outcome: the idempotent methods of RFC 9110, or any request carrying an
+// Idempotency-Key
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return r.Header.Get("Idempotency-Key") != ""
+}
@@ -0,0 +1,65 @@
+package tel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// routeSamplers are the samplers registered with SampleRoute, by "METHOD route"
+var routeSamplers sync.Map
+
+// SampleRoute hands the decision for the server spans of method and route to
+// sampler instead of the configured one. The routes are only known once the
+// router is set up, after Init, so they are registered here rather than in
+// Config.
+func SampleRoute(method, route string, sampler sdktrace.Sampler) {
+	routeSamplers.Store(method+" "+route, sampler)
+}
+
+// routeSampler looks the server spans up in routeSamplers by their
+// http.request.method and http.route start attributes
+type routeSampler struct {
+	next sdktrace.Sampler
+}
+
+func (s routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Kind != trace.SpanKindServer {
+		return s.next.ShouldSample(p)
+	}
+
+	var method, route string
+	for _, kv := range p.Attributes {
+		switch kv.Key {
+		case "http.request.method":
+			method = kv.Value.AsString()
+		case "http.route":
+			route = kv.Value.AsString()
+		}
+	}
+	if route != "" {
+		if sampler, ok := routeSamplers.Load(method + " " + route); ok {
+			return sampler.(sdktrace.Sampler).ShouldSample(p)
+		}
+	}
+
+	return s.next.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	var routes []string
+	routeSamplers.Range(func(key, value any) bool {
+		routes = append(routes, fmt.Sprintf("%s:%s", key, value.(sdktrace.Sampler).Description()))
+		return true
+	})
+	if len(routes) == 0 {
+		return s.next.Description()
+	}
+	sort.Strings(routes)
+
+	return fmt.Sprintf("RouteBased{%s;fallback:%s}", strings.Join(routes, ","), s.next.Description())
+}
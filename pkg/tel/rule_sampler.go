@@ -0,0 +1,210 @@
+package tel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// SamplingRule hands the spans whose Attribute matches Pattern, and of Kind
+// when it's set, to Sampler
+type SamplingRule struct {
+	Attribute attribute.Key
+	Pattern   *regexp.Regexp
+	Kind      trace.SpanKind
+	Sampler   sdktrace.Sampler
+}
+
+// NewRuleBasedSampler samples each span with the sampler of the first rule
+// matching its start attributes, or with fallback. With http.route rules the
+// routes get their own sampling decisions, e.g. dropping the health checks
+// and keeping every write.
+func NewRuleBasedSampler(fallback sdktrace.Sampler, rules ...SamplingRule) sdktrace.Sampler {
+	return ruleBasedSampler{rules: rules, fallback: fallback}
+}
+
+type ruleBasedSampler struct {
+	rules    []SamplingRule
+	fallback sdktrace.Sampler
+}
+
+func (s ruleBasedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, rule := range s.rules {
+		if rule.Kind != trace.SpanKindUnspecified && rule.Kind != p.Kind {
+			continue
+		}
+		for _, kv := range p.Attributes {
+			if kv.Key == rule.Attribute && rule.Pattern.MatchString(kv.Value.Emit()) {
+				return rule.Sampler.ShouldSample(p)
+			}
+		}
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+func (s ruleBasedSampler) Description() string {
+	rules := make([]string, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, fmt.Sprintf("%s=~%s:%s", rule.Attribute, rule.Pattern, rule.Sampler.Description()))
+	}
+
+	return fmt.Sprintf("RuleBased{%s;fallback:%s}", strings.Join(rules, ","), s.fallback.Description())
+}
+
+// samplerModel is a sampler of the declarative configuration, a single key
+// naming the sampler with its arguments as the value
+type samplerModel map[string]yaml.Node
+
+func (m samplerModel) build() (sdktrace.Sampler, error) {
+	if len(m) != 1 {
+		return nil, fmt.Errorf("a sampler needs exactly one type, got %d", len(m))
+	}
+
+	for kind, node := range m {
+		switch kind {
+		case "always_on":
+			return sdktrace.AlwaysSample(), nil
+		case "always_off":
+			return sdktrace.NeverSample(), nil
+		case "trace_id_ratio_based", "consistent_probability":
+			var args struct {
+				Ratio *float64 `yaml:"ratio"`
+			}
+			if err := node.Decode(&args); err != nil {
+				return nil, fmt.Errorf("%s: %w", kind, err)
+			}
+			ratio := 1.0
+			if args.Ratio != nil {
+				ratio = *args.Ratio
+			}
+			if ratio < 0 || ratio > 1 {
+				return nil, fmt.Errorf("%s: ratio %v must be between 0 and 1", kind, ratio)
+			}
+			if kind == "consistent_probability" {
+				return NewConsistentProbabilitySampler(ratio), nil
+			}
+			return sdktrace.TraceIDRatioBased(ratio), nil
+		case "parent_based":
+			return buildParentBased(node)
+		case "rule_based":
+			return buildRuleBased(node)
+		default:
+			return nil, fmt.Errorf("unknown sampler %q", kind)
+		}
+	}
+
+	return nil, nil
+}
+
+func buildParentBased(node yaml.Node) (sdktrace.Sampler, error) {
+	var args struct {
+		Root                   *samplerModel `yaml:"root"`
+		RemoteParentSampled    *samplerModel `yaml:"remote_parent_sampled"`
+		RemoteParentNotSampled *samplerModel `yaml:"remote_parent_not_sampled"`
+		LocalParentSampled     *samplerModel `yaml:"local_parent_sampled"`
+		LocalParentNotSampled  *samplerModel `yaml:"local_parent_not_sampled"`
+	}
+	if err := node.Decode(&args); err != nil {
+		return nil, fmt.Errorf("parent_based: %w", err)
+	}
+
+	root := sdktrace.AlwaysSample()
+	if args.Root != nil {
+		var err error
+		if root, err = args.Root.build(); err != nil {
+			return nil, fmt.Errorf("parent_based.root: %w", err)
+		}
+	}
+
+	var opts []sdktrace.ParentBasedSamplerOption
+	for _, o := range []struct {
+		name  string
+		model *samplerModel
+		opt   func(sdktrace.Sampler) sdktrace.ParentBasedSamplerOption
+	}{
+		{"remote_parent_sampled", args.RemoteParentSampled, sdktrace.WithRemoteParentSampled},
+		{"remote_parent_not_sampled", args.RemoteParentNotSampled, sdktrace.WithRemoteParentNotSampled},
+		{"local_parent_sampled", args.LocalParentSampled, sdktrace.WithLocalParentSampled},
+		{"local_parent_not_sampled", args.LocalParentNotSampled, sdktrace.WithLocalParentNotSampled},
+	} {
+		if o.model == nil {
+			continue
+		}
+		s, err := o.model.build()
+		if err != nil {
+			return nil, fmt.Errorf("parent_based.%s: %w", o.name, err)
+		}
+		opts = append(opts, o.opt(s))
+	}
+
+	return sdktrace.ParentBased(root, opts...), nil
+}
+
+// spanKinds are the span_kind values of the rules
+var spanKinds = map[string]trace.SpanKind{
+	"server":   trace.SpanKindServer,
+	"client":   trace.SpanKindClient,
+	"internal": trace.SpanKindInternal,
+	"producer": trace.SpanKindProducer,
+	"consumer": trace.SpanKindConsumer,
+}
+
+// buildRuleBased reads a rule_based sampler, modeled on the rule based
+// routing sampler of opentelemetry-java-contrib:
+//
+//	rule_based:
+//	  rules:
+//	    - attribute: http.route
+//	      pattern: ^/healthz$
+//	      sampler: {always_off: {}}
+//	  fallback: {always_on: {}}
+func buildRuleBased(node yaml.Node) (sdktrace.Sampler, error) {
+	var args struct {
+		Rules []struct {
+			Attribute string       `yaml:"attribute"`
+			Pattern   string       `yaml:"pattern"`
+			SpanKind  string       `yaml:"span_kind"`
+			Sampler   samplerModel `yaml:"sampler"`
+		} `yaml:"rules"`
+		Fallback *samplerModel `yaml:"fallback"`
+	}
+	if err := node.Decode(&args); err != nil {
+		return nil, fmt.Errorf("rule_based: %w", err)
+	}
+
+	fallback := sdktrace.AlwaysSample()
+	if args.Fallback != nil {
+		var err error
+		if fallback, err = args.Fallback.build(); err != nil {
+			return nil, fmt.Errorf("rule_based.fallback: %w", err)
+		}
+	}
+
+	rules := make([]SamplingRule, 0, len(args.Rules))
+	for i, r := range args.Rules {
+		if r.Attribute == "" {
+			return nil, fmt.Errorf("rule_based.rules[%d]: attribute is required", i)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule_based.rules[%d].pattern: %w", i, err)
+		}
+		kind, ok := spanKinds[r.SpanKind]
+		if r.SpanKind != "" && !ok {
+			return nil, fmt.Errorf("rule_based.rules[%d]: unknown span_kind %q", i, r.SpanKind)
+		}
+		sampler, err := r.Sampler.build()
+		if err != nil {
+			return nil, fmt.Errorf("rule_based.rules[%d].sampler: %w", i, err)
+		}
+		rules = append(rules, SamplingRule{Attribute: attribute.Key(r.Attribute), Pattern: pattern, Kind: kind, Sampler: sampler})
+	}
+
+	return NewRuleBasedSampler(fallback, rules...), nil
+}
@@ -0,0 +1,155 @@
+package tel
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Consistent probability sampling (OTEP 235). Every span compares the same
+// 56 bits of randomness R, taken from the trace ID or the rv sub-key, against a
+// rejection threshold T and is sampled when R >= T. The threshold is written
+// to the "ot" tracestate entry as th so collectors can compute adjusted counts.
+const (
+	otKey          = "ot"
+	thresholdField = "th"
+	randomField    = "rv"
+
+	randomnessBits = 56
+	maxThreshold   = uint64(1) << randomnessBits
+	thresholdHex   = randomnessBits / 4
+)
+
+// newSampler returns cfg.TraceSampler, or the sampler named by cfg.Sampler,
+// defaulting to always on
+func newSampler(cfg Config) (sdktrace.Sampler, error) {
+	if cfg.TraceSampler != nil {
+		return cfg.TraceSampler, nil
+	}
+
+	switch cfg.Sampler {
+	case "", "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "consistent_probability":
+		return NewConsistentProbabilitySampler(cfg.SamplerRatio), nil
+	case "parentbased_consistent_probability":
+		return sdktrace.ParentBased(NewConsistentProbabilitySampler(cfg.SamplerRatio)), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", cfg.Sampler)
+	}
+}
+
+type consistentProbabilitySampler struct {
+	ratio     float64
+	threshold uint64
+	th        string
+}
+
+// NewConsistentProbabilitySampler samples traces with probability ratio,
+// recording the sampling threshold in tracestate.
+func NewConsistentProbabilitySampler(ratio float64) sdktrace.Sampler {
+	s := &consistentProbabilitySampler{ratio: ratio}
+
+	switch {
+	case ratio >= 1:
+		s.threshold = 0
+	case ratio <= 0:
+		s.threshold = maxThreshold
+	default:
+		s.threshold = uint64(math.Round((1 - ratio) * float64(maxThreshold)))
+	}
+
+	s.th = encodeThreshold(s.threshold)
+
+	return s
+}
+
+// encodeThreshold returns the th value for threshold: 14 hex digits with the
+// trailing zeros removed, and "0" for a zero threshold.
+func encodeThreshold(threshold uint64) string {
+	th := strings.TrimRight(fmt.Sprintf("%0*x", thresholdHex, threshold), "0")
+	if th == "" {
+		return "0"
+	}
+
+	return th
+}
+
+func (s *consistentProbabilitySampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	ts := psc.TraceState()
+	ot := ts.Get(otKey)
+
+	sampled := s.threshold < maxThreshold && randomness(p.TraceID, ot) >= s.threshold
+
+	decision := sdktrace.Drop
+	if sampled {
+		decision = sdktrace.RecordAndSample
+		ot = setOTField(ot, thresholdField, s.th)
+	} else {
+		// An unsampled span mustn't pass on a threshold it wasn't sampled with
+		ot = setOTField(ot, thresholdField, "")
+	}
+
+	if ot == "" {
+		ts = ts.Delete(otKey)
+	} else if updated, err := ts.Insert(otKey, ot); err == nil {
+		ts = updated
+	}
+
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: ts}
+}
+
+func (s *consistentProbabilitySampler) Description() string {
+	return fmt.Sprintf("ConsistentProbabilityBased{%g}", s.ratio)
+}
+
+// randomness returns the explicit rv value of the ot entry, or else the lowest
+// 56 bits of the trace ID
+func randomness(traceID trace.TraceID, ot string) uint64 {
+	if rv, ok := otField(ot, randomField); ok && len(rv) == thresholdHex {
+		if r, err := strconv.ParseUint(rv, 16, 64); err == nil {
+			return r
+		}
+	}
+
+	var r uint64
+	for _, b := range traceID[9:] {
+		r = r<<8 | uint64(b)
+	}
+
+	return r
+}
+
+// otField returns a sub-key of the ot tracestate value ("th:8;rv:...")
+func otField(ot, field string) (string, bool) {
+	for _, pair := range strings.Split(ot, ";") {
+		if name, value, ok := strings.Cut(pair, ":"); ok && name == field {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// setOTField sets field in the ot value, removing it when value is empty
+func setOTField(ot, field, value string) string {
+	var pairs []string
+	if value != "" {
+		pairs = append(pairs, field+":"+value)
+	}
+
+	for _, pair := range strings.Split(ot, ";") {
+		if name, _, ok := strings.Cut(pair, ":"); ok && name != field {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,80 @@
+package tel
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConsistentProbabilityThreshold(t *testing.T) {
+	for _, tc := range []struct {
+		ratio float64
+		th    string
+	}{
+		{ratio: 1, th: "0"},
+		{ratio: 2, th: "0"},
+		{ratio: 0.5, th: "8"},
+		{ratio: 0.25, th: "c"},
+		{ratio: 0.125, th: "e"},
+		{ratio: 0.1, th: "e6666666666668"},
+		// 0xaaaaaaaaaaaab0 loses its trailing zero
+		{ratio: 1.0 / 3, th: "aaaaaaaaaaaab"},
+	} {
+		s := NewConsistentProbabilitySampler(tc.ratio).(*consistentProbabilitySampler)
+		if s.th != tc.th {
+			t.Errorf("ratio %g: th = %q, want %q", tc.ratio, s.th, tc.th)
+		}
+	}
+}
+
+func TestRandomness(t *testing.T) {
+	// Only bytes 9 to 15 count, the leading ones are all set to show they're ignored
+	traceID := trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd}
+
+	for _, tc := range []struct {
+		name string
+		ot   string
+		want uint64
+	}{
+		{name: "trace id", want: 0x0123456789abcd},
+		{name: "rv", ot: "th:8;rv:fedcba98765432", want: 0xfedcba98765432},
+		{name: "short rv", ot: "rv:fedcba", want: 0x0123456789abcd},
+		{name: "malformed rv", ot: "rv:fedcba9876543z", want: 0x0123456789abcd},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := randomness(traceID, tc.ot); got != tc.want {
+				t.Errorf("randomness() = %014x, want %014x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsistentProbabilityShouldSample(t *testing.T) {
+	sampler := NewConsistentProbabilitySampler(0.5)
+
+	for _, tc := range []struct {
+		name       string
+		random     [7]byte
+		decision   sdktrace.SamplingDecision
+		tracestate string
+	}{
+		{name: "at threshold", random: [7]byte{0x80}, decision: sdktrace.RecordAndSample, tracestate: "ot=th:8"},
+		{name: "above threshold", random: [7]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, decision: sdktrace.RecordAndSample, tracestate: "ot=th:8"},
+		{name: "below threshold", random: [7]byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, decision: sdktrace.Drop, tracestate: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var traceID trace.TraceID
+			copy(traceID[9:], tc.random[:])
+
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), TraceID: traceID})
+			if result.Decision != tc.decision {
+				t.Errorf("decision = %v, want %v", result.Decision, tc.decision)
+			}
+			if got := result.Tracestate.String(); got != tc.tracestate {
+				t.Errorf("tracestate = %q, want %q", got, tc.tracestate)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package tel
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// pipelineTelemetry measures the span pipeline itself: how many spans are
+// exported or dropped, how long exports take and how full the queue is, so the
+// health of the instrumentation can be monitored like the service.
+type pipelineTelemetry struct {
+	// component is the exporter name, recorded as otel.component.type
+	component string
+	attrs     metric.MeasurementOption
+
+	exported metric.Int64Counter
+	dropped  metric.Int64Counter
+	limited  metric.Int64Counter
+	duration metric.Float64Histogram
+
+	// queued is the number of spans waiting in the batch processor's queue,
+	// which holds up to capacity
+	queued   atomic.Int64
+	capacity int64
+}
+
+func newPipelineTelemetry(exporter string, capacity int) *pipelineTelemetry {
+	meter := otel.Meter(instrumentationName)
+
+	if capacity <= 0 {
+		capacity = sdktrace.DefaultMaxQueueSize
+	}
+
+	pt := &pipelineTelemetry{
+		component: exporter,
+		capacity:  int64(capacity),
+		attrs:     metric.WithAttributes(attribute.String("otel.component.type", exporter)),
+	}
+
+	pt.exported, _ = meter.Int64Counter("otel.sdk.exporter.span.exported",
+		metric.WithDescription("Number of spans handed to the exporter, with error.type set for failed exports"),
+		metric.WithUnit("{span}"),
+	)
+	pt.dropped, _ = meter.Int64Counter("otel.sdk.span.dropped",
+		metric.WithDescription("Number of spans lost because the queue was full or their export failed"),
+		metric.WithUnit("{span}"),
+	)
+	pt.limited, _ = meter.Int64Counter("otel.sdk.span.limit.dropped",
+		metric.WithDescription("Number of attributes, events and links dropped from spans over the span limits"),
+		metric.WithUnit("{item}"),
+	)
+	pt.duration, _ = meter.Float64Histogram("otel.sdk.exporter.operation.duration",
+		metric.WithDescription("Duration of span export calls"),
+		metric.WithUnit("s"),
+	)
+
+	queueSize, _ := meter.Int64ObservableGauge("otel.sdk.processor.span.queue.size",
+		metric.WithDescription("Number of spans waiting to be exported"),
+		metric.WithUnit("{span}"),
+	)
+	queueCapacity, _ := meter.Int64ObservableGauge("otel.sdk.processor.span.queue.capacity",
+		metric.WithDescription("Maximum number of spans the queue holds before dropping"),
+		metric.WithUnit("{span}"),
+	)
+	meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		o.ObserveInt64(queueSize, pt.queued.Load(), pt.attrs)
+		o.ObserveInt64(queueCapacity, pt.capacity, pt.attrs)
+		return nil
+	}, queueSize, queueCapacity)
+
+	return pt
+}
+
+// exporter wraps next so every export is measured
+func (pt *pipelineTelemetry) exporter(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return measuredSpanExporter{SpanExporter: next, pt: pt}
+}
+
+// processor wraps the batch processor bsp to follow its queue
+func (pt *pipelineTelemetry) processor(bsp sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return queueTrackingProcessor{SpanProcessor: bsp, pt: pt}
+}
+
+type measuredSpanExporter struct {
+	sdktrace.SpanExporter
+	pt *pipelineTelemetry
+}
+
+func (e measuredSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	n := int64(len(spans))
+
+	e.pt.queued.Add(-n)
+
+	// Leave the context out: the export runs in the processor, outside of any request
+	bg := context.Background()
+	if err != nil {
+		failed := metric.WithAttributes(
+			attribute.String("otel.component.type", e.pt.component),
+			attribute.String("error.type", "export_failed"),
+		)
+		e.pt.exported.Add(bg, n, failed)
+		e.pt.dropped.Add(bg, n, metric.WithAttributes(
+			attribute.String("otel.component.type", e.pt.component),
+			attribute.String("reason", "export_failed"),
+		))
+		e.pt.duration.Record(bg, time.Since(start).Seconds(), failed)
+		return err
+	}
+
+	e.pt.exported.Add(bg, n, e.pt.attrs)
+	e.pt.duration.Record(bg, time.Since(start).Seconds(), e.pt.attrs)
+
+	return nil
+}
+
+type queueTrackingProcessor struct {
+	sdktrace.SpanProcessor
+	pt *pipelineTelemetry
+}
+
+// OnEnd counts the span into the queue, or as dropped when the queue is full:
+// the batch processor drops spans silently in that case. So does the SDK with
+// what goes over the span limits, which is counted too.
+func (p queueTrackingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.pt.countLimited("attributes", s.DroppedAttributes())
+		p.pt.countLimited("events", s.DroppedEvents())
+		p.pt.countLimited("links", s.DroppedLinks())
+
+		if p.pt.queued.Load() >= p.pt.capacity {
+			p.pt.dropped.Add(context.Background(), 1, metric.WithAttributes(
+				attribute.String("otel.component.type", p.pt.component),
+				attribute.String("reason", "queue_full"),
+			))
+		} else {
+			p.pt.queued.Add(1)
+		}
+	}
+
+	p.SpanProcessor.OnEnd(s)
+}
+
+// countLimited records n items of kind dropped from a span over its limits
+func (pt *pipelineTelemetry) countLimited(kind string, n int) {
+	if n == 0 {
+		return
+	}
+
+	pt.limited.Add(context.Background(), int64(n), metric.WithAttributes(
+		attribute.String("otel.component.type", pt.component),
+		attribute.String("otel.span.limit", kind),
+	))
+}
@@ -0,0 +1,131 @@
+package tel
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the scope name used for spans started by the helpers below
+const instrumentationName = "github.com/neha-gupta1/otel-semantics"
+
+// scopeVersion is reported as the version of every instrumentation scope
+const scopeVersion = "0.0.1"
+
+// Scope starts spans under its own instrumentation scope, so backends can
+// slice the spans of each component of the service
+type Scope struct {
+	name string
+}
+
+// scopeNames lists the scopes created, for Describe
+var (
+	scopeNamesMu sync.Mutex
+	scopeNames   []string
+)
+
+// NewScope returns the scope called name
+func NewScope(name string) Scope {
+	scopeNamesMu.Lock()
+	scopeNames = append(scopeNames, name)
+	scopeNamesMu.Unlock()
+
+	return Scope{name: name}
+}
+
+// Scopes of the components of the service
+var (
+	HTTPScope       = NewScope("app/http")
+	RepositoryScope = NewScope("app/repository")
+	CacheScope      = NewScope("app/cache")
+)
+
+// defaultScope is used by the package level helpers
+var defaultScope = NewScope(instrumentationName)
+
+// tracer returns a tracer from the provider of the span already in ctx, so the
+// helpers keep working with whatever provider started the parent span. Without
+// a parent span the global provider is used.
+func (s Scope) tracer(ctx context.Context) trace.Tracer {
+	provider := otel.GetTracerProvider()
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		provider = span.TracerProvider()
+	}
+
+	return provider.Tracer(s.name, trace.WithInstrumentationVersion(scopeVersion))
+}
+
+// StartServerSpan starts a span of kind SERVER, for handling an inbound request
+func (s Scope) StartServerSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return s.startSpan(ctx, name, trace.SpanKindServer, opts...)
+}
+
+// StartClientSpan starts a span of kind CLIENT, for outbound calls such as database queries
+func (s Scope) StartClientSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return s.startSpan(ctx, name, trace.SpanKindClient, opts...)
+}
+
+// StartInternalSpan starts a span of kind INTERNAL, for work that does not leave the process
+func (s Scope) StartInternalSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return s.startSpan(ctx, name, trace.SpanKindInternal, withCaller(opts, 2)...)
+}
+
+// captureCode is set by SetCodeAttributes
+var captureCode atomic.Bool
+
+// SetCodeAttributes turns the code.* attributes of the INTERNAL spans on or
+// off, InitTracer sets it from Config.CodeAttributes
+func SetCodeAttributes(enabled bool) {
+	captureCode.Store(enabled)
+}
+
+// withCaller adds the code.* attributes of the function skip frames up the
+// stack from withCaller's caller when they're enabled. They go first so the
+// caller's own code.* attributes win, e.g. the job function of a cron run.
+func withCaller(opts []trace.SpanStartOption, skip int) []trace.SpanStartOption {
+	if !captureCode.Load() {
+		return opts
+	}
+
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return opts
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("code.file.path", file),
+		attribute.Int("code.line.number", line),
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		attrs = append(attrs, attribute.String("code.function.name", fn.Name()))
+	}
+
+	return append([]trace.SpanStartOption{trace.WithAttributes(attrs...)}, opts...)
+}
+
+func (s Scope) startSpan(ctx context.Context, name string, kind trace.SpanKind, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	// the kind is appended last so it can't be overridden by the caller
+	opts = append(opts, trace.WithSpanKind(kind))
+	ctx, span := s.tracer(ctx).Start(ctx, name, opts...)
+
+	return withAttrs(ctx, span)
+}
+
+// StartServerSpan starts a SERVER span under the default scope
+func StartServerSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return defaultScope.StartServerSpan(ctx, name, opts...)
+}
+
+// StartClientSpan starts a CLIENT span under the default scope
+func StartClientSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return defaultScope.StartClientSpan(ctx, name, opts...)
+}
+
+// StartInternalSpan starts an INTERNAL span under the default scope
+func StartInternalSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return defaultScope.startSpan(ctx, name, trace.SpanKindInternal, withCaller(opts, 2)...)
+}
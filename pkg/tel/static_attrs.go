@@ -0,0 +1,103 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// staticAttributesFromEnv parses key=value pairs separated by commas, e.g.
+// team=users,cost_center=cc-42,region=eu-west-1, remembering the malformed
+// ones for Validate
+func (cfg *Config) staticAttributesFromEnv(key string) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, pair := range splitList(os.Getenv(key)) {
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" {
+			cfg.envProblems = append(cfg.envProblems, fmt.Sprintf("%s: %q isn't a key=value pair", key, pair))
+			continue
+		}
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	return attrs
+}
+
+// StaticAttributes are the attributes of Config.StaticAttributes, for the
+// enrichers of the middleware to add to the server spans
+func (t *Telemetry) StaticAttributes() []attribute.KeyValue {
+	return t.cfg.StaticAttributes
+}
+
+// staticAttributeExporter adds the static attributes to every data point
+// before export. Points recording the same key keep their own value.
+type staticAttributeExporter struct {
+	sdkmetric.Exporter
+	attrs []attribute.KeyValue
+}
+
+func (e staticAttributeExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	for i := range rm.ScopeMetrics {
+		for j := range rm.ScopeMetrics[i].Metrics {
+			m := &rm.ScopeMetrics[i].Metrics[j]
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				addStaticAttributes(data.DataPoints, e.attrs)
+			case metricdata.Gauge[float64]:
+				addStaticAttributes(data.DataPoints, e.attrs)
+			case metricdata.Sum[int64]:
+				addStaticAttributes(data.DataPoints, e.attrs)
+			case metricdata.Sum[float64]:
+				addStaticAttributes(data.DataPoints, e.attrs)
+			case metricdata.Histogram[int64]:
+				addStaticHistogramAttributes(data.DataPoints, e.attrs)
+			case metricdata.Histogram[float64]:
+				addStaticHistogramAttributes(data.DataPoints, e.attrs)
+			case metricdata.ExponentialHistogram[int64]:
+				addStaticExponentialAttributes(data.DataPoints, e.attrs)
+			case metricdata.ExponentialHistogram[float64]:
+				addStaticExponentialAttributes(data.DataPoints, e.attrs)
+			}
+		}
+	}
+
+	return e.Exporter.Export(ctx, rm)
+}
+
+func addStaticAttributes[N int64 | float64](points []metricdata.DataPoint[N], static []attribute.KeyValue) {
+	for i := range points {
+		points[i].Attributes = withStaticAttributes(points[i].Attributes, static)
+	}
+}
+
+func addStaticHistogramAttributes[N int64 | float64](points []metricdata.HistogramDataPoint[N], static []attribute.KeyValue) {
+	for i := range points {
+		points[i].Attributes = withStaticAttributes(points[i].Attributes, static)
+	}
+}
+
+func addStaticExponentialAttributes[N int64 | float64](points []metricdata.ExponentialHistogramDataPoint[N], static []attribute.KeyValue) {
+	for i := range points {
+		points[i].Attributes = withStaticAttributes(points[i].Attributes, static)
+	}
+}
+
+// withStaticAttributes returns set with the static attributes it doesn't
+// record itself
+func withStaticAttributes(set attribute.Set, static []attribute.KeyValue) attribute.Set {
+	attrs := make([]attribute.KeyValue, 0, set.Len()+len(static))
+	for _, kv := range static {
+		if !set.HasValue(kv.Key) {
+			attrs = append(attrs, kv)
+		}
+	}
+	attrs = append(attrs, set.ToSlice()...)
+
+	return attribute.NewSet(attrs...)
+}
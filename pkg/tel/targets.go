@@ -0,0 +1,63 @@
+package tel
+
+import "fmt"
+
+// OpenObserve paths of the OTLP/HTTP endpoints of each signal
+const (
+	tracesURLPath  = "/api/default/v1/traces"
+	metricsURLPath = "/api/default/v1/metrics"
+	logsURLPath    = "/api/default/v1/logs"
+)
+
+// OTLPTarget is where and how one signal is exported over OTLP
+type OTLPTarget struct {
+	// Signal is traces, metrics or logs
+	Signal string
+	// Protocol is "http/protobuf", "http/json" or "grpc"
+	Protocol string
+	// Endpoint is the host:port, or unix:path, of the receiver
+	Endpoint string
+	// URLPath is the path of the OTLP/HTTP endpoint
+	URLPath string
+	Headers map[string]string
+	// OAuth2 is set when an OAuth2 bearer token is sent along the headers
+	OAuth2 bool
+	// Insecure is set when the export is made without TLS
+	Insecure bool
+}
+
+// OTLPTargets returns the targets the signals are exported to with cfg, the way
+// InitTracer, InitMeter and InitLogger set up their exporters
+func OTLPTargets(cfg Config) ([]OTLPTarget, error) {
+	if cfg.Exporter != "otlp" {
+		return nil, fmt.Errorf("the %s exporter doesn't export over OTLP", cfg.Exporter)
+	}
+
+	headers := exportHeaders(cfg, nil)
+	oauth2 := cfg.OAuth2.Enabled()
+
+	traces := OTLPTarget{
+		Signal:   "traces",
+		Protocol: cfg.Protocol,
+		Endpoint: cfg.Endpoint,
+		URLPath:  tracesURLPath,
+		Headers:  headers,
+		OAuth2:   oauth2,
+		Insecure: !cfg.TLS,
+	}
+	if cfg.Protocol == "grpc" {
+		traces.Endpoint = cfg.GRPCEndpoint
+		traces.URLPath = ""
+		traces.Headers = exportHeaders(cfg, map[string]string{"organization": "default"})
+		if cfg.UnixSocket != "" {
+			traces.Endpoint = "unix:" + cfg.UnixSocket
+		}
+	}
+
+	// Metrics and logs always go over OTLP/HTTP
+	return []OTLPTarget{
+		traces,
+		{Signal: "metrics", Protocol: "http/protobuf", Endpoint: cfg.Endpoint, URLPath: metricsURLPath, Headers: headers, OAuth2: oauth2, Insecure: !cfg.TLS},
+		{Signal: "logs", Protocol: "http/protobuf", Endpoint: cfg.Endpoint, URLPath: logsURLPath, Headers: headers, OAuth2: oauth2, Insecure: !cfg.TLS},
+	}, nil
+}
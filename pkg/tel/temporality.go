@@ -0,0 +1,138 @@
+package tel
+
+import (
+	"fmt"
+	"strings"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// instrumentKinds are the names used in the per kind settings
+var instrumentKinds = map[string]sdkmetric.InstrumentKind{
+	"counter":                  sdkmetric.InstrumentKindCounter,
+	"updowncounter":            sdkmetric.InstrumentKindUpDownCounter,
+	"histogram":                sdkmetric.InstrumentKindHistogram,
+	"gauge":                    sdkmetric.InstrumentKindGauge,
+	"observable_counter":       sdkmetric.InstrumentKindObservableCounter,
+	"observable_updowncounter": sdkmetric.InstrumentKindObservableUpDownCounter,
+	"observable_gauge":         sdkmetric.InstrumentKindObservableGauge,
+}
+
+// parseKindSettings parses "counter=delta,histogram=cumulative" into a map
+func parseKindSettings(v string) map[string]string {
+	settings := map[string]string{}
+	for _, item := range splitList(v) {
+		kind, value, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		settings[strings.TrimSpace(kind)] = strings.TrimSpace(value)
+	}
+
+	return settings
+}
+
+// temporalitySelector returns the temporality of each instrument kind: the
+// preference sets them all like the spec's OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE,
+// then byKind overrides some
+func temporalitySelector(preference string, byKind map[string]string) (sdkmetric.TemporalitySelector, error) {
+	temporalities := map[sdkmetric.InstrumentKind]metricdata.Temporality{}
+	for _, kind := range instrumentKinds {
+		temporalities[kind] = metricdata.CumulativeTemporality
+	}
+
+	switch strings.ToLower(preference) {
+	case "", "cumulative":
+	case "delta":
+		// up down counters stay cumulative, their delta means little on its own
+		for _, kind := range []sdkmetric.InstrumentKind{
+			sdkmetric.InstrumentKindCounter,
+			sdkmetric.InstrumentKindHistogram,
+			sdkmetric.InstrumentKindObservableCounter,
+		} {
+			temporalities[kind] = metricdata.DeltaTemporality
+		}
+	case "lowmemory":
+		temporalities[sdkmetric.InstrumentKindCounter] = metricdata.DeltaTemporality
+		temporalities[sdkmetric.InstrumentKindHistogram] = metricdata.DeltaTemporality
+	default:
+		return nil, fmt.Errorf("unknown temporality preference %q", preference)
+	}
+
+	for name, value := range byKind {
+		kind, ok := instrumentKinds[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown instrument kind %q", name)
+		}
+
+		switch strings.ToLower(value) {
+		case "cumulative":
+			temporalities[kind] = metricdata.CumulativeTemporality
+		case "delta":
+			temporalities[kind] = metricdata.DeltaTemporality
+		default:
+			return nil, fmt.Errorf("unknown temporality %q for %s", value, name)
+		}
+	}
+
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		if t, ok := temporalities[kind]; ok {
+			return t
+		}
+		return metricdata.CumulativeTemporality
+	}, nil
+}
+
+// aggregationSelector returns the aggregation of each instrument kind, the
+// SDK default unless byKind or the default histogram aggregation says otherwise
+func aggregationSelector(histogram string, byKind map[string]string) (sdkmetric.AggregationSelector, error) {
+	aggregations := map[sdkmetric.InstrumentKind]sdkmetric.Aggregation{}
+
+	if histogram != "" {
+		agg, err := parseAggregation(histogram)
+		if err != nil {
+			return nil, err
+		}
+		aggregations[sdkmetric.InstrumentKindHistogram] = agg
+	}
+
+	for name, value := range byKind {
+		kind, ok := instrumentKinds[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown instrument kind %q", name)
+		}
+
+		agg, err := parseAggregation(value)
+		if err != nil {
+			return nil, err
+		}
+		aggregations[kind] = agg
+	}
+
+	return func(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+		if agg, ok := aggregations[kind]; ok {
+			return agg
+		}
+		return sdkmetric.DefaultAggregationSelector(kind)
+	}, nil
+}
+
+func parseAggregation(name string) (sdkmetric.Aggregation, error) {
+	switch strings.ToLower(name) {
+	case "default":
+		return sdkmetric.AggregationDefault{}, nil
+	case "drop":
+		return sdkmetric.AggregationDrop{}, nil
+	case "sum":
+		return sdkmetric.AggregationSum{}, nil
+	case "last_value":
+		return sdkmetric.AggregationLastValue{}, nil
+	case "explicit_bucket_histogram":
+		return sdkmetric.DefaultAggregationSelector(sdkmetric.InstrumentKindHistogram), nil
+	case "base2_exponential_bucket_histogram":
+		return sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}, nil
+	default:
+		return nil, fmt.Errorf("unknown aggregation %q", name)
+	}
+}
@@ -0,0 +1,39 @@
+package tel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Time runs fn inside an INTERNAL child span called name, so a block of code
+// shows up in the trace with its own duration. An error returned by fn, or a
+// panic, is recorded on the span and sets its status. fn can reach the span
+// through trace.SpanFromContext(ctx) to add attributes or events.
+func Time(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...trace.SpanStartOption) error {
+	return defaultScope.Time(ctx, name, fn, opts...)
+}
+
+// Time is like the package level Time, with the span in scope s
+func (s Scope) Time(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...trace.SpanStartOption) (err error) {
+	ctx, span := s.StartInternalSpan(ctx, name, opts...)
+	defer span.End()
+
+	defer func() {
+		if r := recover(); r != nil {
+			span.RecordError(fmt.Errorf("panic: %v", r), trace.WithStackTrace(true))
+			span.SetStatus(codes.Error, fmt.Sprint(r))
+			panic(r)
+		}
+	}()
+
+	err = fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
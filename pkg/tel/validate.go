@@ -0,0 +1,137 @@
+package tel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/conventions"
+)
+
+// Validate checks cfg before any pipeline is set up, and returns every problem
+// found at once rather than the first one. InitTracer and friends fall back to
+// defaults on bad settings, this is for failing at startup instead.
+func (cfg Config) Validate() error {
+	problems := append([]string{}, cfg.envProblems...)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch cfg.Exporter {
+	case "otlp":
+		switch cfg.Protocol {
+		case "http/protobuf", "http/json":
+			if cfg.UnixSocket != "" {
+				add("the unix socket %q (OTEL_EXPORTER_OTLP_UNIX_SOCKET) needs OTEL_EXPORTER_OTLP_PROTOCOL=grpc", cfg.UnixSocket)
+			}
+			if cfg.Dialer != nil {
+				add("a custom Dialer needs OTEL_EXPORTER_OTLP_PROTOCOL=grpc")
+			}
+		case "grpc":
+			if cfg.ProxyURL != "" {
+				add("the proxy (OTEL_EXPORTER_OTLP_PROXY) is only used over http, unset it or use OTEL_EXPORTER_OTLP_PROTOCOL=http/protobuf")
+			}
+			if cfg.UnixSocket != "" && cfg.Dialer != nil {
+				add("set either a unix socket (OTEL_EXPORTER_OTLP_UNIX_SOCKET) or a custom Dialer, not both")
+			}
+		default:
+			add("unknown OTLP protocol %q (OTEL_EXPORTER_OTLP_PROTOCOL), use http/protobuf, http/json or grpc", cfg.Protocol)
+		}
+
+		if cfg.Protocol == "grpc" && cfg.UnixSocket == "" {
+			if err := validateEndpoint(cfg.GRPCEndpoint); err != nil {
+				add("invalid OTLP endpoint %q (OTEL_OTLP_GRPC_ENDPOINT): %s", cfg.GRPCEndpoint, err)
+			}
+		}
+		// metrics and logs always go over OTLP/HTTP
+		if err := validateEndpoint(cfg.Endpoint); err != nil {
+			add("invalid OTLP endpoint %q (OTEL_OTLP_HTTP_ENDPOINT): %s", cfg.Endpoint, err)
+		}
+	case "xray", "cloudtrace":
+		if cfg.UnixSocket != "" || cfg.ProxyURL != "" {
+			add("OTEL_EXPORTER_OTLP_UNIX_SOCKET and OTEL_EXPORTER_OTLP_PROXY only apply to the otlp exporter, not %s", cfg.Exporter)
+		}
+	default:
+		add("unknown exporter %q (OTEL_TRACES_EXPORTER), use otlp, xray or cloudtrace", cfg.Exporter)
+	}
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		switch {
+		case err != nil:
+			add("invalid proxy URL %q (OTEL_EXPORTER_OTLP_PROXY): %s", cfg.ProxyURL, err)
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5":
+			add("the proxy URL %q (OTEL_EXPORTER_OTLP_PROXY) needs an http, https or socks5 scheme", cfg.ProxyURL)
+		case u.Host == "":
+			add("the proxy URL %q (OTEL_EXPORTER_OTLP_PROXY) has no host", cfg.ProxyURL)
+		}
+	}
+
+	problems = append(problems, cfg.OAuth2.validate()...)
+	if cfg.OAuth2.Enabled() && !cfg.TLS {
+		add("OAuth2 bearer tokens must not be exported in clear text, set OTEL_EXPORTER_OTLP_INSECURE=false to export over TLS")
+	}
+
+	if _, err := newPropagator(cfg.Propagators); err != nil {
+		add("%s (OTEL_PROPAGATORS), use tracecontext, baggage, b3, b3multi, xray, cloudtrace or none", err)
+	}
+
+	if _, err := newSampler(cfg); err != nil {
+		add("%s (OTEL_TRACES_SAMPLER), use always_on, always_off, consistent_probability or parentbased_consistent_probability", err)
+	}
+	if cfg.SamplerRatio < 0 || cfg.SamplerRatio > 1 {
+		add("sampler ratio %v (OTEL_TRACES_SAMPLER_ARG) must be between 0 and 1", cfg.SamplerRatio)
+	}
+
+	switch cfg.SpanProcessor {
+	case "", "batch", "simple", "adaptive":
+	default:
+		add("unknown span processor %q (OTEL_SPAN_PROCESSOR), use batch, simple or adaptive", cfg.SpanProcessor)
+	}
+
+	if cfg.Heartbeat > 0 && cfg.Heartbeat < time.Second {
+		add("heartbeat interval %s (OTEL_HEARTBEAT_INTERVAL) is below 1s, it would flood the backend", cfg.Heartbeat)
+	}
+
+	if _, err := conventions.ParseProfile(cfg.AttributeProfile); err != nil {
+		add("%s (OTEL_SEMCONV_ATTRIBUTE_PROFILE), use minimal, recommended or full", err)
+	}
+
+	if _, err := temporalitySelector(cfg.MetricTemporality, cfg.MetricTemporalityByKind); err != nil {
+		add("%s (OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE or OTEL_METRICS_TEMPORALITY)", err)
+	}
+	if _, err := aggregationSelector(cfg.HistogramAggregation, cfg.MetricAggregationByKind); err != nil {
+		add("%s (OTEL_EXPORTER_OTLP_METRICS_DEFAULT_HISTOGRAM_AGGREGATION or OTEL_METRICS_AGGREGATION)", err)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid telemetry config for %s:\n  - %s", cfg.ServiceName, strings.Join(problems, "\n  - "))
+}
+
+// validateEndpoint checks endpoint is a host:port, the most common mistake
+// being a URL
+func validateEndpoint(endpoint string) error {
+	if strings.Contains(endpoint, "://") {
+		return errors.New("expected host:port without a scheme, e.g. localhost:4318")
+	}
+
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return errors.New("expected host:port, e.g. localhost:4318")
+	}
+	if host == "" {
+		return errors.New("missing host")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("port %q isn't a number between 1 and 65535", port)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+// Package testenv provides an end-to-end environment for tests: a MongoDB
+// started with testcontainers, the userstore served over HTTP and an in-memory
+// span exporter to assert on the produced telemetry.
+package testenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// mongoImage is the image started for the tests, pinned so runs are reproducible
+const mongoImage = "mongo:7"
+
+// redisImage is the Redis started for the rate limiting tests
+const redisImage = "redis:7"
+
+// startupTimeout bounds how long the environment may take to become ready
+const startupTimeout = 2 * time.Minute
+
+// Env is a running userstore backed by its own MongoDB
+type Env struct {
+	// Server serves the userstore routes
+	Server *httptest.Server
+	// Spans holds every span ended by the server
+	Spans *tracetest.InMemoryExporter
+	// TracerProvider exports synchronously to Spans
+	TracerProvider *sdktrace.TracerProvider
+	// MongoURI is the connection string of the test database
+	MongoURI string
+	// Repository is the instrumented repository installed on the handlers
+	Repository userstore.UserRepository
+}
+
+// New starts MongoDB and the userstore, and tears both down when tb finishes.
+// Tests using it are skipped when docker isn't available.
+func New(tb testing.TB) *Env {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+
+	env := &Env{
+		MongoURI: StartMongo(tb),
+		Spans:    tracetest.NewInMemoryExporter(),
+	}
+
+	env.TracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSyncer(env.Spans),
+	)
+	otel.SetTracerProvider(env.TracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	tb.Cleanup(func() {
+		env.TracerProvider.Shutdown(context.Background())
+	})
+
+	env.Repository = userstore.NewInstrumentedRepository(userstore.NewMongoRepository(env.MongoURI))
+	userstore.UseRepository(env.Repository)
+	tb.Cleanup(func() {
+		env.Repository.Disconnect(context.Background())
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Server())
+	router.Use(middleware.ErrorIDs())
+	userstore.Register(router)
+
+	userstore.RunStartup(ctx, env.TracerProvider)
+	if ctx.Err() != nil {
+		tb.Fatalf("userstore did not become ready: %v", ctx.Err())
+	}
+
+	env.Server = httptest.NewServer(router)
+	tb.Cleanup(env.Server.Close)
+
+	// Only keep the spans produced by the test itself
+	env.Spans.Reset()
+
+	return env
+}
+
+// StartMongo runs a MongoDB container for the duration of tb and returns its
+// connection string.
+func StartMongo(tb testing.TB) string {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        mongoImage,
+			ExposedPorts: []string{"27017/tcp"},
+			Env: map[string]string{
+				"MONGO_INITDB_ROOT_USERNAME": "root",
+				"MONGO_INITDB_ROOT_PASSWORD": "example",
+			},
+			WaitingFor: wait.ForListeningPort("27017/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		tb.Skipf("docker is not available: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		container.Terminate(context.Background())
+	})
+
+	endpoint, err := container.PortEndpoint(ctx, "27017/tcp", "")
+	if err != nil {
+		tb.Fatalf("getting the mongo endpoint: %v", err)
+	}
+
+	return "mongodb://root:example@" + endpoint
+}
+
+// StartRedis runs a Redis container for the duration of tb and returns its
+// URL, as taken by RATE_LIMIT_REDIS_URL.
+func StartRedis(tb testing.TB) string {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        redisImage,
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForListeningPort("6379/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		tb.Skipf("docker is not available: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		container.Terminate(context.Background())
+	})
+
+	endpoint, err := container.PortEndpoint(ctx, "6379/tcp", "")
+	if err != nil {
+		tb.Fatalf("getting the redis endpoint: %v", err)
+	}
+
+	return "redis://" + endpoint + "/0"
+}
+
+// SeedUsers inserts users through the repository, outside of any request
+func (e *Env) SeedUsers(tb testing.TB, users ...userstore.Users) {
+	tb.Helper()
+
+	for _, user := range users {
+		if _, err := e.Repository.Insert(context.Background(), user); err != nil {
+			tb.Fatalf("seeding user %q: %v", user.ID, err)
+		}
+	}
+
+	e.Spans.Reset()
+}
+
+// Do sends a request to the server, JSON encoding body when it's not nil. The
+// Authorization header is set for username unless it's empty.
+func (e *Env) Do(tb testing.TB, method, path, username string, body any) *http.Response {
+	tb.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			tb.Fatalf("encoding body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, e.Server.URL+path, reader)
+	if err != nil {
+		tb.Fatalf("creating request: %v", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if username != "" {
+		req.Header.Set("Authorization", "Bearer "+username)
+	}
+
+	resp, err := e.Server.Client().Do(req)
+	if err != nil {
+		tb.Fatalf("%s %s: %v", method, path, err)
+	}
+	tb.Cleanup(func() {
+		resp.Body.Close()
+	})
+
+	return resp
+}
+
+// EndedSpans returns the spans ended since the last reset
+func (e *Env) EndedSpans() tracetest.SpanStubs {
+	return e.Spans.GetSpans()
+}
+
+// SpanByName returns the first ended span called name
+func (e *Env) SpanByName(tb testing.TB, name string) tracetest.SpanStub {
+	tb.Helper()
+
+	for _, span := range e.Spans.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	tb.Fatalf("no span named %q", name)
+	return tracetest.SpanStub{}
+}
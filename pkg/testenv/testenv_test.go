@@ -0,0 +1,56 @@
+package testenv_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/testenv"
+	"github.com/neha-gupta1/otel-semantics/pkg/userstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEnv(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts MongoDB in docker")
+	}
+
+	env := testenv.New(t)
+	env.SeedUsers(t, userstore.Users{ID: "testenv", Name: "Test Env", PhoneNo: 5550100})
+
+	resp := env.Do(t, http.MethodGet, "/api/v1/user", "alice", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/v1/user answered %d, want 200", resp.StatusCode)
+	}
+
+	var body struct {
+		User []userstore.Users `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding the users: %v", err)
+	}
+	if len(body.User) != 1 || body.User[0].ID != "testenv" {
+		t.Errorf("got users %+v, want the seeded one", body.User)
+	}
+
+	server := env.SpanByName(t, "GET /api/v1/user")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("span %q has kind %s, want server", server.Name, server.SpanKind)
+	}
+
+	// the query is traced by the instrumented repository, in the trace of the request
+	var queried bool
+	for _, span := range env.EndedSpans() {
+		attrs := attribute.NewSet(span.Attributes...)
+		if system, _ := attrs.Value("db.system"); span.SpanKind == trace.SpanKindClient && system.AsString() == "mongodb" {
+			queried = true
+			if span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+				t.Errorf("database span %q is in trace %s, want the request's %s", span.Name, span.SpanContext.TraceID(), server.SpanContext.TraceID())
+			}
+		}
+	}
+	if !queried {
+		t.Errorf("no mongodb client span among %d spans", len(env.EndedSpans()))
+	}
+}
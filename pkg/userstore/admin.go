@@ -0,0 +1,345 @@
+package userstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BulkRequest is the body accepted by the admin bulk endpoints. Requests without
+// a matching Confirm token are treated as a dry run which returns the number of
+// matched users and the token needed to actually apply the operation.
+type BulkRequest struct {
+	Filter  map[string]any `json:"filter" binding:"required"`
+	Update  map[string]any `json:"update"`
+	Confirm string         `json:"confirm"`
+}
+
+// validateBulkRequest binds the body, refuses filters that would match every
+// user and updates touching anything but the editable fields
+func validateBulkRequest(c *gin.Context, operation string, req *BulkRequest) error {
+	if err := c.ShouldBindJSON(req); err != nil {
+		return err
+	}
+
+	if len(req.Filter) == 0 {
+		return errors.New("filter must not be empty")
+	}
+
+	if err := validateFilter(req.Filter); err != nil {
+		return err
+	}
+
+	if operation == "updateMany" {
+		if len(req.Update) == 0 {
+			return errors.New("update must not be empty")
+		}
+		if err := validateUpdate(req.Update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bulkUpdateField reports whether a bulk update may set the stored field name:
+// the name, the phone number and the preferences. The ids and the password
+// hash can't be changed in bulk.
+func bulkUpdateField(name string) bool {
+	if name == userFields["name"] || name == userFields["phone_no"] {
+		return true
+	}
+
+	pref, ok := strings.CutPrefix(name, "preferences.")
+	return ok && pref != "" && !strings.HasPrefix(pref, "$")
+}
+
+// validateUpdate checks the update only sets the fields above. It is applied
+// with $set, so operators such as $unset or $rename aren't allowed either.
+func validateUpdate(update map[string]any) error {
+	for key := range update {
+		switch {
+		case strings.HasPrefix(key, "$"):
+			return fmt.Errorf("operator %s isn't allowed in updates", key)
+		case !bulkUpdateField(key):
+			return fmt.Errorf("field %q can't be updated", key)
+		}
+	}
+
+	return nil
+}
+
+// bulkFilterOperators are the comparison operators a bulk filter may use. The
+// ones running JavaScript on the server, $where, $function and $accumulator,
+// and the rest of the query language aren't allowed.
+var bulkFilterOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true,
+}
+
+// bulkLogicalOperators combine filters
+var bulkLogicalOperators = map[string]bool{"$and": true, "$or": true, "$nor": true}
+
+// bulkFilterField reports whether a bulk filter may match on the stored field
+// name, the fields of the users and their preferences
+func bulkFilterField(name string) bool {
+	for _, stored := range userFields {
+		if name == stored {
+			return true
+		}
+	}
+
+	pref, ok := strings.CutPrefix(name, "preferences.")
+	return ok && pref != "" && !strings.HasPrefix(pref, "$")
+}
+
+// validateFilter checks the filter only matches the user fields with plain
+// values and the comparison and logical operators above
+func validateFilter(filter map[string]any) error {
+	for key, value := range filter {
+		switch {
+		case bulkLogicalOperators[key]:
+			clauses, ok := value.([]any)
+			if !ok || len(clauses) == 0 {
+				return fmt.Errorf("%s takes a list of filters", key)
+			}
+			for _, clause := range clauses {
+				sub, ok := clause.(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s takes a list of filters", key)
+				}
+				if err := validateFilter(sub); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(key, "$"):
+			return fmt.Errorf("operator %s isn't allowed in filters", key)
+		case !bulkFilterField(key):
+			return fmt.Errorf("unknown filter field %q", key)
+		default:
+			if err := validateCondition(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateCondition checks the condition on one field: a plain value, or an
+// object of comparison operators with plain values
+func validateCondition(field string, value any) error {
+	ops, ok := value.(map[string]any)
+	if !ok {
+		if !plainValue(value) {
+			return fmt.Errorf("the value of %s must be a string, number, boolean or null", field)
+		}
+		return nil
+	}
+
+	for op, operand := range ops {
+		if !bulkFilterOperators[op] {
+			return fmt.Errorf("operator %s isn't allowed in filters", op)
+		}
+
+		if list, ok := operand.([]any); ok && (op == "$in" || op == "$nin") {
+			for _, v := range list {
+				if !plainValue(v) {
+					return fmt.Errorf("%s of %s takes a list of plain values", op, field)
+				}
+			}
+			continue
+		}
+		if !plainValue(operand) {
+			return fmt.Errorf("the operand of %s on %s must be a string, number, boolean or null", op, field)
+		}
+	}
+
+	return nil
+}
+
+// plainValue reports whether v, decoded from JSON, is a scalar
+func plainValue(v any) bool {
+	switch v.(type) {
+	case nil, string, float64, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// updateFields returns the fields the update sets, sorted, without the values
+func updateFields(update map[string]any) []string {
+	fields := make([]string, 0, len(update))
+	for field := range update {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// filterFields returns the fields the filter matches on, sorted, without the
+// values, which may be personal data
+func filterFields(filter map[string]any) []string {
+	seen := map[string]bool{}
+	var walk func(map[string]any)
+	walk = func(f map[string]any) {
+		for key, value := range f {
+			if !bulkLogicalOperators[key] {
+				seen[key] = true
+				continue
+			}
+			clauses, _ := value.([]any)
+			for _, clause := range clauses {
+				if sub, ok := clause.(map[string]any); ok {
+					walk(sub)
+				}
+			}
+		}
+	}
+	walk(filter)
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// confirmationToken derives a token bound to the operation and its arguments, so
+// a token issued for one filter can't be replayed against another.
+func confirmationToken(operation string, req BulkRequest) (string, error) {
+	payload, err := json.Marshal([]any{operation, req.Filter, req.Update})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func AdminUpdateUsers(c *gin.Context) {
+	adminBulk(c, "updateMany")
+}
+
+func AdminDeleteUsers(c *gin.Context) {
+	adminBulk(c, "deleteMany")
+}
+
+func adminBulk(c *gin.Context, operation string) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "Admin "+operation)
+	defer span.End()
+
+	err := authMiddleware(c, span)
+	if err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	req := BulkRequest{}
+	if err := validateBulkRequest(c, operation, &req); err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := confirmationToken(operation, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Confirm != token {
+		matched, err := repo.Count(ctx, bson.M(req.Filter))
+		if err != nil {
+			if isTimeout(c, err) {
+				abortWithTimeout(c)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting users"})
+			return
+		}
+
+		span.AddEvent("Bulk operation awaiting confirmation", trace.WithAttributes(
+			attribute.String("db.operation.name", operation),
+			attribute.Int64("db.operation.batch.size", matched),
+		))
+		c.JSON(http.StatusAccepted, gin.H{
+			"dry_run": true,
+			"matched": matched,
+			"confirm": token,
+		})
+		return
+	}
+
+	var affected int64
+	if operation == "updateMany" {
+		_, affected, err = repo.UpdateMany(ctx, bson.M(req.Filter), bson.M(req.Update))
+	} else {
+		affected, err = repo.DeleteMany(ctx, bson.M(req.Filter))
+	}
+	// Part of the documents may have changed even when the operation failed
+	userCache.invalidate()
+	if err != nil {
+		span.AddEvent("Error running bulk operation", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("db.system", "mongodb"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error running " + operation})
+		return
+	}
+
+	auditLog(ctx, username, operation, req, affected)
+
+	c.JSON(http.StatusOK, gin.H{
+		"affected": affected,
+	})
+}
+
+// auditLog writes an audit entry for a destructive admin operation. Only the
+// fields of the filter and the update are logged, their values may be personal
+// data.
+func auditLog(ctx context.Context, username, operation string, req BulkRequest, affected int64) {
+	args := []any{
+		"user", username,
+		"operation", operation,
+		"collection", UsersCol,
+		"filter_fields", filterFields(req.Filter),
+	}
+	if operation == "updateMany" {
+		args = append(args, "update_fields", updateFields(req.Update))
+	}
+	args = append(args, "affected", affected)
+
+	logging.FromContext(ctx).Info("audit", args...)
+}
@@ -0,0 +1,292 @@
+package userstore
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AuthProvider authenticates the requests carrying one kind of credentials
+type AuthProvider interface {
+	// Name is recorded as auth.provider
+	Name() string
+	// Authenticate returns the user making r, or errNoCredentials when r
+	// doesn't carry the credentials of this provider so the next one is tried
+	Authenticate(r *http.Request) (string, error)
+	// Header is the request header holding the credentials, recorded redacted
+	Header() string
+}
+
+var errNoCredentials = errors.New("missing or invalid token")
+
+// authProviders are tried in order, from AUTH_PROVIDERS: token (default),
+// apikey, basic, oidc and jwt, comma separated
+var authProviders = authProvidersFromEnv()
+
+// UseAuthProviders replaces the providers checking the requests
+func UseAuthProviders(providers ...AuthProvider) {
+	authProviders = providers
+}
+
+func authProvidersFromEnv() []AuthProvider {
+	names := os.Getenv("AUTH_PROVIDERS")
+	if names == "" {
+		names = "token"
+	}
+
+	var providers []AuthProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "token":
+			providers = append(providers, tokenProvider{})
+		case "apikey":
+			providers = append(providers, apiKeyProvider{keys: credentialsFromEnv("AUTH_API_KEYS", "=")})
+		case "basic":
+			providers = append(providers, basicProvider{users: credentialsFromEnv("AUTH_BASIC_USERS", ":")})
+		case "jwt":
+			providers = append(providers, jwtProvider{})
+		case "oidc":
+			providers = append(providers, newOIDCProvider(os.Getenv("AUTH_OIDC_ISSUER"), os.Getenv("AUTH_OIDC_AUDIENCE"), os.Getenv("AUTH_OIDC_USERNAME_CLAIM")))
+		default:
+			logging.Default().Error("Unknown auth provider, skipping it", "provider", name)
+		}
+	}
+
+	return providers
+}
+
+// credentialsFromEnv parses "a=b,c=d" pairs with the given separator
+func credentialsFromEnv(key, sep string) map[string]string {
+	creds := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), sep)
+		if ok && k != "" && v != "" {
+			creds[k] = v
+		}
+	}
+
+	return creds
+}
+
+// authResultKey caches the outcome in the gin context, the cache, the route
+// group and the handler all authenticate the same request
+const authResultKey = "auth.result"
+
+type authResult struct {
+	username string
+	err      error
+}
+
+// authenticate runs the request through the providers. The server span gets
+// the provider, the user as enduser.id and the credentials header with
+// everything but the scheme redacted.
+func authenticate(c *gin.Context) (string, error) {
+	if v, ok := c.Get(authResultKey); ok {
+		res := v.(authResult)
+		return res.username, res.err
+	}
+
+	span := trace.SpanFromContext(tel.Ctx(c))
+	if username, ok := tel.Ctx(c).Value(internalUserKey{}).(string); ok {
+		span.SetAttributes(attribute.String("auth.provider", "internal"), attribute.String("enduser.id", username))
+		c.Set(authResultKey, authResult{username: username})
+		return username, nil
+	}
+
+	res := authResult{err: errNoCredentials}
+	for _, p := range authProviders {
+		username, err := p.Authenticate(c.Request)
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+
+		res = authResult{username: username, err: err}
+		span.SetAttributes(
+			attribute.String("auth.provider", p.Name()),
+			attribute.StringSlice("http.request.header."+strings.ToLower(p.Header()), []string{redactCredentials(c.GetHeader(p.Header()))}),
+		)
+		if err == nil {
+			span.SetAttributes(attribute.String("enduser.id", username))
+		}
+		break
+	}
+
+	c.Set(authResultKey, res)
+	return res.username, res.err
+}
+
+// internalUserKey marks the requests the service sends to itself, e.g. to warm
+// the cache, with the user they're made as. A context value can't come from
+// the network.
+type internalUserKey struct{}
+
+func withInternalUser(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, internalUserKey{}, username)
+}
+
+func isInternal(ctx context.Context) bool {
+	_, ok := ctx.Value(internalUserKey{}).(string)
+	return ok
+}
+
+// redactCredentials keeps only the scheme of an Authorization value
+func redactCredentials(value string) string {
+	if scheme, _, ok := strings.Cut(value, " "); ok {
+		return scheme + " REDACTED"
+	}
+
+	return "REDACTED"
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// tokenProvider is the demo provider: any bearer token is accepted and taken
+// as the username
+type tokenProvider struct{}
+
+func (tokenProvider) Name() string   { return "token" }
+func (tokenProvider) Header() string { return "Authorization" }
+
+func (tokenProvider) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", errNoCredentials
+	}
+
+	return token, nil
+}
+
+// apiKeyProvider accepts the keys of AUTH_API_KEYS ("key=user,...") in X-API-Key
+type apiKeyProvider struct {
+	keys map[string]string
+}
+
+func (apiKeyProvider) Name() string   { return "apikey" }
+func (apiKeyProvider) Header() string { return "X-API-Key" }
+
+func (p apiKeyProvider) Authenticate(r *http.Request) (string, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return "", errNoCredentials
+	}
+
+	// compare with every key so the time taken doesn't tell how close a guess was
+	var username string
+	for k, user := range p.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			username = user
+		}
+	}
+	if username == "" {
+		return "", errors.New("invalid API key")
+	}
+
+	return username, nil
+}
+
+// basicProvider accepts the users of AUTH_BASIC_USERS ("user:password,...")
+type basicProvider struct {
+	users map[string]string
+}
+
+func (basicProvider) Name() string   { return "basic" }
+func (basicProvider) Header() string { return "Authorization" }
+
+func (p basicProvider) Authenticate(r *http.Request) (string, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return "", errNoCredentials
+	}
+
+	expected, known := p.users[username]
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 || !known {
+		return "", errors.New("invalid username or password")
+	}
+
+	return username, nil
+}
+
+// oidcProvider accepts bearer ID tokens issued by AUTH_OIDC_ISSUER for
+// AUTH_OIDC_AUDIENCE, the username being AUTH_OIDC_USERNAME_CLAIM (default sub).
+// The issuer is discovered on the first request, and again after a failure.
+type oidcProvider struct {
+	issuer, audience, claim string
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCProvider(issuer, audience, claim string) *oidcProvider {
+	if claim == "" {
+		claim = "sub"
+	}
+
+	return &oidcProvider{issuer: issuer, audience: audience, claim: claim}
+}
+
+func (p *oidcProvider) Name() string   { return "oidc" }
+func (p *oidcProvider) Header() string { return "Authorization" }
+
+func (p *oidcProvider) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return "", errNoCredentials
+	}
+
+	verifier, err := p.getVerifier(r.Context())
+	if err != nil {
+		return "", fmt.Errorf("identity provider unavailable: %w", err)
+	}
+
+	idToken, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+	username, _ := claims[p.claim].(string)
+	if username == "" {
+		return "", fmt.Errorf("invalid token: no %s claim", p.claim)
+	}
+
+	return username, nil
+}
+
+func (p *oidcProvider) getVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.verifier != nil {
+		return p.verifier, nil
+	}
+
+	// The provider keeps the client for fetching the keys later, not the
+	// request's cancellation. The discovery shows up in the first request's trace.
+	ctx = oidc.ClientContext(context.WithoutCancel(ctx), &http.Client{Transport: tel.NewTransport(http.DefaultTransport)})
+	provider, err := oidc.NewProvider(ctx, p.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.audience})
+	return p.verifier, nil
+}
@@ -0,0 +1,165 @@
+package userstore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxAvatarSize is the largest avatar accepted, in bytes
+const maxAvatarSize = 5 << 20
+
+// avatarContentTypes are the image types accepted for avatars
+var avatarContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func PutAvatar(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "PutAvatar")
+	defer span.End()
+
+	err := authMiddleware(c, span)
+	if err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+	userID := id.Hex()
+	span.SetAttributes(attribute.String("user.id", userID))
+
+	contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || !avatarContentTypes[contentType] {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.request.header.content-type", c.GetHeader("Content-Type")),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusUnsupportedMediaType, "Unsupported avatar type", "avatars must be PNG, JPEG, GIF or WebP images")
+		return
+	}
+
+	// Nothing is stored for users that don't exist
+	if _, err := repo.FindByID(ctx, id); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+userID)
+			return
+		}
+
+		span.AddEvent("Error fetching user", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("db.system", "mongodb"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+
+	// The body is streamed to GridFS without being buffered in memory, the
+	// counter gives the real size even for chunked uploads without Content-Length
+	counter := &countingReader{r: http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize)}
+	defer func() {
+		trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attribute.Int64("http.request.body.size", counter.n))
+	}()
+
+	// Check the content really is the declared type before storing anything
+	body := bufio.NewReaderSize(counter, 512)
+	head, err := body.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		writeAvatarReadError(c, err)
+		return
+	}
+	if sniffed := http.DetectContentType(head); sniffed != contentType {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.request.header.content-type", contentType),
+			attribute.String("file.detected_type", sniffed),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusUnsupportedMediaType, "Avatar content does not match its type", "the uploaded data is "+sniffed+", not "+contentType)
+		return
+	}
+
+	size, err := repo.PutAvatar(ctx, userID, contentType, body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeAvatarReadError(c, err)
+			return
+		}
+
+		span.AddEvent("Error storing avatar", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("db.system", "mongodb"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing avatar"})
+		return
+	}
+
+	span.AddEvent("Avatar stored", trace.WithAttributes(
+		attribute.String("event.category", "database"),
+		attribute.String("event.type", "upload"),
+		attribute.String("db.system", "mongodb"),
+		attribute.Int64("file.size", size),
+		attribute.String("user.name", username),
+	))
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           userID,
+		"content_type": contentType,
+		"size":         size,
+	})
+}
+
+// writeAvatarReadError answers for a body that couldn't be read
+func writeAvatarReadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		abortWithProblem(c, http.StatusRequestEntityTooLarge, "Avatar too large", "avatars are limited to 5 MiB")
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
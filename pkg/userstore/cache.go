@@ -0,0 +1,359 @@
+package userstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// revalidateHeader marks the internal requests used to refresh stale entries,
+// which must reach the handler instead of being answered from the cache
+const revalidateHeader = "X-Cache-Revalidate"
+
+// cachedResponse is a stored 200 response
+type cachedResponse struct {
+	body        []byte
+	contentType string
+	etag        string
+	storedAt    time.Time
+}
+
+// responseCache caches GET responses keyed by path and query, serving them for
+// ttl and then, while a refresh runs in the background, for up to swr more.
+type responseCache struct {
+	ttl time.Duration
+	swr time.Duration
+
+	// handler serves the background revalidation requests
+	handler http.Handler
+
+	mu           sync.Mutex
+	entries      map[string]cachedResponse
+	revalidating map[string]bool
+
+	requests metric.Int64Counter
+}
+
+// userCache caches GET /user, it's cleared by every write to the users
+var userCache = newResponseCache(
+	durationFromEnv("CACHE_TTL", 5*time.Second),
+	durationFromEnv("CACHE_SWR", 30*time.Second),
+)
+
+// cacheMaxBody is the largest response stored, from CACHE_MAX_BODY_BYTES. A
+// bigger one is passed through without keeping a copy.
+var cacheMaxBody = intFromEnv("CACHE_MAX_BODY_BYTES", 1<<20)
+
+// cacheWarmPaths are requested at startup to fill the cache, CACHE_WARM_PATHS
+// lists them comma separated
+var cacheWarmPaths = pathsFromEnv("CACHE_WARM_PATHS", []string{"/api/v1/user", "/api/v2/user"})
+
+func pathsFromEnv(key string, fallback []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var paths []string
+	for _, path := range strings.Split(v, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d < 0 {
+		return fallback
+	}
+
+	return d
+}
+
+func newResponseCache(ttl, swr time.Duration) *responseCache {
+	requests, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Int64Counter(
+		"http.server.cache.requests",
+		metric.WithDescription("Number of cacheable requests by cache result (hit, stale or miss), giving the hit ratio"),
+		metric.WithUnit("{request}"),
+	)
+
+	return &responseCache{
+		ttl:          ttl,
+		swr:          swr,
+		entries:      map[string]cachedResponse{},
+		revalidating: map[string]bool{},
+		requests:     requests,
+	}
+}
+
+// invalidate drops every entry, after the underlying data has changed
+func (rc *responseCache) invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries = map[string]cachedResponse{}
+}
+
+// lookup returns the entry for key, whether it's still fresh, and whether it
+// may be served at all
+func (rc *responseCache) lookup(key string) (cachedResponse, bool, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		return entry, false, false
+	}
+
+	age := time.Since(entry.storedAt)
+	if age > rc.ttl+rc.swr {
+		delete(rc.entries, key)
+		return entry, false, false
+	}
+
+	return entry, age <= rc.ttl, true
+}
+
+func (rc *responseCache) store(key string, entry cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries[key] = entry
+}
+
+// middleware serves cached responses and stores successful ones. Requests that
+// aren't authenticated always reach the handler, so the cache never serves
+// data to a client the handler would have rejected.
+// The revalidation requests skip the lookup and store what the handler writes.
+func (rc *responseCache) middleware(c *gin.Context) {
+	if rc.ttl == 0 || c.Request.Method != http.MethodGet {
+		c.Next()
+		return
+	}
+
+	if _, err := authenticate(c); err != nil {
+		c.Next()
+		return
+	}
+
+	key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+	if enc := encoderFor(c); enc.name != encoders[0].name {
+		key += "#" + enc.name
+	}
+
+	if c.GetHeader(revalidateHeader) != "" {
+		rc.fill(c, key)
+		return
+	}
+
+	_, span := tel.CacheScope.StartInternalSpan(tel.Ctx(c), "cache.get", trace.WithAttributes(
+		attribute.String("cache.key", key),
+	))
+	entry, fresh, ok := rc.lookup(key)
+
+	result := "miss"
+	if ok && fresh {
+		result = "hit"
+	} else if ok {
+		result = "stale"
+	}
+	span.SetAttributes(attribute.String("cache.result", result))
+	span.End()
+
+	rc.requests.Add(tel.Ctx(c), 1, metric.WithAttributes(
+		attribute.String("http.route", c.FullPath()),
+		attribute.String("cache.result", result),
+	))
+
+	serverSpan := trace.SpanFromContext(tel.Ctx(c))
+	serverSpan.SetAttributes(attribute.Bool("http.response.from_cache", ok))
+
+	if !ok {
+		rc.fill(c, key)
+		return
+	}
+
+	if !fresh {
+		rc.revalidate(c, key)
+	}
+
+	c.Header("Age", ageHeader(entry.storedAt))
+	c.Header("X-Cache", result)
+	if entry.etag != "" {
+		c.Header("ETag", entry.etag)
+		if etagMatches(c.GetHeader("If-None-Match"), entry.etag) {
+			serverSpan.SetAttributes(attribute.Bool("http.response.cache_validated", true))
+			notModifiedCounter.Add(tel.Ctx(c), 1, metric.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", c.FullPath()),
+			))
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, entry.contentType, entry.body)
+	c.Abort()
+}
+
+// fill runs the handler and stores its response if it succeeded. A stream cut
+// off after the 200 went out is left out, as is a body over cacheMaxBody.
+func (rc *responseCache) fill(c *gin.Context, key string) {
+	writer := &capturingWriter{ResponseWriter: c.Writer, limit: cacheMaxBody}
+	c.Writer = writer
+	c.Header("X-Cache", "miss")
+
+	c.Next()
+
+	if writer.Status() == http.StatusOK && !writer.overflow && !c.GetBool(streamAbortedKey) {
+		rc.store(key, cachedResponse{
+			body:        writer.body.Bytes(),
+			contentType: writer.Header().Get("Content-Type"),
+			etag:        writer.Header().Get("ETag"),
+			storedAt:    time.Now(),
+		})
+	}
+}
+
+// revalidate refreshes a stale entry in the background by replaying the
+// request against the router. The refresh gets its own trace, linked to the
+// request that triggered it. The middleware stores the refreshed response.
+func (rc *responseCache) revalidate(c *gin.Context, key string) {
+	rc.mu.Lock()
+	if rc.revalidating[key] || rc.handler == nil {
+		rc.mu.Unlock()
+		return
+	}
+	rc.revalidating[key] = true
+	rc.mu.Unlock()
+
+	link := trace.LinkFromContext(tel.Ctx(c))
+	req := c.Request.Clone(context.Background())
+	req.Header.Del("traceparent")
+	req.Header.Del("tracestate")
+	req.Header.Del("If-None-Match")
+	req.Header.Set(revalidateHeader, "1")
+
+	go func() {
+		defer func() {
+			rc.mu.Lock()
+			delete(rc.revalidating, key)
+			rc.mu.Unlock()
+		}()
+
+		ctx, span := tel.CacheScope.StartInternalSpan(context.Background(), "cache.revalidate",
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+			trace.WithAttributes(attribute.String("cache.key", key)),
+		)
+		defer span.End()
+
+		recorder := newResponseRecorder()
+		rc.handler.ServeHTTP(recorder, req.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+	}()
+}
+
+// warm fills the entries of paths by requesting them through the router as
+// the service itself
+func (rc *responseCache) warm(ctx context.Context, paths []string) error {
+	if rc.ttl == 0 || rc.handler == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, path := range paths {
+		req, err := http.NewRequestWithContext(withInternalUser(ctx, "cache-warm"), http.MethodGet, path, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		recorder := newResponseRecorder()
+		rc.handler.ServeHTTP(recorder, req)
+		if recorder.status != http.StatusOK {
+			errs = append(errs, fmt.Errorf("GET %s: %d", path, recorder.status))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ageHeader is the Age value for an entry, in whole seconds
+func ageHeader(storedAt time.Time) string {
+	return strconv.Itoa(int(time.Since(storedAt).Seconds()))
+}
+
+// capturingWriter keeps a copy of the body written through it, up to limit
+// bytes. Past it the copy is dropped and overflow set.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *capturingWriter) capture(n int) bool {
+	if !w.overflow && w.body.Len()+n > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+	}
+
+	return !w.overflow
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	if w.capture(len(b)) {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	if w.capture(len(s)) {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// responseRecorder is a minimal http.ResponseWriter for the revalidation and
+// warming requests, which only need the status. The cache middleware keeps
+// the body.
+type responseRecorder struct {
+	header http.Header
+	status int
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) Write(b []byte) (int, error) { return len(b), nil }
+
+func (r *responseRecorder) WriteHeader(status int) { r.status = status }
+
+// InvalidateCache drops every cached response, for tests that change the
+// repository under the handlers
+func InvalidateCache() {
+	userCache.invalidate()
+}
@@ -0,0 +1,70 @@
+package userstore
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/cron"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// collectionStatsSchedule is when the size of the users collection is read
+// for its gauges, from CRON_COLLECTION_STATS, "off" disables them
+var collectionStatsSchedule = scheduleFromEnv("CRON_COLLECTION_STATS", cron.Every(time.Minute))
+
+// lastCollectionStats holds what the last run of the job read, the gauges
+// report it rather than running collStats at every collection
+var lastCollectionStats atomic.Pointer[CollectionStats]
+
+// readCollectionStats is the job refreshing lastCollectionStats
+func readCollectionStats(ctx context.Context) error {
+	stats, err := repo.CollectionStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	lastCollectionStats.Store(&stats)
+	return nil
+}
+
+// registerCollectionGauges reports the users collection document count and
+// sizes, with the db.* attributes of its database spans, once the job has
+// read them
+func registerCollectionGauges() {
+	meter := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore")
+
+	documents, _ := meter.Int64ObservableGauge("db.client.collection.document.count",
+		metric.WithDescription("Number of documents in the collection, as of the last collStats"),
+		metric.WithUnit("{document}"),
+	)
+	size, _ := meter.Int64ObservableGauge("db.client.collection.size",
+		metric.WithDescription("Size of the collection as of the last collStats, by db.mongodb.size.type: data (uncompressed), storage or index"),
+		metric.WithUnit("By"),
+	)
+
+	collection := []attribute.KeyValue{
+		attribute.String("db.system", mongoSystem),
+		attribute.String("db.namespace", mongoDB),
+		attribute.String("db.collection.name", UsersCol),
+	}
+	sizeAttrs := func(kind string) metric.ObserveOption {
+		return metric.WithAttributes(append(collection[:len(collection):len(collection)], attribute.String("db.mongodb.size.type", kind))...)
+	}
+	data, storage, index := sizeAttrs("data"), sizeAttrs("storage"), sizeAttrs("index")
+
+	meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := lastCollectionStats.Load()
+		if stats == nil {
+			return nil
+		}
+
+		o.ObserveInt64(documents, stats.Count, metric.WithAttributes(collection...))
+		o.ObserveInt64(size, stats.Size, data)
+		o.ObserveInt64(size, stats.StorageSize, storage)
+		o.ObserveInt64(size, stats.TotalIndexSize, index)
+		return nil
+	}, documents, size)
+}
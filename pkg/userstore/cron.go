@@ -0,0 +1,67 @@
+package userstore
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/cron"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// purgeAvatarsSchedule is when the avatars of deleted users are removed, from
+// CRON_PURGE_AVATARS, "off" disables the job
+var purgeAvatarsSchedule = scheduleFromEnv("CRON_PURGE_AVATARS", cron.Daily(3, 0))
+
+// scheduler runs the background jobs between the startup and shutdown hooks
+var scheduler = newScheduler()
+
+func newScheduler() *cron.Scheduler {
+	s := cron.New()
+	if purgeAvatarsSchedule != nil {
+		s.Add(cron.Job{Name: "purge_avatars", Schedule: purgeAvatarsSchedule, Run: purgeAvatars, Timeout: 10 * time.Minute})
+	}
+	if collectionStatsSchedule != nil {
+		s.Add(cron.Job{Name: "collection_stats", Schedule: collectionStatsSchedule, Run: readCollectionStats, Timeout: 30 * time.Second})
+		registerCollectionGauges()
+	}
+
+	return s
+}
+
+func scheduleFromEnv(key string, fallback cron.Schedule) cron.Schedule {
+	v := os.Getenv(key)
+	switch v {
+	case "":
+		return fallback
+	case "off":
+		return nil
+	}
+
+	s, err := cron.ParseSchedule(v)
+	if err != nil {
+		logging.Default().Warn("Ignoring invalid schedule", "key", key, "error", err)
+		return fallback
+	}
+
+	return s
+}
+
+// purgeAvatars removes the avatars deleting a user leaves behind
+func purgeAvatars(ctx context.Context) error {
+	purged, err := repo.PurgeAvatars(ctx)
+	if err != nil {
+		return err
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("userstore.avatars.purged", purged))
+	cron.RecordBatch(ctx, purged)
+	if purged > 0 {
+		logging.FromContext(ctx).Info("Purged avatars of deleted users", "count", purged)
+		userCache.invalidate()
+	}
+
+	return nil
+}
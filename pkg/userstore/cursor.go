@@ -0,0 +1,165 @@
+package userstore
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MONGO_CURSOR_BATCHES decides how the getMore batches of a cursor show up
+// under the span of the operation iterating it: "spans" (default) gives each
+// batch its own child span, "events" adds an event per batch instead, "off"
+// leaves them collapsed into the operation span.
+var cursorBatches = cursorBatchesFromEnv()
+
+const (
+	cursorBatchSpans  = "spans"
+	cursorBatchEvents = "events"
+	cursorBatchOff    = "off"
+)
+
+func cursorBatchesFromEnv() string {
+	switch v := os.Getenv("MONGO_CURSOR_BATCHES"); v {
+	case cursorBatchEvents, cursorBatchOff:
+		return v
+	default:
+		return cursorBatchSpans
+	}
+}
+
+// batchesByCursor numbers the batches of each open cursor, the first batch
+// comes with the find or aggregate itself
+var batchesByCursor sync.Map
+
+// getMores holds the batches in flight by request ID
+var getMores sync.Map
+
+type getMore struct {
+	span     trace.Span
+	parent   trace.Span
+	cursorID int64
+	batch    int64
+	start    time.Time
+}
+
+// startGetMore follows a getMore sent for the operation of ctx
+func startGetMore(ctx context.Context, e *event.CommandStartedEvent) {
+	parent := trace.SpanFromContext(ctx)
+	if cursorBatches == cursorBatchOff || !parent.IsRecording() {
+		return
+	}
+
+	cursorID, _ := e.Command.Lookup("getMore").AsInt64OK()
+	collection, _ := e.Command.Lookup("collection").StringValueOK()
+	batch := int64(2)
+	if n, ok := batchesByCursor.Load(cursorID); ok {
+		batch = n.(int64) + 1
+	}
+	batchesByCursor.Store(cursorID, batch)
+
+	g := &getMore{parent: parent, cursorID: cursorID, batch: batch, start: time.Now()}
+	if cursorBatches == cursorBatchSpans {
+		attrs := []attribute.KeyValue{
+			attribute.String("db.system", mongoSystem),
+			attribute.String("db.namespace", mongoDB),
+			attribute.String("db.operation.name", "getMore"),
+			attribute.String("db.collection.name", collection),
+			attribute.Int64("db.mongodb.cursor.id", cursorID),
+			attribute.Int64("db.mongodb.cursor.batch", batch),
+		}
+		if size, ok := e.Command.Lookup("batchSize").AsInt64OK(); ok {
+			attrs = append(attrs, attribute.Int64("db.mongodb.cursor.batch_size", size))
+		}
+		_, g.span = tel.RepositoryScope.StartClientSpan(ctx, "getMore "+collection, trace.WithAttributes(attrs...))
+	}
+
+	getMores.Store(e.RequestID, g)
+}
+
+// endGetMore records the size of the batch, reply is nil when it failed
+func endGetMore(requestID int64, reply bson.Raw, err string) {
+	v, ok := getMores.LoadAndDelete(requestID)
+	if !ok {
+		return
+	}
+	g := v.(*getMore)
+
+	var rows int
+	exhausted := false
+	if reply != nil {
+		if docs, ok := reply.Lookup("cursor", "nextBatch").ArrayOK(); ok {
+			values, _ := docs.Values()
+			rows = len(values)
+		}
+		id, _ := reply.Lookup("cursor", "id").AsInt64OK()
+		exhausted = id == 0
+	}
+	if exhausted || err != "" {
+		batchesByCursor.Delete(g.cursorID)
+	}
+
+	if g.span == nil {
+		attrs := []attribute.KeyValue{
+			attribute.Int64("db.mongodb.cursor.batch", g.batch),
+			attribute.Int("db.response.returned_rows", rows),
+			attribute.Float64("db.mongodb.cursor.batch_duration", time.Since(g.start).Seconds()),
+			attribute.Bool("db.mongodb.cursor.exhausted", exhausted),
+		}
+		if err != "" {
+			attrs = append(attrs, attribute.String("error.message", err))
+		}
+		g.parent.AddEvent("getMore", trace.WithAttributes(attrs...))
+		return
+	}
+
+	g.span.SetAttributes(
+		attribute.Int("db.response.returned_rows", rows),
+		attribute.Bool("db.mongodb.cursor.exhausted", exhausted),
+	)
+	if err != "" {
+		g.span.SetStatus(codes.Error, err)
+	}
+	g.span.End()
+}
+
+// recordFirstBatch notes the size of the batch returned with the find or
+// aggregate that opened a cursor
+func recordFirstBatch(ctx context.Context, reply bson.Raw) {
+	span := trace.SpanFromContext(ctx)
+	if cursorBatches == cursorBatchOff || !span.IsRecording() {
+		return
+	}
+
+	docs, ok := reply.Lookup("cursor", "firstBatch").ArrayOK()
+	if !ok {
+		return
+	}
+	values, _ := docs.Values()
+	span.SetAttributes(attribute.Int("db.mongodb.cursor.first_batch_size", len(values)))
+
+	if id, _ := reply.Lookup("cursor", "id").AsInt64OK(); id != 0 {
+		batchesByCursor.Store(id, int64(1))
+	}
+}
+
+// forgetCursors drops the numbering of the cursors closed before the end
+func forgetCursors(e *event.CommandStartedEvent) {
+	ids, ok := e.Command.Lookup("cursors").ArrayOK()
+	if !ok {
+		return
+	}
+	values, _ := ids.Values()
+	for _, v := range values {
+		if id, ok := v.AsInt64OK(); ok {
+			batchesByCursor.Delete(id)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package userstore
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+)
+
+// debugGroup serves the troubleshooting endpoints, which need a token
+var debugGroup = routeGroupFromEnv("DEBUG", RouteGroup{
+	Name: "debug",
+	Auth: true,
+})
+
+// RegisterDebug installs GET /debug/telemetry, answering the effective
+// telemetry setup of t: resource, scopes, sampler, exporter targets with the
+// headers masked, and propagators
+func RegisterDebug(router *gin.Engine, t *tel.Telemetry) {
+	install(router, []routeTable{{
+		Prefix: "/debug",
+		Group:  &debugGroup,
+		Routes: []Route{
+			{Method: http.MethodGet, Path: "/telemetry", Handlers: []gin.HandlerFunc{func(c *gin.Context) {
+				c.Header("Cache-Control", "no-store")
+				c.JSON(http.StatusOK, t.Describe())
+			}}},
+		},
+	}})
+}
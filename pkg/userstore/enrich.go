@@ -0,0 +1,145 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// Avatar describes the stored avatar of a user
+type Avatar struct {
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// Preferences are the free form settings of a user, stored as a subdocument
+// of the user
+type Preferences map[string]any
+
+// ErrAvatarNotFound is returned when a user hasn't uploaded an avatar
+var ErrAvatarNotFound = errors.New("avatar not found")
+
+// enrichTimeout bounds the whole enrichment, a slow part is reported as
+// failed instead of holding the response
+var enrichTimeout = durationFromEnv("USER_ENRICH_TIMEOUT", 500*time.Millisecond)
+
+// enrichment is what's added to a user by enrichUser. Errors holds the parts
+// that couldn't be fetched.
+type enrichment struct {
+	Groups      []Group
+	Preferences Preferences
+	Avatar      *Avatar
+	Errors      map[string]error
+}
+
+// enrichUser fetches the groups, preferences and avatar of the user
+// concurrently, each in its own span. A failing part doesn't fail the others
+// or the request: it's left out, recorded as an event on span and listed in
+// Errors.
+func enrichUser(ctx context.Context, span trace.Span, id primitive.ObjectID) enrichment {
+	ctx, cancel := context.WithTimeout(ctx, enrichTimeout)
+	defer cancel()
+
+	var (
+		result  enrichment
+		partErr = make([]error, 3)
+	)
+
+	// No errgroup.WithContext: the first failure would cancel the other parts
+	var g errgroup.Group
+	g.Go(enrichPart(ctx, "EnrichGroups", &partErr[0], func(ctx context.Context) (err error) {
+		result.Groups, err = repo.FindGroups(ctx, id)
+		return err
+	}))
+	g.Go(enrichPart(ctx, "EnrichPreferences", &partErr[1], func(ctx context.Context) (err error) {
+		result.Preferences, err = repo.FindPreferences(ctx, id)
+		return err
+	}))
+	g.Go(enrichPart(ctx, "EnrichAvatar", &partErr[2], func(ctx context.Context) error {
+		avatar, err := repo.FindAvatar(ctx, id.Hex())
+		if errors.Is(err, ErrAvatarNotFound) {
+			return nil
+		}
+		if err == nil {
+			result.Avatar = &avatar
+		}
+		return err
+	}))
+	g.Wait()
+
+	for i, part := range []string{"groups", "preferences", "avatar"} {
+		if partErr[i] == nil {
+			continue
+		}
+
+		if result.Errors == nil {
+			result.Errors = map[string]error{}
+		}
+		result.Errors[part] = partErr[i]
+		span.AddEvent("Error enriching user", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "enrichment"),
+			attribute.String("enrichment.part", part),
+			attribute.String("error.message", partErr[i].Error()),
+		))
+	}
+
+	span.SetAttributes(
+		attribute.Bool("user.enrichment.partial", len(result.Errors) > 0),
+		attribute.Int("user.enrichment.failed_parts", len(result.Errors)),
+	)
+
+	return result
+}
+
+// enrichPart runs fetch in a child span named name, storing its error in err
+func enrichPart(ctx context.Context, name string, err *error, fetch func(ctx context.Context) error) func() error {
+	return func() error {
+		ctx, span := tel.HTTPScope.StartInternalSpan(ctx, name)
+		defer span.End()
+
+		if *err = fetch(ctx); *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+
+		// The error is reported per part, not through the group
+		return nil
+	}
+}
+
+// response adds the enrichment to the body of GET /user/:id
+func (e enrichment) response(user Users) gin.H {
+	// the preferences are served next to the user with the other parts
+	user.Preferences = nil
+	body := gin.H{
+		"user":        user,
+		"groups":      e.Groups,
+		"preferences": e.Preferences,
+		"avatar":      e.Avatar,
+	}
+
+	if len(e.Errors) > 0 {
+		// The database errors stay in the spans
+		errs := gin.H{}
+		for part, err := range e.Errors {
+			errs[part] = "unavailable"
+			if isDeadlineExceeded(err) {
+				errs[part] = "timed out"
+			}
+		}
+		body["partial"] = true
+		body["errors"] = errs
+	}
+
+	return body
+}
@@ -0,0 +1,85 @@
+package userstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// notModifiedCounter counts responses answered with 304 so the rate can be
+// compared against the total number of GET requests.
+var notModifiedCounter, _ = otel.Meter("user-service").Int64Counter(
+	"http.server.response.not_modified",
+	metric.WithDescription("Number of conditional GET requests answered with 304 Not Modified"),
+	metric.WithUnit("{response}"),
+)
+
+// generateETag returns a strong ETag computed from the JSON representation of v
+func generateETag(v any) (string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether the If-None-Match header matches the given ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeConditional sets the ETag header for v and answers with 304 when the
+// client already holds the current representation. It returns true if the
+// response has been written.
+func writeConditional(c *gin.Context, span trace.Span, v any) bool {
+	etag, err := generateETag(v)
+	if err != nil {
+		// Serve the full response without an ETag rather than failing the request
+		span.AddEvent("Error generating ETag", trace.WithAttributes(
+			attribute.String("error.message", err.Error()),
+		))
+		return false
+	}
+
+	// each representation gets its own tag, they aren't byte for byte the same
+	if enc := encoderFor(c); enc.name != encoders[0].name {
+		etag = strings.TrimSuffix(etag, `"`) + "-" + enc.name + `"`
+	}
+	c.Header("ETag", etag)
+
+	validated := etagMatches(c.GetHeader("If-None-Match"), etag)
+	span.SetAttributes(attribute.Bool("http.response.cache_validated", validated))
+	if !validated {
+		return false
+	}
+
+	notModifiedCounter.Add(tel.Ctx(c), 1, metric.WithAttributes(
+		attribute.String("http.request.method", c.Request.Method),
+		attribute.String("http.route", c.FullPath()),
+	))
+
+	c.Status(http.StatusNotModified)
+	return true
+}
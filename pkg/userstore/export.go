@@ -0,0 +1,154 @@
+package userstore
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// exportBatchSize is the number of users fetched from the cursor at a time
+	exportBatchSize = 500
+	// exportProgressRows is how often a progress event is added to the span,
+	// and the response flushed to the client
+	exportProgressRows = 1000
+
+	// exportRowsTrailer and exportEndTrailer are the trailers giving the rows
+	// written and why the export ended, as the status is sent before both
+	exportRowsTrailer = "X-Export-Rows"
+	exportEndTrailer  = "X-Export-End-Reason"
+)
+
+// userEncoder writes users in one of the export formats
+type userEncoder interface {
+	Encode(user Users) error
+	Flush() error
+}
+
+type csvUserEncoder struct{ w *csv.Writer }
+
+func (e csvUserEncoder) Encode(user Users) error {
+	return e.w.Write([]string{user.ID, user.Name, strconv.Itoa(user.PhoneNo)})
+}
+
+func (e csvUserEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonUserEncoder struct{ enc *json.Encoder }
+
+func (e ndjsonUserEncoder) Encode(user Users) error { return e.enc.Encode(user) }
+
+func (e ndjsonUserEncoder) Flush() error { return nil }
+
+// ExportUsers streams every user as CSV or NDJSON, reading them from the cursor
+// in batches so the collection is never loaded in memory all at once. Writes
+// block while the client is slow to read, which holds back the next batch.
+func ExportUsers(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "ExportUsers")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	format := c.DefaultQuery("format", "ndjson")
+	span.SetAttributes(
+		attribute.String("user.name", c.GetString("username")),
+		attribute.String("export.format", format),
+	)
+
+	var enc userEncoder
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv")
+		w := csv.NewWriter(c.Writer)
+		enc = csvUserEncoder{w: w}
+		// The header row, in the JSON field names
+		w.Write([]string{"id", "name", "phone_no"})
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+		enc = ndjsonUserEncoder{enc: json.NewEncoder(c.Writer)}
+	default:
+		abortWithProblem(c, http.StatusBadRequest, "Invalid format", "format must be csv or ndjson")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="users.`+format+`"`)
+	// The totals are only known once the body is written, they follow it
+	c.Header("Trailer", exportRowsTrailer+", "+exportEndTrailer)
+	c.Status(http.StatusOK)
+
+	var written int64
+	endReason := "incomplete"
+	// The server span ends after this handler, whatever cut the stream
+	middleware.LateAttributes(ctx, func() []attribute.KeyValue {
+		return []attribute.KeyValue{
+			attribute.Int("http.response.body.size", c.Writer.Size()),
+			attribute.Int64("userstore.stream.events", written),
+			attribute.String("userstore.stream.end_reason", endReason),
+		}
+	})
+
+	flush := func() error {
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	rows, err := repo.Each(ctx, Scan{BatchSize: exportBatchSize}, func(user Users) error {
+		if err := enc.Encode(user); err != nil {
+			return err
+		}
+
+		written++
+		if written%exportProgressRows == 0 {
+			span.AddEvent("export.progress", trace.WithAttributes(attribute.Int64("export.rows", written)))
+			return flush()
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	endReason = streamEndReason(ctx, err)
+	c.Writer.Header().Set(exportRowsTrailer, strconv.FormatInt(rows, 10))
+	c.Writer.Header().Set(exportEndTrailer, endReason)
+
+	span.SetAttributes(attribute.Int64("export.rows", rows))
+	if err != nil {
+		// The status has been sent already, the client sees a truncated body
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// streamEndReason tells why a stream stopped: complete, client_gone when the
+// client went away, timeout when the request ran out of time, or error
+func streamEndReason(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "complete"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "timeout"
+	case ctx.Err() != nil:
+		return "client_gone"
+	default:
+		return "error"
+	}
+}
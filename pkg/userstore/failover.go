@@ -0,0 +1,94 @@
+package userstore
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kinds of primary changes seen by the server monitor
+const (
+	changeStepDown = "step_down"
+	changeElected  = "elected"
+)
+
+// mongoReplicaSet and mongoRetryWrites complete the MONGO_URI, which may
+// already list several hosts of a replica set
+var (
+	mongoReplicaSet  = os.Getenv("MONGO_REPLICA_SET")
+	mongoRetryWrites = boolFromEnv("MONGO_RETRY_WRITES", true)
+)
+
+// inFlight holds the spans of the commands sent and not answered yet, by
+// request id, so a failover can be recorded on the operations it hits
+var inFlight sync.Map
+
+var topologyChanges, _ = otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Int64Counter(
+	"db.client.mongodb.topology.changes",
+	metric.WithDescription("Number of primary step downs and elections seen by the driver"),
+	metric.WithUnit("{change}"),
+)
+
+// trackCommand remembers the span of a started command
+func trackCommand(ctx context.Context, e *event.CommandStartedEvent) {
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		inFlight.Store(e.RequestID, span)
+	}
+}
+
+func untrackCommand(requestID int64) {
+	inFlight.Delete(requestID)
+}
+
+// primaryChange tells whether a server stepped down from or was elected as
+// the primary, or "" when its role didn't change. Finding the primary when
+// connecting isn't an election.
+func primaryChange(e *event.ServerDescriptionChangedEvent) string {
+	was := e.PreviousDescription.Kind == description.RSPrimary
+	is := e.NewDescription.Kind == description.RSPrimary
+
+	switch {
+	case was && !is:
+		return changeStepDown
+	case !was && is && e.PreviousDescription.Kind != description.Unknown:
+		return changeElected
+	default:
+		return ""
+	}
+}
+
+// recordServerChange keeps the server type used on the spans up to date, and
+// reports primary step downs and elections: a counter, a log, and an event on
+// every operation still waiting for an answer
+func recordServerChange(e *event.ServerDescriptionChangedEvent) {
+	addr := e.Address.String()
+	serverTypes.Store(addr, e.NewDescription.Kind.String())
+
+	change := primaryChange(e)
+	if change == "" {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.mongodb.topology.change", change),
+		attribute.String("server.address", addr),
+		attribute.String("db.mongodb.server.previous_type", e.PreviousDescription.Kind.String()),
+		attribute.String("db.mongodb.server.type", e.NewDescription.Kind.String()),
+	}
+
+	topologyChanges.Add(context.Background(), 1, metric.WithAttributes(attrs[:2]...))
+	logging.Default().Warn("MongoDB primary changed", "change", change, "server", addr)
+
+	inFlight.Range(func(_, span any) bool {
+		span.(trace.Span).AddEvent("db.mongodb.failover", trace.WithAttributes(attrs...))
+		return true
+	})
+}
@@ -0,0 +1,112 @@
+package userstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// userFields maps the JSON names of the Users fields, as used in fields=, to
+// the names they are stored under in Mongo
+var userFields = map[string]string{
+	"id":       "id",
+	"name":     "name",
+	"phone_no": "phoneno",
+}
+
+// parseFields parses a comma separated fields= value into JSON field names.
+// An empty value selects every field and returns nil.
+func parseFields(v string) ([]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields, unknown []string
+	seen := map[string]bool{}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+
+		if _, ok := userFields[f]; !ok {
+			unknown = append(unknown, f)
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown fields %s, valid fields are %s", strings.Join(unknown, ", "), strings.Join(validFields(), ", "))
+	}
+
+	return fields, nil
+}
+
+func validFields() []string {
+	names := make([]string, 0, len(userFields))
+	for name := range userFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// projection returns the Mongo projection for the JSON field names, or nil for all fields
+func projection(fields []string) bson.D {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	p := bson.D{{Key: "_id", Value: 0}}
+	for _, f := range fields {
+		p = append(p, bson.E{Key: userFields[f], Value: 1})
+	}
+
+	return p
+}
+
+// findQueryText renders the find command for the db.query.text attribute. Only
+// the shape is included, the projection never holds user data.
+func findQueryText(fields []string) string {
+	query := bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.D{}}}
+	if p := projection(fields); p != nil {
+		query = append(query, bson.E{Key: "projection", Value: p})
+	}
+
+	text, err := bson.MarshalExtJSON(query, false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(text)
+}
+
+// selectFields renders user with only the requested JSON fields
+func selectFields(user Users, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return user, nil
+	}
+
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+
+	partial := make(map[string]any, len(fields))
+	for _, f := range fields {
+		partial[f] = all[f]
+	}
+
+	return partial, nil
+}
@@ -0,0 +1,137 @@
+package userstore
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Group is the membership of a user in a group
+type Group struct {
+	Name string `json:"name" bson:"group" binding:"required"`
+	Role string `json:"role" bson:"role" binding:"required"`
+}
+
+// parseUserID parses the :id path parameter, answering 400 when it isn't an ObjectID
+func parseUserID(c *gin.Context, span trace.Span) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", c.GetString("username")),
+		))
+		abortWithProblem(c, http.StatusBadRequest, "Invalid user id", "id must be a 24 character hex ObjectID")
+		return id, false
+	}
+
+	return id, true
+}
+
+// GetUserGroups returns the groups of the user with the ObjectID in the path
+func GetUserGroups(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUserGroups")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	groups, err := repo.FindGroups(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+	if err != nil {
+		span.AddEvent("Error fetching user groups", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user groups"})
+		return
+	}
+
+	if groups == nil {
+		groups = []Group{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+	})
+}
+
+// PostUserGroup adds the user with the ObjectID in the path to a group
+func PostUserGroup(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "PostUserGroup")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	group := Group{}
+	if err := c.ShouldBindJSON(&group); err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", "POST"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusBadRequest, "Invalid group", err.Error())
+		return
+	}
+
+	err := repo.AddGroup(ctx, id, group)
+	if errors.Is(err, ErrUserNotFound) {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+	if err != nil {
+		span.AddEvent("Error adding user group", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding user group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group": group,
+	})
+}
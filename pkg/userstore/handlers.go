@@ -0,0 +1,285 @@
+package userstore
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var UsersCol = "users"
+
+type Users struct {
+	ID          string      `json:"id" binding:"required"`
+	Name        string      `json:"name" binding:"required"`
+	PhoneNo     int         `json:"phone_no" binding:"required"`
+	Preferences Preferences `json:"preferences,omitempty" bson:"preferences,omitempty"`
+
+	// Password is only read from requests, PasswordHash is what's stored and
+	// is never written back
+	Password     Password `json:"password,omitempty" bson:"-"`
+	PasswordHash string   `json:"-" bson:"password_hash,omitempty"`
+}
+
+// Middleware for authentication
+func authMiddleware(c *gin.Context, span trace.Span) error {
+	username, err := authenticate(c)
+	if err != nil {
+		// Add an event to the span, indicating an error
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", err.Error()),
+			attribute.String("event.type", "auth"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return err
+	}
+
+	// Attach username to the context
+	c.Set("username", username)
+	c.Next()
+	return nil
+}
+
+// Register installs the userstore routes of routeTables on router. The
+// readiness gate holds traffic back until RunStartup has completed.
+func Register(router *gin.Engine) {
+	router.Use(readinessGate)
+	userCache.handler = router
+	router.SetHTMLTemplate(uiTemplates)
+
+	install(router, routeTables())
+	router.NoRoute(middleware.NoRoute())
+}
+
+func GetUser(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUser")
+	defer span.End()
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	authMiddleware(c, span)
+
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", "GET"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusBadRequest, "Invalid fields parameter", err.Error())
+		return
+	}
+
+	// JSON is written as the users come off the cursor, at most userListLimit
+	list := newUserList(c)
+	rows, err := repo.Each(ctx, Scan{BatchSize: userListBatchSize, Fields: fields, Limit: int64(userListLimit)}, func(user Users) error {
+		details, err := selectFields(user, fields)
+		if err != nil {
+			return err
+		}
+		return list.add(details)
+	})
+	span.SetAttributes(
+		attribute.Int64("db.response.returned_rows", rows),
+		attribute.Bool("userstore.response.truncated", rows == int64(userListLimit)),
+	)
+	if err != nil {
+		// Add an event to the span, indicating an error
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		// The status is gone with the first user, the client gets a cut
+		// off array
+		if list.started {
+			list.abort()
+			return
+		}
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user details)"})
+		return
+	}
+
+	span.AddEvent("User details retrieved", trace.WithAttributes(
+		attribute.String("event.category", "database"),
+		attribute.String("event.type", "query"),
+		attribute.String("db.system", "mongodb"),
+		attribute.String("http.method", "GET"),
+		attribute.String("user.name", username),
+	))
+
+	// If successful, return the user info
+	list.close(span)
+}
+
+// GetUserByID returns the user stored under the ObjectID in the path
+func GetUserByID(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUserByID")
+	defer span.End()
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	user, err := repo.FindByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+	if err != nil {
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user details"})
+		return
+	}
+
+	// The ETag covers the groups, preferences and avatar too
+	body := enrichUser(ctx, span, id).response(user)
+	if writeConditional(c, span, body) {
+		return
+	}
+
+	respond(c, http.StatusOK, body)
+}
+
+func PostUser(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "PostUser")
+	defer span.End()
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	err := authMiddleware(c, span)
+	if err != nil {
+		return
+	}
+
+	user := Users{}
+	if err := c.ShouldBindJSON(&user); err != nil {
+		// Add an event to the span for input validation failure
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", "POST"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !storePassword(ctx, c, span, &user) {
+		return
+	}
+
+	details, err := repo.Insert(ctx, user)
+	if err != nil {
+		// Add an event to the span indicating a database error
+		span.AddEvent("Error posting user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("db.system", "mongodb"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error posting user details"})
+		return
+	}
+
+	userCache.invalidate()
+
+	// Add a successful event for the user creation
+	span.AddEvent("User details posted", trace.WithAttributes(
+		attribute.String("event.category", "database"),
+		attribute.String("event.type", "insert"),
+		attribute.String("db.system", "mongodb"),
+		attribute.String("http.method", "POST"),
+		attribute.String("user.name", username),
+	))
+
+	if etag, err := generateETag(details); err == nil {
+		c.Header("ETag", etag)
+	}
+
+	// If successful, return the user info
+	respond(c, http.StatusOK, gin.H{
+		"user": details,
+	})
+}
+
+// DeleteUser removes the user stored under the ObjectID in the path
+func DeleteUser(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "DeleteUser")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	deleted, err := repo.DeleteMany(ctx, bson.M{"_id": id})
+	if err != nil {
+		span.AddEvent("Error deleting user", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+	if deleted == 0 {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+
+	userCache.invalidate()
+
+	c.Status(http.StatusNoContent)
+}
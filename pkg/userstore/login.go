@@ -0,0 +1,263 @@
+package userstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jwtTTL is how long the tokens issued by /auth/login are valid, from
+// AUTH_JWT_TTL (default 1h)
+var jwtTTL = durationFromEnv("AUTH_JWT_TTL", time.Hour)
+
+// jwtIssuer is the iss claim of the tokens, from AUTH_JWT_ISSUER
+var jwtIssuer = stringFromEnv("AUTH_JWT_ISSUER", "userstore")
+
+// jwtSecret signs the tokens with HS256, from AUTH_JWT_SECRET. Without it a
+// random key is made, and the tokens don't outlive the process.
+var jwtSecret = sync.OnceValue(func() []byte {
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	logging.Default().Warn("AUTH_JWT_SECRET is not set, the login tokens are signed with a random key")
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+})
+
+func stringFromEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// loginAttempts counts the logins by auth.outcome: success,
+// invalid_credentials or error
+var loginAttempts, _ = otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Int64Counter(
+	"userstore.auth.login.attempts",
+	metric.WithDescription("Number of login attempts by outcome"),
+	metric.WithUnit("{attempt}"),
+)
+
+// Login outcomes, recorded as auth.outcome
+const (
+	loginSuccess            = "success"
+	loginInvalidCredentials = "invalid_credentials"
+	loginError              = "error"
+)
+
+// errInvalidCredentials is the one answer to an unknown user, a user without
+// a password and a wrong password, so a login can't tell which users exist
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// loginRequest is the body of POST /auth/login, the username being the id of
+// the user
+type loginRequest struct {
+	Username string   `json:"username" binding:"required"`
+	Password Password `json:"password" binding:"required"`
+}
+
+// loginResponse follows the OAuth 2.0 token response (RFC 6749 5.1)
+type loginResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// PostLogin checks the credentials against the users collection and issues a
+// JWT for the user. The spans only get enduser.id once the password matched,
+// a failed attempt records the outcome but not who it claimed to be.
+func PostLogin(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "Login")
+	defer span.End()
+
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username and password are required"})
+		return
+	}
+
+	user, err := repo.FindCredentials(ctx, req.Username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		span.AddEvent("Error getting user credentials", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+		))
+		span.SetStatus(codes.Error, "Error getting user credentials")
+		recordLogin(c, span, loginError)
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user credentials"})
+		return
+	}
+
+	if !verifyCredentials(ctx, user, req.Password) {
+		span.AddEvent("Authentication failed", trace.WithAttributes(
+			attribute.String("event.category", "auth"),
+			attribute.String("event.type", "error"),
+			attribute.String("error.message", errInvalidCredentials.Error()),
+		))
+		recordLogin(c, span, loginInvalidCredentials)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidCredentials.Error()})
+		return
+	}
+
+	now := time.Now()
+	token, err := signJWT(user.ID, now)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		recordLogin(c, span, loginError)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing token"})
+		return
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("enduser.id", user.ID), attribute.String("auth.provider", "jwt")}
+	span.SetAttributes(attrs...)
+	trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attrs...)
+	recordLogin(c, span, loginSuccess)
+
+	c.JSON(http.StatusOK, loginResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(jwtTTL.Seconds())})
+}
+
+// recordLogin sets auth.outcome on the login and server spans and counts it
+func recordLogin(c *gin.Context, span trace.Span, outcome string) {
+	attr := attribute.String("auth.outcome", outcome)
+	span.SetAttributes(attr)
+	trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attr)
+	loginAttempts.Add(tel.Ctx(c), 1, metric.WithAttributes(attr))
+}
+
+// dummyPasswordHash is checked against when the user is unknown or has no
+// password, so those logins take as long as a wrong password
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword(context.Background(), "not the password of anyone")
+	return hash
+})
+
+// verifyCredentials reports whether p is the password of user
+func verifyCredentials(ctx context.Context, user Users, p Password) bool {
+	hash := user.PasswordHash
+	if hash == "" {
+		hash = dummyPasswordHash()
+	}
+
+	_, span := tel.HTTPScope.StartInternalSpan(ctx, "CheckPassword")
+	defer span.End()
+
+	ok, err := checkPassword(hash, p)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return ok && user.PasswordHash != ""
+}
+
+// jwtHeader is the header of every token, only HS256 is issued and accepted
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type jwtClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// signJWT issues a token for subject valid for jwtTTL from now
+func signJWT(subject string, now time.Time) (string, error) {
+	claims, err := json.Marshal(jwtClaims{
+		Issuer:    jwtIssuer,
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(jwtTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + jwtSignature(signed), nil
+}
+
+func jwtSignature(signed string) string {
+	mac := hmac.New(sha256.New, jwtSecret())
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+var errInvalidJWT = errors.New("invalid token")
+
+// errForeignJWT is returned for the tokens of other issuers or keys, which are
+// no credentials for jwtProvider and left to the next providers, e.g. OIDC
+var errForeignJWT = fmt.Errorf("%w: not issued by this service", errNoCredentials)
+
+// verifyJWT returns the subject of a token signed by signJWT that hasn't
+// expired yet
+func verifyJWT(token string, now time.Time) (string, error) {
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != jwtHeader {
+		return "", errForeignJWT
+	}
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(jwtSignature(header+"."+payload))) {
+		return "", errForeignJWT
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errInvalidJWT
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(raw, &claims); err != nil || claims.Subject == "" {
+		return "", errInvalidJWT
+	}
+	if claims.Issuer != jwtIssuer {
+		return "", errForeignJWT
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return "", errors.New("token expired")
+	}
+
+	return claims.Subject, nil
+}
+
+// jwtProvider accepts the bearer tokens issued by /auth/login. It has to come
+// before token in AUTH_PROVIDERS, which takes any bearer token. JWTs of other
+// issuers or keys go on to the next providers.
+type jwtProvider struct{}
+
+func (jwtProvider) Name() string   { return "jwt" }
+func (jwtProvider) Header() string { return "Authorization" }
+
+func (jwtProvider) Authenticate(r *http.Request) (string, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return "", errNoCredentials
+	}
+
+	return verifyJWT(token, time.Now())
+}
@@ -0,0 +1,69 @@
+package userstore
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Migrations are the data migrations of the userstore, applied by RunStartup
+// unless MIGRATE_ON_STARTUP is false, or by cmd/migrate
+var Migrations = []migrate.Migration{
+	{
+		Version: 1,
+		Name:    "backfill_users_created_at",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// The creation time of the ObjectID is the best guess for older users
+			_, err := db.Collection(UsersCol).UpdateMany(ctx,
+				bson.M{"created_at": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version: 2,
+		Name:    "default_group_role",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(GroupsCol).UpdateMany(ctx,
+				bson.M{"role": bson.M{"$in": bson.A{nil, ""}}},
+				bson.M{"$set": bson.M{"role": "member"}},
+			)
+			return err
+		},
+	},
+}
+
+// migrateOnStartup runs the migrations as a startup step, from MIGRATE_ON_STARTUP
+var migrateOnStartup = boolFromEnv("MIGRATE_ON_STARTUP", true)
+
+func boolFromEnv(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return v
+}
+
+// ResourceAttributes describe the data this build expects, to be added to the
+// telemetry resource: db.schema.version is the latest migration version.
+func ResourceAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("db.schema.version", migrate.Latest(Migrations)),
+	}
+}
+
+func (r MongoRepository) Migrate(ctx context.Context) (int, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return migrate.Run(ctx, client.Database(mongoDB), Migrations)
+}
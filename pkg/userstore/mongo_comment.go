@@ -0,0 +1,31 @@
+package userstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceComments enables tagging Mongo operations with the current trace context
+// through the $comment field, so entries in the server's slow query log can be
+// correlated back to application traces. Set MONGO_TRACE_COMMENTS=true to enable.
+var traceComments, _ = strconv.ParseBool(os.Getenv("MONGO_TRACE_COMMENTS"))
+
+// traceComment returns the $comment value for the operation running in ctx, or
+// "" when the option is disabled or there is no valid span context. The value
+// is formatted as a W3C traceparent so it can be pasted straight into a backend.
+func traceComment(ctx context.Context) string {
+	if !traceComments {
+		return ""
+	}
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+
+	return fmt.Sprintf("traceparent=00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
@@ -0,0 +1,265 @@
+package userstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/ugorji/go/codec"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// encoder writes response bodies in one media type
+type encoder struct {
+	name        string
+	mediaTypes  []string
+	contentType string
+	encode      func(v any) ([]byte, error)
+}
+
+// encoders are the representations of the user endpoints, the first one is
+// the default
+var encoders = []encoder{
+	{name: "json", mediaTypes: []string{"application/json"}, contentType: "application/json; charset=utf-8", encode: json.Marshal},
+	{name: "xml", mediaTypes: []string{"application/xml", "text/xml"}, contentType: "application/xml; charset=utf-8", encode: encodeXML},
+	{name: "msgpack", mediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}, contentType: "application/msgpack", encode: encodeMsgpack},
+}
+
+const encoderKey = "response.encoder"
+
+var encodeDuration, _ = otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Float64Histogram(
+	"http.server.response.encode.duration",
+	metric.WithDescription("Time spent encoding response bodies, by content type"),
+	metric.WithUnit("s"),
+)
+
+// negotiate picks the encoder of the response from the Accept header, and
+// answers 406 when none of the accepted types can be written
+func negotiate(c *gin.Context) {
+	enc, ok := selectEncoder(c.GetHeader("Accept"))
+	if !ok {
+		abortWithProblem(c, http.StatusNotAcceptable, "Not acceptable",
+			"supported types are application/json, application/xml and application/msgpack")
+		return
+	}
+
+	c.Set(encoderKey, enc)
+	c.Writer.Header().Add("Vary", "Accept")
+	trace.SpanFromContext(tel.Ctx(c)).SetAttributes(
+		attribute.StringSlice("http.response.header.content-type", []string{enc.contentType}),
+	)
+	c.Next()
+}
+
+// selectEncoder returns the encoder of the accepted type with the highest
+// quality, ties going to the order of the header
+func selectEncoder(accept string) (encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], true
+	}
+
+	best, bestQ := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		for i, enc := range encoders {
+			if mediaType == "*/*" || mediaType == "application/*" || slices.Contains(enc.mediaTypes, mediaType) {
+				best, bestQ = i, q
+				break
+			}
+		}
+	}
+
+	if best < 0 {
+		return encoder{}, false
+	}
+
+	return encoders[best], true
+}
+
+// encoderFor is the encoder negotiate picked, JSON on routes without it
+func encoderFor(c *gin.Context) encoder {
+	if enc, ok := c.Get(encoderKey); ok {
+		return enc.(encoder)
+	}
+
+	return encoders[0]
+}
+
+// respond writes v in the negotiated representation
+func respond(c *gin.Context, status int, v any) {
+	enc := encoderFor(c)
+
+	start := time.Now()
+	body, err := enc.encode(v)
+	encodeDuration.Record(tel.Ctx(c), time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("http.route", c.FullPath()),
+		attribute.String("http.response.content_type", enc.name),
+	))
+	if err != nil {
+		trace.SpanFromContext(tel.Ctx(c)).AddEvent("Error encoding response", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "encode"),
+			attribute.String("error.message", err.Error()),
+		))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error encoding response"})
+		return
+	}
+
+	c.Data(status, enc.contentType, body)
+}
+
+// generic turns v into the maps, slices and scalars of its JSON form, so every
+// representation carries the same fields under the same names
+func generic(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var out any
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return numbers(out), nil
+}
+
+// numbers replaces the json.Numbers by int64 or float64
+func numbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	return v
+}
+
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+
+func encodeMsgpack(v any) ([]byte, error) {
+	g, err := generic(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	err = codec.NewEncoderBytes(&out, msgpackHandle).Encode(g)
+	return out, err
+}
+
+// xmlName matches the keys usable as element names, others are written as
+// <entry key="...">
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeXML writes the JSON form of v under a <response> element: objects
+// become child elements, arrays repeated <item> elements
+func encodeXML(v any) ([]byte, error) {
+	g, err := generic(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := writeXML(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, g); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeXML(enc *xml.Encoder, start xml.StartElement, v any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !xmlName.MatchString(k) {
+				child = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}}}
+			}
+			if err := writeXML(enc, child, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if err := writeXML(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, e); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmtScalar(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+func fmtScalar(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		raw, _ := json.Marshal(v)
+		return string(raw)
+	}
+}
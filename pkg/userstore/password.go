@@ -0,0 +1,180 @@
+package userstore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password is a clear-text password read from a request body. It's never
+// stored, and fmt, slog and JSON all print it masked, so logging a user or
+// putting one in an attribute can't leak it.
+type Password string
+
+const maskedPassword = "[REDACTED]"
+
+func (p Password) String() string               { return maskedPassword }
+func (p Password) GoString() string             { return `"` + maskedPassword + `"` }
+func (p Password) LogValue() slog.Value         { return slog.StringValue(maskedPassword) }
+func (p Password) MarshalJSON() ([]byte, error) { return json.Marshal(maskedPassword) }
+
+// UnmarshalJSON is needed since MarshalJSON would otherwise make the type
+// decode through the masked form
+func (p *Password) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*p = Password(s)
+
+	return nil
+}
+
+// passwordHashing is PASSWORD_HASH: bcrypt (the default) or argon2id. The
+// stored hashes say which algorithm made them, so changing it only affects
+// the new passwords.
+var passwordHashing = passwordHashFromEnv()
+
+// bcryptCost is PASSWORD_BCRYPT_COST, bcrypt.DefaultCost (10) by default
+var bcryptCost = intFromEnv("PASSWORD_BCRYPT_COST", bcrypt.DefaultCost)
+
+// argon2id parameters, the ones RFC 9106 recommends for memory constrained
+// servers
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+func passwordHashFromEnv() string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_HASH"))); v {
+	case "argon2id", "argon2":
+		return "argon2id"
+	default:
+		return "bcrypt"
+	}
+}
+
+// HashPassword hashes p the way the handlers do before storing users, for the
+// commands writing users to the repository directly like cmd/seed
+func HashPassword(ctx context.Context, p Password) (string, error) {
+	return hashPassword(ctx, p)
+}
+
+// hashPassword hashes p for storage, an empty password hashes to "". Only the
+// algorithm is traced, not the password or its hash.
+func hashPassword(ctx context.Context, p Password) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+
+	_, span := tel.HTTPScope.StartInternalSpan(ctx, "HashPassword")
+	defer span.End()
+	span.SetAttributes(attribute.String("password.hash.algorithm", passwordHashing))
+
+	var hash string
+	var err error
+	switch passwordHashing {
+	case "argon2id":
+		hash, err = hashArgon2id(p)
+	default:
+		var b []byte
+		b, err = bcrypt.GenerateFromPassword([]byte(p), bcryptCost)
+		hash = string(b)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// hashArgon2id returns the PHC string of p, e.g.
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func hashArgon2id(p Password) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(p), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+var errUnknownHash = errors.New("unknown password hash")
+
+// checkPassword reports whether p matches hash, whichever algorithm made it
+func checkPassword(hash string, p Password) (bool, error) {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(p))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	var version int
+	var memory uint32
+	var time uint32
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, errUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, errUnknownHash
+	}
+
+	other := argon2.IDKey([]byte(p), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// storePassword replaces the password of user by its hash, answering 500 when
+// it can't be hashed
+func storePassword(ctx context.Context, c *gin.Context, span trace.Span, user *Users) bool {
+	hash, err := hashPassword(ctx, user.Password)
+	if err != nil {
+		span.AddEvent("Error hashing password", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "password"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", c.GetString("username")),
+		))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return false
+	}
+
+	user.PasswordHash, user.Password = hash, ""
+	return true
+}
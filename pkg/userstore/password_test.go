@@ -0,0 +1,137 @@
+package userstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = Password("correct horse battery staple")
+
+func TestHashPassword(t *testing.T) {
+	defer func(hashing string, cost int) { passwordHashing, bcryptCost = hashing, cost }(passwordHashing, bcryptCost)
+	bcryptCost = bcrypt.MinCost
+
+	for _, tc := range []struct {
+		algorithm string
+		prefix    string
+	}{
+		{algorithm: "bcrypt", prefix: "$2a$"},
+		{algorithm: "argon2id", prefix: "$argon2id$v=19$m=65536,t=3,p=4$"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			passwordHashing = tc.algorithm
+
+			hash, err := hashPassword(context.Background(), testPassword)
+			if err != nil {
+				t.Fatalf("hashPassword: %v", err)
+			}
+			if !strings.HasPrefix(hash, tc.prefix) {
+				t.Errorf("hash is %q, want it to start with %q", hash, tc.prefix)
+			}
+			if strings.Contains(hash, string(testPassword)) {
+				t.Errorf("hash %q holds the password", hash)
+			}
+
+			other, err := hashPassword(context.Background(), testPassword)
+			if err != nil {
+				t.Fatalf("hashPassword: %v", err)
+			}
+			if other == hash {
+				t.Errorf("hashing twice gave the same hash %q, want a new salt each time", hash)
+			}
+
+			if ok, err := checkPassword(hash, testPassword); !ok || err != nil {
+				t.Errorf("checkPassword with the password = %t, %v, want true, nil", ok, err)
+			}
+			if ok, err := checkPassword(hash, "not "+testPassword); ok || err != nil {
+				t.Errorf("checkPassword with another password = %t, %v, want false, nil", ok, err)
+			}
+		})
+	}
+}
+
+func TestHashEmptyPassword(t *testing.T) {
+	hash, err := hashPassword(context.Background(), "")
+	if hash != "" || err != nil {
+		t.Errorf("hashPassword of an empty password = %q, %v, want \"\", nil", hash, err)
+	}
+}
+
+func TestCheckPasswordOtherAlgorithm(t *testing.T) {
+	defer func(hashing string) { passwordHashing = hashing }(passwordHashing)
+
+	// hashes made before PASSWORD_HASH changed must still be accepted
+	passwordHashing = "argon2id"
+	hash, err := hashPassword(context.Background(), testPassword)
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	passwordHashing = "bcrypt"
+
+	if ok, err := checkPassword(hash, testPassword); !ok || err != nil {
+		t.Errorf("checkPassword of an argon2id hash = %t, %v, want true, nil", ok, err)
+	}
+}
+
+func TestCheckPasswordMalformedHash(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA",
+		"$argon2id$v=18$m=65536,t=3,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=lots$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=4$!!!$a2V5",
+	} {
+		if ok, err := checkPassword(hash, testPassword); ok || err != errUnknownHash {
+			t.Errorf("checkPassword(%q) = %t, %v, want false, %v", hash, ok, err, errUnknownHash)
+		}
+	}
+
+	if ok, err := checkPassword("plain text", testPassword); ok || err == nil {
+		t.Errorf("checkPassword of a non hash = %t, %v, want false and an error", ok, err)
+	}
+}
+
+func TestPasswordMasked(t *testing.T) {
+	user := Users{ID: "alice", Name: "Alice", PhoneNo: 5550100, Password: testPassword}
+
+	body, err := json.Marshal(user)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logged, nil)).Info("user", "password", user.Password, "user", user)
+
+	for name, out := range map[string]string{
+		"json": string(body),
+		"%v":   fmt.Sprintf("%v", user),
+		"%+v":  fmt.Sprintf("%+v", user),
+		"%#v":  fmt.Sprintf("%#v", user),
+		"%s":   fmt.Sprintf("%s", user.Password),
+		"slog": logged.String(),
+	} {
+		if strings.Contains(out, string(testPassword)) {
+			t.Errorf("%s output holds the password: %s", name, out)
+		}
+		if !strings.Contains(out, maskedPassword) {
+			t.Errorf("%s output doesn't hold %s: %s", name, maskedPassword, out)
+		}
+	}
+}
+
+func TestPasswordUnmarshal(t *testing.T) {
+	var user Users
+	if err := json.Unmarshal([]byte(`{"id":"alice","password":"`+string(testPassword)+`"}`), &user); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	if user.Password != testPassword {
+		t.Errorf("decoded password is %q, want the clear text", string(user.Password))
+	}
+}
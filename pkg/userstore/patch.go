@@ -0,0 +1,219 @@
+package userstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mergePatchContentType is the media type of RFC 7386 JSON Merge Patches
+const mergePatchContentType = "application/merge-patch+json"
+
+// mergePatch is a user update translated to MongoDB: the dotted paths to
+// $set and those to $unset
+type mergePatch struct {
+	set   bson.M
+	unset bson.M
+}
+
+// update returns the update document, nil when the patch changes nothing
+func (p mergePatch) update() bson.M {
+	update := bson.M{}
+	if len(p.set) > 0 {
+		update["$set"] = p.set
+	}
+	if len(p.unset) > 0 {
+		update["$unset"] = p.unset
+	}
+	if len(update) == 0 {
+		return nil
+	}
+
+	return update
+}
+
+// paths lists the changed fields, never their values
+func (p mergePatch) paths() []string {
+	paths := make([]string, 0, len(p.set)+len(p.unset))
+	for path := range p.set {
+		paths = append(paths, path)
+	}
+	for path := range p.unset {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// parseMergePatch translates a merge patch of a user into $set and $unset on
+// the stored field names. name and phone_no can be replaced but not removed, id
+// can't change, and the preferences are merged key by key as the RFC describes
+// for objects.
+func parseMergePatch(doc map[string]any) (mergePatch, error) {
+	p := mergePatch{set: bson.M{}, unset: bson.M{}}
+
+	for field, value := range doc {
+		switch field {
+		case "name":
+			name, ok := value.(string)
+			if !ok || name == "" {
+				return p, errors.New("name must be a non-empty string")
+			}
+			p.set[userFields["name"]] = name
+		case "phone_no":
+			n, ok := value.(json.Number)
+			if !ok {
+				return p, errors.New("phone_no must be a number")
+			}
+			phone, err := n.Int64()
+			if err != nil {
+				return p, errors.New("phone_no must be an integer")
+			}
+			p.set[userFields["phone_no"]] = phone
+		case "preferences":
+			if value == nil {
+				p.unset["preferences"] = ""
+				continue
+			}
+			prefs, ok := value.(map[string]any)
+			if !ok {
+				return p, errors.New("preferences must be an object or null")
+			}
+			if err := p.merge("preferences", prefs); err != nil {
+				return p, err
+			}
+		case "id":
+			return p, errors.New("id can't be changed")
+		default:
+			return p, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	return p, nil
+}
+
+// merge adds the changes of the patch object to the subdocument at prefix
+func (p mergePatch) merge(prefix string, patch map[string]any) error {
+	for key, value := range patch {
+		// the keys become field paths, they can't hold operators or dots
+		if key == "" || strings.HasPrefix(key, "$") || strings.Contains(key, ".") {
+			return fmt.Errorf("invalid key %q in %s", key, prefix)
+		}
+
+		path := prefix + "." + key
+		switch value := value.(type) {
+		case nil:
+			p.unset[path] = ""
+		case map[string]any:
+			if err := p.merge(path, value); err != nil {
+				return err
+			}
+		default:
+			p.set[path] = value
+		}
+	}
+
+	return nil
+}
+
+// PatchUser updates a user from a JSON Merge Patch:
+//
+//	PATCH /api/v1/user/:id
+//	Content-Type: application/merge-patch+json
+//
+//	{"name": "Jane", "preferences": {"theme": "dark", "language": null}}
+func PatchUser(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "PatchUser")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	// application/json is accepted too, the body is read as a merge patch either way
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != mergePatchContentType && mediaType != "application/json" {
+		abortWithProblem(c, http.StatusUnsupportedMediaType, "Unsupported patch type", "send a JSON Merge Patch as "+mergePatchContentType)
+		return
+	}
+
+	var doc map[string]any
+	dec := json.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+	err := dec.Decode(&doc)
+	if err == nil && doc == nil {
+		err = errors.New("the patch must be a JSON object")
+	}
+	var patch mergePatch
+	if err == nil {
+		patch, err = parseMergePatch(doc)
+	}
+	if err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", "PATCH"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusBadRequest, "Invalid merge patch", err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int("user.patch.fields_set", len(patch.set)),
+		attribute.Int("user.patch.fields_unset", len(patch.unset)),
+		attribute.StringSlice("user.patch.fields", patch.paths()),
+	)
+
+	// An empty patch changes nothing, the user is answered as is
+	var user Users
+	if update := patch.update(); update != nil {
+		user, err = repo.Update(ctx, id, update)
+	} else {
+		user, err = repo.FindByID(ctx, id)
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+	if err != nil {
+		span.AddEvent("Error patching user", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error patching user"})
+		return
+	}
+
+	userCache.invalidate()
+
+	respond(c, http.StatusOK, gin.H{
+		"user": user,
+	})
+}
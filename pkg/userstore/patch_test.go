@@ -0,0 +1,82 @@
+package userstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		patch string
+		set   bson.M
+		unset bson.M
+		err   string
+	}{
+		{
+			name:  "set stored field names",
+			patch: `{"name": "Jane", "phone_no": 5550100}`,
+			set:   bson.M{"name": "Jane", "phoneno": int64(5550100)},
+			unset: bson.M{},
+		},
+		{
+			name:  "unset preferences",
+			patch: `{"preferences": null}`,
+			set:   bson.M{},
+			unset: bson.M{"preferences": ""},
+		},
+		{
+			name:  "nested preferences",
+			patch: `{"preferences": {"theme": "dark", "language": null, "notifications": {"email": false, "sms": null}}}`,
+			set:   bson.M{"preferences.theme": "dark", "preferences.notifications.email": false},
+			unset: bson.M{"preferences.language": "", "preferences.notifications.sms": ""},
+		},
+		{
+			name:  "empty patch",
+			patch: `{}`,
+			set:   bson.M{},
+			unset: bson.M{},
+		},
+		{name: "operator key", patch: `{"preferences": {"$where": "1"}}`, err: `invalid key "$where" in preferences`},
+		{name: "nested operator key", patch: `{"preferences": {"a": {"$set": 1}}}`, err: `invalid key "$set" in preferences.a`},
+		{name: "dotted key", patch: `{"preferences": {"a.b": 1}}`, err: `invalid key "a.b" in preferences`},
+		{name: "empty key", patch: `{"preferences": {"": 1}}`, err: `invalid key "" in preferences`},
+		{name: "stored name", patch: `{"phoneno": 5550100}`, err: `unknown field "phoneno"`},
+		{name: "id", patch: `{"id": "42"}`, err: "id can't be changed"},
+		{name: "empty name", patch: `{"name": ""}`, err: "name must be a non-empty string"},
+		{name: "removed name", patch: `{"name": null}`, err: "name must be a non-empty string"},
+		{name: "fractional phone", patch: `{"phone_no": 1.5}`, err: "phone_no must be an integer"},
+		{name: "preferences array", patch: `{"preferences": []}`, err: "preferences must be an object or null"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc map[string]any
+			dec := json.NewDecoder(strings.NewReader(tc.patch))
+			dec.UseNumber()
+			if err := dec.Decode(&doc); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := parseMergePatch(doc)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("parseMergePatch() error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMergePatch() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(p.set, tc.set) {
+				t.Errorf("set = %v, want %v", p.set, tc.set)
+			}
+			if !reflect.DeepEqual(p.unset, tc.unset) {
+				t.Errorf("unset = %v, want %v", p.unset, tc.unset)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mongoPoolSpanEvents adds the pool clears and the connections closed on an
+// error as events on the operations in flight, MONGO_POOL_SPAN_EVENTS
+var mongoPoolSpanEvents = boolFromEnv("MONGO_POOL_SPAN_EVENTS", false)
+
+// The connection pool metrics, db.client.connection.* as in the semantic
+// conventions, plus the checkouts and the connections opened and closed
+var (
+	poolMeter = otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore")
+
+	poolConnections, _ = poolMeter.Int64UpDownCounter("db.client.connection.count",
+		metric.WithDescription("Number of connections in the pool, by state"),
+		metric.WithUnit("{connection}"),
+	)
+	poolPending, _ = poolMeter.Int64UpDownCounter("db.client.connection.pending_requests",
+		metric.WithDescription("Number of operations waiting for a connection"),
+		metric.WithUnit("{request}"),
+	)
+	poolWaitTime, _ = poolMeter.Float64Histogram("db.client.connection.wait_time",
+		metric.WithDescription("Time it took to check out a connection"),
+		metric.WithUnit("s"),
+	)
+	poolCreateTime, _ = poolMeter.Float64Histogram("db.client.connection.create_time",
+		metric.WithDescription("Time it took to open and handshake a connection"),
+		metric.WithUnit("s"),
+	)
+	poolTimeouts, _ = poolMeter.Int64Counter("db.client.connection.timeouts",
+		metric.WithDescription("Number of checkouts that timed out waiting for a connection"),
+		metric.WithUnit("{timeout}"),
+	)
+	poolCheckouts, _ = poolMeter.Int64Counter("db.client.connection.checkouts",
+		metric.WithDescription("Number of connections checked out, by outcome"),
+		metric.WithUnit("{checkout}"),
+	)
+	poolCreated, _ = poolMeter.Int64Counter("db.client.connection.created",
+		metric.WithDescription("Number of connections opened"),
+		metric.WithUnit("{connection}"),
+	)
+	poolClosed, _ = poolMeter.Int64Counter("db.client.connection.closed",
+		metric.WithDescription("Number of connections closed, by reason"),
+		metric.WithUnit("{connection}"),
+	)
+)
+
+// pooledConnections remembers the state of the ready connections, so closing
+// one that never finished its handshake doesn't make the count go negative
+var pooledConnections sync.Map
+
+type pooledConnection struct {
+	address string
+	id      uint64
+}
+
+const (
+	connectionIdle = "idle"
+	connectionUsed = "used"
+)
+
+// recordPoolEvent turns the pool events of the driver into metrics
+func recordPoolEvent(e *event.PoolEvent) {
+	ctx := context.Background()
+	pool := attribute.String("db.client.connection.pool.name", e.Address)
+	conn := pooledConnection{address: e.Address, id: e.ConnectionID}
+
+	switch e.Type {
+	case event.ConnectionCreated:
+		poolCreated.Add(ctx, 1, metric.WithAttributes(pool))
+	case event.ConnectionReady:
+		poolCreateTime.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(pool))
+		pooledConnections.Store(conn, connectionIdle)
+		addConnections(ctx, pool, connectionIdle, 1)
+	case event.ConnectionClosed:
+		poolClosed.Add(ctx, 1, metric.WithAttributes(pool, attribute.String("db.client.connection.close_reason", e.Reason)))
+		if state, ok := pooledConnections.LoadAndDelete(conn); ok {
+			addConnections(ctx, pool, state.(string), -1)
+		}
+		if e.Reason == event.ReasonConnectionErrored || e.Reason == event.ReasonError {
+			addPoolSpanEvent(e)
+		}
+	case event.GetStarted:
+		poolPending.Add(ctx, 1, metric.WithAttributes(pool))
+	case event.GetSucceeded:
+		poolPending.Add(ctx, -1, metric.WithAttributes(pool))
+		poolWaitTime.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(pool))
+		poolCheckouts.Add(ctx, 1, metric.WithAttributes(pool, attribute.String("db.client.connection.checkout.outcome", "success")))
+		if _, ok := pooledConnections.Load(conn); ok {
+			pooledConnections.Store(conn, connectionUsed)
+			addConnections(ctx, pool, connectionIdle, -1)
+			addConnections(ctx, pool, connectionUsed, 1)
+		}
+	case event.GetFailed:
+		poolPending.Add(ctx, -1, metric.WithAttributes(pool))
+		poolWaitTime.Record(ctx, e.Duration.Seconds(), metric.WithAttributes(pool))
+		poolCheckouts.Add(ctx, 1, metric.WithAttributes(pool, attribute.String("db.client.connection.checkout.outcome", e.Reason)))
+		if e.Reason == event.ReasonTimedOut {
+			poolTimeouts.Add(ctx, 1, metric.WithAttributes(pool))
+		}
+	case event.ConnectionReturned:
+		if state, ok := pooledConnections.Load(conn); ok && state == connectionUsed {
+			pooledConnections.Store(conn, connectionIdle)
+			addConnections(ctx, pool, connectionUsed, -1)
+			addConnections(ctx, pool, connectionIdle, 1)
+		}
+	case event.PoolCleared:
+		addPoolSpanEvent(e)
+	}
+}
+
+func addConnections(ctx context.Context, pool attribute.KeyValue, state string, n int64) {
+	poolConnections.Add(ctx, n, metric.WithAttributes(pool, attribute.String("db.client.connection.state", state)))
+}
+
+// addPoolSpanEvent records a pool clear or a broken connection on every
+// operation waiting for an answer, they're likely to fail because of it. The
+// pool events don't tell which operation they belong to.
+func addPoolSpanEvent(e *event.PoolEvent) {
+	if !mongoPoolSpanEvents {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.client.connection.pool.name", e.Address),
+		attribute.String("db.mongodb.pool.event", e.Type),
+	}
+	if e.Reason != "" {
+		attrs = append(attrs, attribute.String("db.mongodb.pool.reason", e.Reason))
+	}
+	if e.Error != nil && !errors.Is(e.Error, context.Canceled) {
+		attrs = append(attrs, attribute.String("error.message", e.Error.Error()))
+	}
+
+	inFlight.Range(func(_, span any) bool {
+		span.(trace.Span).AddEvent("db.mongodb.pool", trace.WithAttributes(attrs...))
+		return true
+	})
+}
@@ -0,0 +1,175 @@
+package userstore
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// queryPlaceholder replaces every literal value in db.query.text
+const queryPlaceholder = "?"
+
+// sanitizeQuery returns a copy of a BSON filter or update with every value
+// replaced by a placeholder. Field names and operators are kept, so the query
+// shape stays visible in traces without any of the user data:
+// {"email": "a@b.c", "age": {"$gt": 30}} becomes {"age": {"$gt": "?"}, "email": "?"}.
+func sanitizeQuery(v any) any {
+	switch v := v.(type) {
+	case bson.D:
+		out := make(bson.D, 0, len(v))
+		for _, e := range v {
+			if keepQueryValue[e.Key] {
+				out = append(out, e)
+				continue
+			}
+			out = append(out, bson.E{Key: e.Key, Value: sanitizeQuery(e.Value)})
+		}
+		return out
+	case bson.M:
+		return sanitizeMap(v)
+	case map[string]any:
+		return sanitizeMap(v)
+	case bson.A:
+		return sanitizeArray([]any(v))
+	case []any:
+		return sanitizeArray(v)
+	default:
+		return queryPlaceholder
+	}
+}
+
+// keepQueryValue lists the aggregation stages whose arguments only name
+// collections and fields, and are kept as they are
+var keepQueryValue = map[string]bool{
+	"$lookup": true,
+	"$unwind": true,
+}
+
+// sanitizeMap sorts the keys so the same filter always renders the same way
+func sanitizeMap(m map[string]any) bson.D {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(bson.D, 0, len(m))
+	for _, k := range keys {
+		if keepQueryValue[k] {
+			out = append(out, bson.E{Key: k, Value: m[k]})
+			continue
+		}
+		out = append(out, bson.E{Key: k, Value: sanitizeQuery(m[k])})
+	}
+
+	return out
+}
+
+// sanitizeArray keeps the sub-documents of arrays such as $and and $or, and
+// collapses arrays of values ($in, $nin...) to a single placeholder so their
+// length doesn't show either.
+func sanitizeArray(a []any) any {
+	out := bson.A{}
+	for _, v := range a {
+		s := sanitizeQuery(v)
+		if s == queryPlaceholder {
+			return bson.A{queryPlaceholder}
+		}
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// queryText renders a sanitized filter for the db.query.text attribute
+func queryText(filter any) string {
+	if filter == nil {
+		return "{}"
+	}
+
+	text, err := bson.MarshalExtJSON(sanitizeQuery(filter), false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(text)
+}
+
+// updateQueryText renders a sanitized findAndModify command for db.query.text,
+// the update keeping its operators and the paths it changes
+func updateQueryText(collection string, filter, update any) string {
+	text, err := bson.MarshalExtJSON(bson.D{
+		{Key: "findAndModify", Value: collection},
+		{Key: "query", Value: sanitizeQuery(filter)},
+		{Key: "update", Value: sanitizeQuery(update)},
+	}, false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(text)
+}
+
+// updateManyQueryText renders a sanitized multi-document update command for
+// db.query.text, with the filter and the update of its single statement
+func updateManyQueryText(collection string, filter, update any) string {
+	text, err := bson.MarshalExtJSON(bson.D{
+		{Key: "update", Value: collection},
+		{Key: "updates", Value: bson.A{bson.D{
+			{Key: "q", Value: sanitizeQuery(filter)},
+			{Key: "u", Value: sanitizeQuery(update)},
+			{Key: "multi", Value: true},
+		}}},
+	}, false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(text)
+}
+
+// pipelineText renders a sanitized aggregate command for db.query.text
+func pipelineText(collection string, pipeline mongo.Pipeline) string {
+	stages := bson.A{}
+	for _, stage := range pipeline {
+		stages = append(stages, sanitizeQuery(stage))
+	}
+
+	text, err := bson.MarshalExtJSON(bson.D{{Key: "aggregate", Value: collection}, {Key: "pipeline", Value: stages}}, false, false)
+	if err != nil {
+		return "{}"
+	}
+
+	return string(text)
+}
+
+// pipelineSummary lists the stages of an aggregation for db.query.summary,
+// with the collection joined by each $lookup, e.g.
+// "aggregate users $match $lookup user_groups $project"
+func pipelineSummary(collection string, pipeline mongo.Pipeline) string {
+	summary := querySummary("aggregate", collection)
+	for _, stage := range pipeline {
+		for _, e := range stage {
+			summary += " " + e.Key
+			if lookup, ok := e.Value.(bson.D); ok && e.Key == "$lookup" {
+				for _, arg := range lookup {
+					if from, ok := arg.Value.(string); ok && arg.Key == "from" {
+						summary += " " + from
+					}
+				}
+			}
+		}
+	}
+
+	return summary
+}
+
+// querySummary is the low cardinality db.query.summary, e.g. "findOne users"
+func querySummary(operation, collection string) string {
+	if collection == "" {
+		return operation
+	}
+
+	return operation + " " + collection
+}
@@ -0,0 +1,141 @@
+package userstore
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Kinds of reads with their own read preference
+const (
+	readFind  = "find"
+	readCount = "count"
+)
+
+// readPreferences holds the read preference of each kind of read, from
+// MONGO_READ_PREFERENCE_FIND and MONGO_READ_PREFERENCE_COUNT, falling back to
+// MONGO_READ_PREFERENCE and then to primary. Writes always go to the primary.
+var readPreferences = map[string]string{
+	readFind:  readPreferenceFromEnv("MONGO_READ_PREFERENCE_FIND"),
+	readCount: readPreferenceFromEnv("MONGO_READ_PREFERENCE_COUNT"),
+}
+
+func readPreferenceFromEnv(key string) string {
+	for _, name := range []string{os.Getenv(key), os.Getenv("MONGO_READ_PREFERENCE")} {
+		if name == "" {
+			continue
+		}
+		if _, err := readpref.ModeFromString(name); err != nil {
+			logging.Default().Warn("Ignoring invalid read preference", "name", name)
+			continue
+		}
+		return name
+	}
+
+	return "primary"
+}
+
+// readPreference returns the driver read preference for a kind of read
+func readPreference(kind string) *readpref.ReadPref {
+	mode, err := readpref.ModeFromString(readPreferences[kind])
+	if err != nil {
+		return readpref.Primary()
+	}
+
+	rp, err := readpref.New(mode)
+	if err != nil {
+		return readpref.Primary()
+	}
+
+	return rp
+}
+
+// readPreferenceAttribute is the db.mongodb.read_preference of a kind of read
+func readPreferenceAttribute(kind string) attribute.KeyValue {
+	return attribute.String("db.mongodb.read_preference", readPreferences[kind])
+}
+
+// serverTypes remembers the type of every server seen by the drivers (e.g.
+// RSPrimary, RSSecondary), keyed by address
+var serverTypes sync.Map
+
+// clientOptions returns the options for connecting to uri, with the monitors
+// telling the spans which server served each command and reporting failovers
+func clientOptions(uri string) *options.ClientOptions {
+	opts := options.Client().
+		ApplyURI(uri).
+		SetRetryWrites(mongoRetryWrites).
+		SetServerMonitor(&event.ServerMonitor{
+			ServerDescriptionChanged: recordServerChange,
+		}).
+		SetPoolMonitor(&event.PoolMonitor{
+			Event: recordPoolEvent,
+		}).
+		SetMonitor(&event.CommandMonitor{
+			Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+				switch e.CommandName {
+				case "getMore":
+					startGetMore(ctx, e)
+				case "killCursors":
+					forgetCursors(e)
+				}
+				tagSelectedServer(ctx, e)
+				trackCommand(ctx, e)
+			},
+			Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+				untrackCommand(e.RequestID)
+				switch e.CommandName {
+				case "getMore":
+					endGetMore(e.RequestID, e.Reply, "")
+				case "find", "aggregate":
+					recordFirstBatch(ctx, e.Reply)
+				}
+			},
+			Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+				untrackCommand(e.RequestID)
+				if e.CommandName == "getMore" {
+					endGetMore(e.RequestID, nil, e.Failure)
+				}
+			},
+		})
+
+	if mongoReplicaSet != "" {
+		opts.SetReplicaSet(mongoReplicaSet)
+	}
+
+	return opts
+}
+
+// tagSelectedServer records the server a command was sent to on the current
+// span, which is the database span of the operation
+func tagSelectedServer(ctx context.Context, e *event.CommandStartedEvent) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	// ConnectionID looks like "host:port[-12]"
+	addr, _, _ := strings.Cut(e.ConnectionID, "[")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("network.peer.address", host),
+		attribute.String("network.peer.port", port),
+	)
+
+	if kind, ok := serverTypes.Load(addr); ok {
+		span.SetAttributes(attribute.String("db.mongodb.server.type", kind.(string)))
+	}
+}
@@ -0,0 +1,223 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errConnectionDropped is returned for the requests the chaos middleware chose
+// to cut off from the database
+var errConnectionDropped = errors.New("connection to the database dropped (chaos fault)")
+
+// chaosRepository fails every call made for a request flagged by
+// middleware.Chaos, and is a pass-through otherwise.
+type chaosRepository struct {
+	next UserRepository
+}
+
+// NewChaosRepository wraps next so the chaos middleware can drop database
+// connections. It goes under NewInstrumentedRepository so the failures show
+// up on the database spans.
+func NewChaosRepository(next UserRepository) UserRepository {
+	return chaosRepository{next: next}
+}
+
+// Server forwards to the wrapped repository for the peer attributes
+func (r chaosRepository) Server() (string, string) {
+	if s, ok := r.next.(interface{ Server() (string, string) }); ok {
+		return s.Server()
+	}
+
+	return "", ""
+}
+
+// dropped returns errConnectionDropped if the request the call is made for
+// has been flagged, tagging the current span with the fault
+func (r chaosRepository) dropped(ctx context.Context) error {
+	if !middleware.ChaosDropDB(ctx) {
+		return nil
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("chaos.fault", middleware.FaultDBDrop))
+	return errConnectionDropped
+}
+
+func (r chaosRepository) Ping(ctx context.Context) error {
+	if err := r.dropped(ctx); err != nil {
+		return err
+	}
+
+	return r.next.Ping(ctx)
+}
+
+func (r chaosRepository) EnsureIndexes(ctx context.Context) error {
+	if err := r.dropped(ctx); err != nil {
+		return err
+	}
+
+	return r.next.EnsureIndexes(ctx)
+}
+
+func (r chaosRepository) FindAll(ctx context.Context, fields []string) ([]Users, error) {
+	if err := r.dropped(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.next.FindAll(ctx, fields)
+}
+
+func (r chaosRepository) FindByID(ctx context.Context, id primitive.ObjectID) (Users, error) {
+	if err := r.dropped(ctx); err != nil {
+		return Users{}, err
+	}
+
+	return r.next.FindByID(ctx, id)
+}
+
+func (r chaosRepository) FindCredentials(ctx context.Context, userID string) (Users, error) {
+	if err := r.dropped(ctx); err != nil {
+		return Users{}, err
+	}
+
+	return r.next.FindCredentials(ctx, userID)
+}
+
+func (r chaosRepository) Insert(ctx context.Context, user Users) (Users, error) {
+	if err := r.dropped(ctx); err != nil {
+		return Users{}, err
+	}
+
+	return r.next.Insert(ctx, user)
+}
+
+func (r chaosRepository) Upsert(ctx context.Context, user Users) (bool, bool, error) {
+	if err := r.dropped(ctx); err != nil {
+		return false, false, err
+	}
+
+	return r.next.Upsert(ctx, user)
+}
+
+func (r chaosRepository) Count(ctx context.Context, filter bson.M) (int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.Count(ctx, filter)
+}
+
+func (r chaosRepository) UpdateMany(ctx context.Context, filter, update bson.M) (int64, int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return r.next.UpdateMany(ctx, filter, update)
+}
+
+func (r chaosRepository) Update(ctx context.Context, id primitive.ObjectID, update bson.M) (Users, error) {
+	if err := r.dropped(ctx); err != nil {
+		return Users{}, err
+	}
+
+	return r.next.Update(ctx, id, update)
+}
+
+func (r chaosRepository) DeleteMany(ctx context.Context, filter bson.M) (int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.DeleteMany(ctx, filter)
+}
+
+func (r chaosRepository) FindGroups(ctx context.Context, id primitive.ObjectID) ([]Group, error) {
+	if err := r.dropped(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.next.FindGroups(ctx, id)
+}
+
+func (r chaosRepository) AddGroup(ctx context.Context, id primitive.ObjectID, group Group) error {
+	if err := r.dropped(ctx); err != nil {
+		return err
+	}
+
+	return r.next.AddGroup(ctx, id, group)
+}
+
+func (r chaosRepository) Each(ctx context.Context, scan Scan, fn func(Users) error) (int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.Each(ctx, scan, fn)
+}
+
+func (r chaosRepository) Stats(ctx context.Context) (UserStats, error) {
+	if err := r.dropped(ctx); err != nil {
+		return UserStats{}, err
+	}
+
+	return r.next.Stats(ctx)
+}
+
+func (r chaosRepository) CollectionStats(ctx context.Context) (CollectionStats, error) {
+	if err := r.dropped(ctx); err != nil {
+		return CollectionStats{}, err
+	}
+
+	return r.next.CollectionStats(ctx)
+}
+
+func (r chaosRepository) Migrate(ctx context.Context) (int, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.Migrate(ctx)
+}
+
+func (r chaosRepository) PutAvatar(ctx context.Context, userID, contentType string, body io.Reader) (int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.PutAvatar(ctx, userID, contentType, body)
+}
+
+func (r chaosRepository) FindAvatar(ctx context.Context, userID string) (Avatar, error) {
+	if err := r.dropped(ctx); err != nil {
+		return Avatar{}, err
+	}
+
+	return r.next.FindAvatar(ctx, userID)
+}
+
+func (r chaosRepository) PurgeAvatars(ctx context.Context) (int64, error) {
+	if err := r.dropped(ctx); err != nil {
+		return 0, err
+	}
+
+	return r.next.PurgeAvatars(ctx)
+}
+
+func (r chaosRepository) FindPreferences(ctx context.Context, id primitive.ObjectID) (Preferences, error) {
+	if err := r.dropped(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.next.FindPreferences(ctx, id)
+}
+
+// Disconnect isn't a fault target, the service is stopping
+func (r chaosRepository) Disconnect(ctx context.Context) error {
+	return r.next.Disconnect(ctx)
+}
@@ -0,0 +1,214 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Avatars are stored following the GridFS layout, so the usual GridFS tools can
+// read them, but the chunks are written directly: the driver's upload stream
+// buffers up to 16MB before writing, which would hide the individual writes.
+const (
+	avatarBucket    = "avatars"
+	avatarChunkSize = 255 * 1024
+)
+
+// PutAvatar streams body into GridFS as the avatar of userID, replacing any
+// previous one, and returns the number of bytes stored. Each chunk insert gets
+// its own CLIENT span so slow uploads show where the time goes.
+func (r MongoRepository) PutAvatar(ctx context.Context, userID, contentType string, body io.Reader) (int64, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	db := client.Database(mongoDB)
+	files := db.Collection(avatarBucket + ".files")
+	chunks := db.Collection(avatarBucket + ".chunks")
+
+	fileID := primitive.NewObjectID()
+	buf := make([]byte, avatarChunkSize)
+
+	var size int64
+	for n := 0; ; n++ {
+		read, readErr := io.ReadFull(body, buf)
+		if read > 0 {
+			if err := insertAvatarChunk(ctx, chunks, fileID, n, buf[:read]); err != nil {
+				chunks.DeleteMany(context.WithoutCancel(ctx), bson.M{"files_id": fileID})
+				return size, err
+			}
+			size += int64(read)
+		}
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			chunks.DeleteMany(context.WithoutCancel(ctx), bson.M{"files_id": fileID})
+			return size, readErr
+		}
+	}
+
+	_, err = files.InsertOne(ctx, bson.M{
+		"_id":        fileID,
+		"length":     size,
+		"chunkSize":  avatarChunkSize,
+		"uploadDate": time.Now(),
+		"filename":   userID,
+		"metadata":   bson.M{"contentType": contentType},
+	})
+	if err != nil {
+		chunks.DeleteMany(context.WithoutCancel(ctx), bson.M{"files_id": fileID})
+		return size, err
+	}
+
+	// Remove the avatars this one replaces
+	cur, err := files.Find(ctx, bson.M{"filename": userID, "_id": bson.M{"$ne": fileID}})
+	if err != nil {
+		return size, nil
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var old struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if cur.Decode(&old) == nil {
+			chunks.DeleteMany(ctx, bson.M{"files_id": old.ID})
+			files.DeleteOne(ctx, bson.M{"_id": old.ID})
+		}
+	}
+
+	return size, nil
+}
+
+func insertAvatarChunk(ctx context.Context, chunks *mongo.Collection, fileID primitive.ObjectID, n int, data []byte) error {
+	ctx, span := tel.RepositoryScope.StartClientSpan(ctx, "insert "+chunks.Name(), trace.WithAttributes(
+		attribute.String("db.system", mongoSystem),
+		attribute.String("db.namespace", mongoDB),
+		attribute.String("db.collection.name", chunks.Name()),
+		attribute.String("db.operation.name", "insert"),
+		attribute.Int("db.mongodb.gridfs.chunk.index", n),
+		attribute.Int("db.mongodb.gridfs.chunk.size", len(data)),
+	))
+	defer span.End()
+
+	_, err := chunks.InsertOne(ctx, bson.M{
+		"files_id": fileID,
+		"n":        n,
+		"data":     primitive.Binary{Data: data},
+	})
+	if err != nil {
+		recordDBError(span, err)
+		return fmt.Errorf("writing chunk %d: %w", n, err)
+	}
+
+	return nil
+}
+
+// FindAvatar reads the GridFS file entry of the avatar of userID, the chunks
+// aren't loaded
+func (r MongoRepository) FindAvatar(ctx context.Context, userID string) (Avatar, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return Avatar{}, err
+	}
+
+	findOpts := options.FindOne().SetSort(bson.M{"uploadDate": -1})
+	if comment := traceComment(ctx); comment != "" {
+		findOpts.SetComment(comment)
+	}
+
+	var file struct {
+		Length     int64     `bson:"length"`
+		UploadDate time.Time `bson:"uploadDate"`
+		Metadata   struct {
+			ContentType string `bson:"contentType"`
+		} `bson:"metadata"`
+	}
+	files := client.Database(mongoDB).Collection(avatarBucket+".files", options.Collection().SetReadPreference(readPreference(readFind)))
+	err = files.FindOne(ctx, bson.M{"filename": userID}, findOpts).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Avatar{}, ErrAvatarNotFound
+	}
+	if err != nil {
+		return Avatar{}, err
+	}
+
+	return Avatar{
+		ContentType: file.Metadata.ContentType,
+		Size:        file.Length,
+		UploadedAt:  file.UploadDate,
+	}, nil
+}
+
+// orphanAvatarsPipeline finds the avatar files whose user is gone, deleting a
+// user leaves its avatar behind
+func orphanAvatarsPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: UsersCol},
+			{Key: "let", Value: bson.M{"uid": bson.M{"$convert": bson.M{"input": "$filename", "to": "objectId", "onError": nil, "onNull": nil}}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$uid"}}}},
+				bson.M{"$project": bson.M{"_id": 1}},
+			}},
+			{Key: "as", Value: "user"},
+		}}},
+		{{Key: "$match", Value: bson.M{"user": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+}
+
+// PurgeAvatars removes the avatars of deleted users, files and chunks, and
+// returns how many files went
+func (r MongoRepository) PurgeAvatars(ctx context.Context) (int64, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	db := client.Database(mongoDB)
+	files := db.Collection(avatarBucket + ".files")
+	chunks := db.Collection(avatarBucket + ".chunks")
+
+	cur, err := files.Aggregate(ctx, orphanAvatarsPipeline())
+	if err != nil {
+		return 0, err
+	}
+	var orphans []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &orphans); err != nil {
+		return 0, err
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, 0, len(orphans))
+	for _, o := range orphans {
+		ids = append(ids, o.ID)
+	}
+	// chunks first, a file entry without chunks would still be found
+	if _, err := chunks.DeleteMany(ctx, bson.M{"files_id": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+	res, err := files.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
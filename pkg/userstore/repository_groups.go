@@ -0,0 +1,99 @@
+package userstore
+
+import (
+	"context"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupsCol holds one document per membership: {user_id, group, role}, where
+// user_id is the id field of the user
+var GroupsCol = "user_groups"
+
+// groupsPipeline joins a user with its memberships
+func groupsPipeline(id primitive.ObjectID) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id": id}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: GroupsCol},
+			{Key: "localField", Value: "id"},
+			{Key: "foreignField", Value: "user_id"},
+			{Key: "as", Value: "groups"},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "groups.group", Value: 1},
+			{Key: "groups.role", Value: 1},
+		}}},
+	}
+}
+
+func (r MongoRepository) FindGroups(ctx context.Context, id primitive.ObjectID) ([]Group, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error connecting to MongoDB", "error", err)
+		return nil, err
+	}
+
+	aggregateOpts := options.Aggregate()
+	if comment := traceComment(ctx); comment != "" {
+		aggregateOpts.SetComment(comment)
+	}
+
+	coll := client.Database(mongoDB).Collection(UsersCol, options.Collection().SetReadPreference(readPreference(readFind)))
+	cur, err := coll.Aggregate(ctx, groupsPipeline(id), aggregateOpts)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error aggregating in MongoDB", "error", err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var results []struct {
+		Groups []Group `bson:"groups"`
+	}
+	if err := cur.All(ctx, &results); err != nil {
+		logging.FromContext(ctx).Error("Error getting user groups", "error", err)
+		return nil, err
+	}
+
+	// The $match stage found no user
+	if len(results) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	return results[0].Groups, nil
+}
+
+func (r MongoRepository) AddGroup(ctx context.Context, id primitive.ObjectID, group Group) error {
+	user, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	client, err := r.connect(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error connecting to MongoDB", "error", err)
+		return err
+	}
+
+	updateOpts := options.Update().SetUpsert(true)
+	if comment := traceComment(ctx); comment != "" {
+		updateOpts.SetComment(comment)
+	}
+
+	// One membership per group, adding it again updates the role
+	_, err = client.Database(mongoDB).Collection(GroupsCol).UpdateOne(ctx,
+		bson.M{"user_id": user.ID, "group": group.Name},
+		bson.M{"$set": bson.M{"role": group.Role}},
+		updateOpts,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error inserting in MongoDB", "error", err)
+	}
+
+	return err
+}
@@ -0,0 +1,530 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/conventions"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedRepository wraps a UserRepository with a CLIENT span and a
+// db.client.operation.duration measurement per operation.
+type instrumentedRepository struct {
+	next           UserRepository
+	duration       metric.Float64Histogram
+	slowOperations metric.Int64Counter
+
+	// explainer explains slow queries, when next can
+	explainer explainer
+
+	// serverAddress and serverPort identify the database for the peer attributes
+	serverAddress string
+	serverPort    string
+}
+
+// NewInstrumentedRepository decorates next with spans and metrics
+func NewInstrumentedRepository(next UserRepository) UserRepository {
+	duration, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Float64Histogram(
+		"db.client.operation.duration",
+		metric.WithDescription("Duration of database client operations"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10),
+	)
+
+	slowOperations, _ := otel.Meter("github.com/neha-gupta1/otel-semantics/pkg/userstore").Int64Counter(
+		"db.client.slow_operations",
+		metric.WithDescription("Database client operations that ran longer than their slow query threshold"),
+		metric.WithUnit("{operation}"),
+	)
+
+	r := &instrumentedRepository{
+		next:           next,
+		duration:       duration,
+		slowOperations: slowOperations,
+	}
+	r.explainer, _ = next.(explainer)
+
+	if s, ok := next.(interface{ Server() (string, string) }); ok {
+		r.serverAddress, r.serverPort = s.Server()
+	}
+
+	return r
+}
+
+// retryAttempts is the number of attempts of a read, from MONGO_RETRY_ATTEMPTS
+// (default 3), each one waiting retryBackoff longer than the last
+var retryAttempts = intFromEnv("MONGO_RETRY_ATTEMPTS", 3)
+
+const retryBackoff = 100 * time.Millisecond
+
+func intFromEnv(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 1 {
+		return fallback
+	}
+
+	return v
+}
+
+// dbOperation is a single instrumented call to the database
+type dbOperation struct {
+	span       trace.Span
+	name       string
+	collection string
+	start      time.Time
+
+	// explain is the command explaining the operation if it's slow, nil for
+	// operations that can't be explained
+	explain bson.D
+}
+
+// dbAttributeLevels are the optional attributes of the database spans, the
+// query text being recommended since it's sanitized
+var dbAttributeLevels = map[attribute.Key]conventions.Requirement{
+	"db.query.text":              conventions.Recommended,
+	"db.query.summary":           conventions.Recommended,
+	"db.mongodb.read_preference": conventions.Recommended,
+}
+
+// startOperation starts the client span for operation on collection
+func (r *instrumentedRepository) startOperation(ctx context.Context, operation, collection string, attrs ...attribute.KeyValue) (context.Context, *dbOperation) {
+	name := operation
+	if collection != "" {
+		name += " " + collection
+		attrs = append(attrs, attribute.String("db.collection.name", collection))
+	}
+
+	attrs = append(attrs,
+		attribute.String("db.system", mongoSystem),
+		attribute.String("db.namespace", mongoDB),
+		attribute.String("db.operation.name", operation),
+	)
+	if !hasAttribute(attrs, "db.query.summary") {
+		attrs = append(attrs, attribute.String("db.query.summary", querySummary(operation, collection)))
+	}
+	attrs = conventions.Filter(attrs, dbAttributeLevels)
+	attrs = append(attrs, tel.PeerAttributes(r.serverAddress, r.serverPort)...)
+	// the time left before the request deadline, set by the route or the client
+	if deadline, ok := ctx.Deadline(); ok {
+		attrs = conventions.Add(attrs, conventions.Recommended, attribute.Float64("db.operation.time_remaining", time.Until(deadline).Seconds()))
+	}
+
+	ctx, span := tel.RepositoryScope.StartClientSpan(ctx, name, trace.WithAttributes(attrs...))
+
+	return ctx, &dbOperation{
+		span:       span,
+		name:       operation,
+		collection: collection,
+		start:      time.Now(),
+	}
+}
+
+// setLazy sets attrs on the span of the operation, computing them only if the
+// span is recording and the profile records them
+func (op *dbOperation) setLazy(attrs ...tel.LazyAttribute) {
+	kept := attrs[:0:0]
+	for _, a := range attrs {
+		if level, ok := dbAttributeLevels[a.Key]; ok && !conventions.Records(level) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+
+	tel.SetLazyAttributes(op.span, kept...)
+}
+
+// queryTextAttribute is db.query.text, rendered by text only for recorded spans
+func queryTextAttribute(text func() string) tel.LazyAttribute {
+	return tel.LazyString("db.query.text", text)
+}
+
+func hasAttribute(attrs []attribute.KeyValue, key attribute.Key) bool {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// end records the outcome of the operation on its span and in the duration histogram
+func (r *instrumentedRepository) end(ctx context.Context, op *dbOperation, err error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", mongoSystem),
+		attribute.String("db.operation.name", op.name),
+	}
+	if op.collection != "" {
+		attrs = append(attrs, attribute.String("db.collection.name", op.collection))
+	}
+
+	// A missing document is a valid answer from the database, not a failure
+	if err != nil && !errors.Is(err, ErrUserNotFound) && !errors.Is(err, ErrAvatarNotFound) {
+		recordDBError(op.span, err)
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+	}
+
+	elapsed := time.Since(op.start)
+	r.flagSlow(ctx, op, elapsed, attrs)
+	r.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attrs...))
+	op.span.End()
+}
+
+// withRetry runs a read operation, retrying it up to retryAttempts times when
+// it fails with a transient error. Each attempt gets its own span, linked to
+// the span of the attempt that failed before it, so the whole chain can be
+// followed from the last attempt.
+func (r *instrumentedRepository) withRetry(ctx context.Context, operation, collection string, fn func(ctx context.Context, op *dbOperation) error, attrs ...attribute.KeyValue) error {
+	var previous trace.SpanContext
+
+	for attempt := 1; ; attempt++ {
+		opAttrs := append([]attribute.KeyValue{attribute.Int("db.operation.attempt", attempt)}, attrs...)
+		opCtx, op := r.startOperation(ctx, operation, collection, opAttrs...)
+		if previous.IsValid() {
+			op.span.AddLink(trace.Link{
+				SpanContext: previous,
+				Attributes:  []attribute.KeyValue{attribute.String("link.type", "retry_of")},
+			})
+		}
+
+		err := fn(opCtx, op)
+		r.end(opCtx, op, err)
+
+		if err == nil || attempt >= retryAttempts || !isTransient(err) {
+			return err
+		}
+		previous = op.span.SpanContext()
+
+		select {
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// isTransient reports whether a failed read is worth retrying
+func isTransient(err error) bool {
+	if isDeadlineExceeded(err) {
+		return false
+	}
+
+	return mongo.IsNetworkError(err) || errors.Is(err, errConnectionDropped)
+}
+
+// recordDBError marks the database client span as failed
+func recordDBError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// errorType returns a low cardinality description of err for the error.type attribute
+func errorType(err error) string {
+	switch {
+	case isDeadlineExceeded(err):
+		return "deadline_exceeded"
+	case errors.Is(err, errConnectionDropped):
+		return "connection_dropped"
+	default:
+		return "_OTHER"
+	}
+}
+
+func (r *instrumentedRepository) Ping(ctx context.Context) (err error) {
+	ctx, op := r.startOperation(ctx, "ping", "")
+	defer func() { r.end(ctx, op, err) }()
+
+	return r.next.Ping(ctx)
+}
+
+func (r *instrumentedRepository) EnsureIndexes(ctx context.Context) (err error) {
+	ctx, op := r.startOperation(ctx, "createIndexes", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+
+	return r.next.EnsureIndexes(ctx)
+}
+
+func (r *instrumentedRepository) FindAll(ctx context.Context, fields []string) (users []Users, err error) {
+	err = r.withRetry(ctx, "findAll", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return findQueryText(fields) }))
+		op.explain = bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.M{}}}
+		users, err = r.next.FindAll(ctx, fields)
+		return err
+	},
+		readPreferenceAttribute(readFind),
+	)
+
+	return users, err
+}
+
+func (r *instrumentedRepository) FindByID(ctx context.Context, id primitive.ObjectID) (user Users, err error) {
+	err = r.withRetry(ctx, "findOne", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return queryText(bson.M{"_id": id}) }))
+		op.explain = bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.M{"_id": id}}}
+		user, err = r.next.FindByID(ctx, id)
+		if errors.Is(err, ErrUserNotFound) {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 0))
+		} else if err == nil {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 1))
+		}
+		return err
+	},
+		readPreferenceAttribute(readFind),
+	)
+
+	return user, err
+}
+
+func (r *instrumentedRepository) FindCredentials(ctx context.Context, userID string) (user Users, err error) {
+	err = r.withRetry(ctx, "findOne", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return queryText(bson.M{"id": userID}) }))
+		op.explain = bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.M{"id": userID}}, {Key: "projection", Value: bson.M{"id": 1, "password_hash": 1}}}
+		user, err = r.next.FindCredentials(ctx, userID)
+		if errors.Is(err, ErrUserNotFound) {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 0))
+		} else if err == nil {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 1))
+		}
+		return err
+	},
+		readPreferenceAttribute(readFind),
+	)
+
+	return user, err
+}
+
+// Each isn't retried: fn may already have handled part of the users
+func (r *instrumentedRepository) Each(ctx context.Context, scan Scan, fn func(Users) error) (rows int64, err error) {
+	ctx, op := r.startOperation(ctx, "find", UsersCol,
+		attribute.Int("db.mongodb.cursor.batch_size", int(scan.BatchSize)),
+		readPreferenceAttribute(readFind),
+	)
+	defer func() { r.end(ctx, op, err) }()
+	op.setLazy(queryTextAttribute(func() string { return findQueryText(scan.Fields) }))
+	op.explain = bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.M{}}}
+
+	rows, err = r.next.Each(ctx, scan, fn)
+	op.span.SetAttributes(attribute.Int64("db.response.returned_rows", rows))
+
+	return rows, err
+}
+
+func (r *instrumentedRepository) Insert(ctx context.Context, user Users) (_ Users, err error) {
+	ctx, op := r.startOperation(ctx, "InsertOne", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+
+	return r.next.Insert(ctx, user)
+}
+
+func (r *instrumentedRepository) Upsert(ctx context.Context, user Users) (inserted, modified bool, err error) {
+	ctx, op := r.startOperation(ctx, "update", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+
+	inserted, modified, err = r.next.Upsert(ctx, user)
+	if err == nil {
+		affected := int64(0)
+		if inserted || modified {
+			affected = 1
+		}
+		op.span.SetAttributes(attribute.Int64("db.operation.affected_count", affected))
+	}
+
+	return inserted, modified, err
+}
+
+func (r *instrumentedRepository) Count(ctx context.Context, filter bson.M) (count int64, err error) {
+	err = r.withRetry(ctx, "countDocuments", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return queryText(filter) }))
+		op.explain = bson.D{{Key: "count", Value: UsersCol}, {Key: "query", Value: filter}}
+		count, err = r.next.Count(ctx, filter)
+		return err
+	},
+		readPreferenceAttribute(readCount),
+	)
+
+	return count, err
+}
+
+func (r *instrumentedRepository) UpdateMany(ctx context.Context, filter, update bson.M) (matched, modified int64, err error) {
+	ctx, op := r.startOperation(ctx, "updateMany", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+	// the repository applies the fields with $set, render the update it sends
+	set := bson.M{"$set": update}
+	op.setLazy(queryTextAttribute(func() string { return updateManyQueryText(UsersCol, filter, set) }))
+	op.explain = bson.D{{Key: "update", Value: UsersCol}, {Key: "updates", Value: bson.A{bson.M{"q": filter, "u": set, "multi": true}}}}
+
+	matched, modified, err = r.next.UpdateMany(ctx, filter, update)
+	if err == nil {
+		op.span.SetAttributes(
+			attribute.Int64("db.operation.batch.size", matched),
+			attribute.Int64("db.operation.affected_count", modified),
+		)
+	}
+
+	return matched, modified, err
+}
+
+// Update isn't retried, like the other writes
+func (r *instrumentedRepository) Update(ctx context.Context, id primitive.ObjectID, update bson.M) (user Users, err error) {
+	filter := bson.M{"_id": id}
+	ctx, op := r.startOperation(ctx, "findAndModify", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+	op.setLazy(queryTextAttribute(func() string { return updateQueryText(UsersCol, filter, update) }))
+	op.explain = bson.D{{Key: "findAndModify", Value: UsersCol}, {Key: "query", Value: filter}, {Key: "update", Value: update}}
+
+	user, err = r.next.Update(ctx, id, update)
+	if errors.Is(err, ErrUserNotFound) {
+		op.span.SetAttributes(attribute.Int64("db.operation.affected_count", 0))
+	} else if err == nil {
+		op.span.SetAttributes(attribute.Int64("db.operation.affected_count", 1))
+	}
+
+	return user, err
+}
+
+func (r *instrumentedRepository) DeleteMany(ctx context.Context, filter bson.M) (deleted int64, err error) {
+	ctx, op := r.startOperation(ctx, "deleteMany", UsersCol)
+	defer func() { r.end(ctx, op, err) }()
+	op.setLazy(queryTextAttribute(func() string { return queryText(filter) }))
+	op.explain = bson.D{{Key: "delete", Value: UsersCol}, {Key: "deletes", Value: bson.A{bson.M{"q": filter, "limit": 0}}}}
+
+	deleted, err = r.next.DeleteMany(ctx, filter)
+	if err == nil {
+		op.span.SetAttributes(
+			attribute.Int64("db.operation.batch.size", deleted),
+			attribute.Int64("db.operation.affected_count", deleted),
+		)
+	}
+
+	return deleted, err
+}
+
+func (r *instrumentedRepository) FindGroups(ctx context.Context, id primitive.ObjectID) (groups []Group, err error) {
+	pipeline := groupsPipeline(id)
+	err = r.withRetry(ctx, "aggregate", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return pipelineText(UsersCol, pipeline) }))
+		op.explain = bson.D{{Key: "aggregate", Value: UsersCol}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.M{}}}
+		groups, err = r.next.FindGroups(ctx, id)
+		if err == nil {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", len(groups)))
+		}
+		return err
+	},
+		attribute.String("db.query.summary", pipelineSummary(UsersCol, pipeline)),
+		readPreferenceAttribute(readFind),
+	)
+
+	return groups, err
+}
+
+func (r *instrumentedRepository) AddGroup(ctx context.Context, id primitive.ObjectID, group Group) (err error) {
+	ctx, op := r.startOperation(ctx, "addGroup", GroupsCol)
+	defer func() { r.end(ctx, op, err) }()
+
+	return r.next.AddGroup(ctx, id, group)
+}
+
+func (r *instrumentedRepository) Stats(ctx context.Context) (stats UserStats, err error) {
+	pipeline := statsPipeline()
+	err = r.withRetry(ctx, "aggregate", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return pipelineText(UsersCol, pipeline) }))
+		op.explain = bson.D{{Key: "aggregate", Value: UsersCol}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.M{}}}
+		stats, err = r.next.Stats(ctx)
+		return err
+	},
+		attribute.String("db.query.summary", pipelineSummary(UsersCol, pipeline)),
+		readPreferenceAttribute(readCount),
+	)
+
+	return stats, err
+}
+
+func (r *instrumentedRepository) CollectionStats(ctx context.Context) (stats CollectionStats, err error) {
+	err = r.withRetry(ctx, "collStats", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		stats, err = r.next.CollectionStats(ctx)
+		return err
+	})
+
+	return stats, err
+}
+
+// Migrate isn't wrapped in a database span, pkg/migrate traces every migration
+func (r *instrumentedRepository) Migrate(ctx context.Context) (int, error) {
+	return r.next.Migrate(ctx)
+}
+
+func (r *instrumentedRepository) PutAvatar(ctx context.Context, userID, contentType string, body io.Reader) (size int64, err error) {
+	ctx, op := r.startOperation(ctx, "upload", avatarBucket)
+	defer func() { r.end(ctx, op, err) }()
+
+	size, err = r.next.PutAvatar(ctx, userID, contentType, body)
+	op.span.SetAttributes(attribute.Int64("db.mongodb.gridfs.file.size", size))
+
+	return size, err
+}
+
+func (r *instrumentedRepository) FindAvatar(ctx context.Context, userID string) (avatar Avatar, err error) {
+	err = r.withRetry(ctx, "findOne", avatarBucket+".files", func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return queryText(bson.M{"filename": userID}) }))
+		op.explain = bson.D{{Key: "find", Value: avatarBucket + ".files"}, {Key: "filter", Value: bson.M{"filename": userID}}}
+		avatar, err = r.next.FindAvatar(ctx, userID)
+		if errors.Is(err, ErrAvatarNotFound) {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 0))
+		} else if err == nil {
+			op.span.SetAttributes(attribute.Int("db.response.returned_rows", 1))
+		}
+		return err
+	},
+		readPreferenceAttribute(readFind),
+	)
+
+	return avatar, err
+}
+
+func (r *instrumentedRepository) PurgeAvatars(ctx context.Context) (purged int64, err error) {
+	pipeline := orphanAvatarsPipeline()
+	ctx, op := r.startOperation(ctx, "aggregate", avatarBucket+".files",
+		attribute.String("db.query.summary", pipelineSummary(avatarBucket+".files", pipeline)),
+	)
+	defer func() { r.end(ctx, op, err) }()
+	op.setLazy(queryTextAttribute(func() string { return pipelineText(avatarBucket+".files", pipeline) }))
+	op.explain = bson.D{{Key: "aggregate", Value: avatarBucket + ".files"}, {Key: "pipeline", Value: pipeline}, {Key: "cursor", Value: bson.M{}}}
+
+	purged, err = r.next.PurgeAvatars(ctx)
+	if err == nil {
+		op.span.SetAttributes(attribute.Int64("db.operation.affected_count", purged))
+	}
+
+	return purged, err
+}
+
+func (r *instrumentedRepository) FindPreferences(ctx context.Context, id primitive.ObjectID) (prefs Preferences, err error) {
+	err = r.withRetry(ctx, "findOne", UsersCol, func(ctx context.Context, op *dbOperation) (err error) {
+		op.setLazy(queryTextAttribute(func() string { return queryText(bson.M{"_id": id}) }))
+		op.explain = bson.D{{Key: "find", Value: UsersCol}, {Key: "filter", Value: bson.M{"_id": id}}, {Key: "projection", Value: bson.M{"preferences": 1}}}
+		prefs, err = r.next.FindPreferences(ctx, id)
+		return err
+	},
+		readPreferenceAttribute(readFind),
+	)
+
+	return prefs, err
+}
+
+// Disconnect isn't traced, it's not a database operation
+func (r *instrumentedRepository) Disconnect(ctx context.Context) error {
+	return r.next.Disconnect(ctx)
+}
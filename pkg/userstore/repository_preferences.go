@@ -0,0 +1,43 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindPreferences only reads the preferences subdocument of the user
+func (r MongoRepository) FindPreferences(ctx context.Context, id primitive.ObjectID) (Preferences, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error connecting to MongoDB", "error", err)
+		return nil, err
+	}
+
+	findOpts := options.FindOne().SetProjection(bson.M{"preferences": 1})
+	if comment := traceComment(ctx); comment != "" {
+		findOpts.SetComment(comment)
+	}
+
+	var user struct {
+		Preferences Preferences `bson:"preferences"`
+	}
+	coll := client.Database(mongoDB).Collection(UsersCol, options.Collection().SetReadPreference(readPreference(readFind)))
+	err = coll.FindOne(ctx, bson.M{"_id": id}, findOpts).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		logging.FromContext(ctx).Error("Error getting user preferences", "error", err)
+		return nil, err
+	}
+
+	// Users start without any preferences
+	if user.Preferences == nil {
+		return Preferences{}, nil
+	}
+
+	return user.Preferences, nil
+}
@@ -0,0 +1,103 @@
+package userstore
+
+import (
+	"context"
+
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserStats summarizes the stored users
+type UserStats struct {
+	Total int64 `json:"total"`
+	// ByMonth counts the users by signup month ("2024-07"), oldest first
+	ByMonth []MonthCount `json:"by_month"`
+}
+
+// MonthCount is the number of users who signed up in a month
+type MonthCount struct {
+	Month string `json:"month" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// statsPipeline groups the users by signup month. Users have no signup date,
+// the creation time of their ObjectID stands in for it. They have no email
+// either, so there is no breakdown by domain; one would be a second $facet
+// next to the months.
+func statsPipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": bson.M{"$toDate": "$_id"}}}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+}
+
+func (r MongoRepository) Stats(ctx context.Context) (UserStats, error) {
+	stats := UserStats{ByMonth: []MonthCount{}}
+
+	client, err := r.connect(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error connecting to MongoDB", "error", err)
+		return stats, err
+	}
+
+	aggregateOpts := options.Aggregate()
+	if comment := traceComment(ctx); comment != "" {
+		aggregateOpts.SetComment(comment)
+	}
+
+	coll := client.Database(mongoDB).Collection(UsersCol, options.Collection().SetReadPreference(readPreference(readCount)))
+	cur, err := coll.Aggregate(ctx, statsPipeline(), aggregateOpts)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error aggregating in MongoDB", "error", err)
+		return stats, err
+	}
+	defer cur.Close(ctx)
+
+	if err := cur.All(ctx, &stats.ByMonth); err != nil {
+		logging.FromContext(ctx).Error("Error getting user stats", "error", err)
+		return stats, err
+	}
+
+	for _, month := range stats.ByMonth {
+		stats.Total += month.Count
+	}
+
+	return stats, nil
+}
+
+// CollectionStats is the size of the users collection, as reported by collStats
+type CollectionStats struct {
+	Count int64 `bson:"count"`
+	// Size is the uncompressed size of the documents, StorageSize what they
+	// take on disk and TotalIndexSize the size of the indexes
+	Size           int64 `bson:"size"`
+	StorageSize    int64 `bson:"storageSize"`
+	TotalIndexSize int64 `bson:"totalIndexSize"`
+}
+
+func (r MongoRepository) CollectionStats(ctx context.Context) (CollectionStats, error) {
+	var stats CollectionStats
+
+	client, err := r.connect(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error connecting to MongoDB", "error", err)
+		return stats, err
+	}
+
+	cmd := bson.D{{Key: "collStats", Value: UsersCol}}
+	if comment := traceComment(ctx); comment != "" {
+		cmd = append(cmd, bson.E{Key: "comment", Value: comment})
+	}
+
+	if err := client.Database(mongoDB).RunCommand(ctx, cmd).Decode(&stats); err != nil {
+		logging.FromContext(ctx).Error("Error getting the users collection stats", "error", err)
+		return stats, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,248 @@
+package userstore
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/middleware"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Route is an entry of the route table. Its metadata picks the middleware in
+// front of the handlers and is recorded on the server span.
+type Route struct {
+	Method string
+	// Path is relative to the prefix of the table
+	Path string
+	// Handlers run in order after the route middleware, the last one answers
+	Handlers []gin.HandlerFunc
+	// Auth rejects the requests without a token, on top of the group's Auth
+	Auth bool
+	// Timeout cancels the request context once it has elapsed, 0 for none
+	Timeout time.Duration
+	// RateLimit caps the requests of this route, on top of the group's limit
+	RateLimit middleware.RateLimitConfig
+	// Sampling decides for the server spans of the route, nil leaves them to
+	// the configured sampler
+	Sampling sdktrace.Sampler
+}
+
+// routeTable is a list of routes under a common prefix
+type routeTable struct {
+	Prefix string
+	// Group is the middleware stack of the table, nil for none
+	Group  *RouteGroup
+	Routes []Route
+}
+
+// probesSampled keeps the traces of /healthz and /readyz, off by default so
+// the probes don't drown the traffic, from ROUTES_PROBES_SAMPLED
+var probesSampled = boolFromEnv("ROUTES_PROBES_SAMPLED", false)
+
+// loginRateLimit slows down password guessing on /auth/login, from
+// ROUTES_LOGIN_RATE_LIMIT and ROUTES_LOGIN_RATE_BURST
+var loginRateLimit = middleware.RateLimitConfigFromEnv("ROUTES_LOGIN", middleware.RateLimitConfig{Rate: 5, Burst: 10})
+
+// routeTables lists every route of the userstore
+func routeTables() []routeTable {
+	var probeSampling sdktrace.Sampler
+	if !probesSampled {
+		probeSampling = sdktrace.NeverSample()
+	}
+
+	return []routeTable{
+		{
+			Routes: []Route{
+				{Method: http.MethodGet, Path: "/healthz", Handlers: []gin.HandlerFunc{Healthz}, Sampling: probeSampling},
+				{Method: http.MethodGet, Path: "/readyz", Handlers: []gin.HandlerFunc{Readyz}, Sampling: probeSampling},
+				{Method: http.MethodGet, Path: "/ui/users", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{GetUsersPage}},
+			},
+		},
+		{
+			Prefix: "/api/v1",
+			Group:  &apiGroup,
+			Routes: []Route{
+				{Method: http.MethodGet, Path: "/user", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, userCache.middleware, GetUser}},
+				{Method: http.MethodGet, Path: "/user/:id", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, GetUserByID}},
+				{Method: http.MethodGet, Path: "/user/:id/groups", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{GetUserGroups}},
+				{Method: http.MethodPost, Path: "/user/:id/groups", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{validateBody("group.json"), PostUserGroup}},
+				{Method: http.MethodPost, Path: "/user", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, validateBody("user.json"), PostUser}},
+				{Method: http.MethodPatch, Path: "/user/:id", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, validateBody("user_patch.json"), PatchUser}},
+				{Method: http.MethodDelete, Path: "/user/:id", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{DeleteUser}},
+				{Method: http.MethodPut, Path: "/user/:id/avatar", Timeout: uploadRequestTimeout, Handlers: []gin.HandlerFunc{PutAvatar}},
+				{Method: http.MethodGet, Path: "/users/export", Timeout: exportRequestTimeout, Handlers: []gin.HandlerFunc{ExportUsers}},
+				{Method: http.MethodGet, Path: "/stats/users", Timeout: adminRequestTimeout, Handlers: []gin.HandlerFunc{GetUserStats}},
+			},
+		},
+		{
+			Prefix: "/api/v2",
+			Group:  &apiV2Group,
+			Routes: []Route{
+				{Method: http.MethodGet, Path: "/user", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, userCache.middleware, GetUsersV2}},
+				{Method: http.MethodGet, Path: "/user/:id", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, GetUserByIDV2}},
+				{Method: http.MethodPost, Path: "/user", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{negotiate, validateBody("user_v2.json"), PostUserV2}},
+				{Method: http.MethodGet, Path: "/user/:id/groups", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{GetUserGroups}},
+				{Method: http.MethodPost, Path: "/user/:id/groups", Timeout: defaultRequestTimeout, Handlers: []gin.HandlerFunc{validateBody("group.json"), PostUserGroup}},
+				{Method: http.MethodGet, Path: "/stats/users", Timeout: adminRequestTimeout, Handlers: []gin.HandlerFunc{GetUserStats}},
+			},
+		},
+		{
+			Prefix: "/auth",
+			Routes: []Route{
+				{Method: http.MethodPost, Path: "/login", Timeout: defaultRequestTimeout, RateLimit: loginRateLimit, Handlers: []gin.HandlerFunc{PostLogin}},
+			},
+		},
+		{
+			Prefix: "/admin",
+			Group:  &adminGroup,
+			Routes: []Route{
+				{Method: http.MethodPost, Path: "/users/update-many", Timeout: adminRequestTimeout, Handlers: []gin.HandlerFunc{validateBody("bulk.json"), AdminUpdateUsers}},
+				{Method: http.MethodPost, Path: "/users/delete-many", Timeout: adminRequestTimeout, Handlers: []gin.HandlerFunc{validateBody("bulk.json"), AdminDeleteUsers}},
+			},
+		},
+	}
+}
+
+// install registers the routes of tables on router, and their sampling with tel
+func install(router *gin.Engine, tables []routeTable) {
+	for _, table := range tables {
+		var groupHandlers []gin.HandlerFunc
+		groupAuth := false
+		if table.Group != nil {
+			groupHandlers = table.Group.handlers()
+			groupAuth = table.Group.Auth
+		}
+		group := router.Group(table.Prefix, groupHandlers...)
+
+		for _, route := range table.Routes {
+			group.Handle(route.Method, route.Path, route.handlers(groupAuth)...)
+			if route.Sampling != nil {
+				tel.SampleRoute(route.Method, strings.TrimSuffix(group.BasePath(), "/")+route.Path, route.Sampling)
+			}
+		}
+	}
+}
+
+// handlers returns the middleware the metadata of the route asks for,
+// followed by its handlers
+func (r Route) handlers(groupAuth bool) []gin.HandlerFunc {
+	attrs := []attribute.KeyValue{attribute.Bool("http.route.auth_required", groupAuth || r.Auth)}
+	if r.Timeout > 0 {
+		attrs = append(attrs, attribute.Float64("http.route.timeout", r.Timeout.Seconds()))
+	}
+	if r.RateLimit.Rate > 0 {
+		attrs = append(attrs, attribute.Float64("http.route.rate_limit", r.RateLimit.Rate))
+	}
+	if r.Sampling != nil {
+		attrs = append(attrs, attribute.String("http.route.sampling", r.Sampling.Description()))
+	}
+
+	handlers := []gin.HandlerFunc{func(c *gin.Context) {
+		trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attrs...)
+		c.Next()
+	}}
+	if r.Timeout > 0 {
+		handlers = append(handlers, requestTimeout(r.Timeout))
+	}
+	if r.RateLimit.Rate > 0 {
+		handlers = append(handlers, middleware.RateLimit(r.RateLimit))
+	}
+	if r.Auth {
+		handlers = append(handlers, requireAuth)
+	}
+
+	return append(handlers, r.Handlers...)
+}
+
+// RouteGroup is the middleware stack of a group of routes
+type RouteGroup struct {
+	// Name is recorded as http.route.group on the server span
+	Name string
+	// Auth rejects the requests without a token before they reach the handlers
+	Auth bool
+	// RateLimit caps the requests of the whole group
+	RateLimit middleware.RateLimitConfig
+	// Version tags the versioned API groups, and announces their deprecation
+	Version middleware.APIVersionConfig
+}
+
+// routeGroupFromEnv reads ROUTES_<prefix>_AUTH, _RATE_LIMIT, _RATE_BURST,
+// _DEPRECATION and _SUNSET on top of the group defaults
+func routeGroupFromEnv(prefix string, group RouteGroup) RouteGroup {
+	group.Auth = boolFromEnv("ROUTES_"+prefix+"_AUTH", group.Auth)
+	group.RateLimit = middleware.RateLimitConfigFromEnv("ROUTES_"+prefix, group.RateLimit)
+	if group.Version.Version != "" {
+		group.Version = middleware.APIVersionConfigFromEnv("ROUTES_"+prefix, group.Version)
+	}
+
+	return group
+}
+
+// Public API routes are rate limited, the handlers check the token themselves.
+// v1 is deprecated in favor of v2. Admin routes need a token but aren't limited.
+var (
+	apiGroup = routeGroupFromEnv("API", RouteGroup{
+		Name:      "api/v1",
+		RateLimit: middleware.RateLimitConfig{Rate: 50, Burst: 100},
+		Version: middleware.APIVersionConfig{
+			Version:     "v1",
+			Deprecation: time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:      time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC),
+			Successor:   "/api/v2",
+		},
+	})
+	apiV2Group = routeGroupFromEnv("API_V2", RouteGroup{
+		Name:      "api/v2",
+		RateLimit: middleware.RateLimitConfig{Rate: 50, Burst: 100},
+		Version:   middleware.APIVersionConfig{Version: "v2"},
+	})
+	adminGroup = routeGroupFromEnv("ADMIN", RouteGroup{
+		Name: "admin",
+		Auth: true,
+	})
+)
+
+// handlers returns the middleware stack of the group
+func (g RouteGroup) handlers() []gin.HandlerFunc {
+	name := g.Name
+	handlers := []gin.HandlerFunc{func(c *gin.Context) {
+		trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attribute.String("http.route.group", name))
+		c.Next()
+	}}
+
+	if g.Version.Version != "" {
+		handlers = append(handlers, middleware.APIVersion(g.Version))
+	}
+
+	if g.RateLimit.Rate > 0 {
+		handlers = append(handlers, middleware.RateLimit(g.RateLimit))
+	}
+
+	if g.Auth {
+		handlers = append(handlers, requireAuth)
+	}
+
+	return handlers
+}
+
+// requireAuth answers 401 to requests without a valid token
+func requireAuth(c *gin.Context) {
+	username, err := authenticate(c)
+	if err != nil {
+		trace.SpanFromContext(tel.Ctx(c)).AddEvent("Authentication failed", trace.WithAttributes(
+			attribute.String("event.category", "auth"),
+			attribute.String("event.type", "error"),
+			attribute.String("error.message", err.Error()),
+		))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set("username", username)
+	c.Next()
+}
@@ -0,0 +1,157 @@
+package userstore
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The JSON Schemas of the request bodies, one per endpoint
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// compiledSchemas caches the schemas by file name, they're compiled on first use
+var compiledSchemas sync.Map
+
+func compiledSchema(name string) (*jsonschema.Schema, error) {
+	if s, ok := compiledSchemas.Load(name); ok {
+		return s.(*jsonschema.Schema), nil
+	}
+
+	f, err := schemaFiles.Open("schemas/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(name, f); err != nil {
+		return nil, err
+	}
+	s, err := compiler.Compile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledSchemas.Store(name, s)
+	return s, nil
+}
+
+// SchemaViolation is one failed constraint, Pointer is the JSON Pointer of the
+// offending value in the body
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Detail  string `json:"detail"`
+}
+
+// validationProblem is the problem details of a body failing its schema
+type validationProblem struct {
+	Problem
+	Errors []SchemaViolation `json:"errors"`
+}
+
+// validateBody rejects the bodies not matching the schema with a 400 listing
+// every violation. The server span gets a validation event with the violated
+// paths, never the values. Requests that don't authenticate are left to the
+// handler, which answers 401 before looking at the body.
+func validateBody(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := authenticate(c); err != nil {
+			c.Next()
+			return
+		}
+
+		schema, err := compiledSchema(name)
+		if err != nil {
+			// a broken schema is a bug, the handler still checks the body
+			logging.FromContext(tel.Ctx(c)).Error("Error compiling schema", "schema", name, "error", err)
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithProblem(c, http.StatusBadRequest, "Invalid body", err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var violations []SchemaViolation
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			violations = []SchemaViolation{{Pointer: "", Detail: "invalid JSON: " + err.Error()}}
+		} else if err := schema.Validate(doc); err != nil {
+			var ve *jsonschema.ValidationError
+			if !errors.As(err, &ve) {
+				logging.FromContext(tel.Ctx(c)).Error("Error validating body", "schema", name, "error", err)
+				c.Next()
+				return
+			}
+			violations = schemaViolations(ve, nil)
+		}
+
+		if len(violations) == 0 {
+			c.Next()
+			return
+		}
+
+		paths := make([]string, 0, len(violations))
+		seen := map[string]bool{}
+		for _, v := range violations {
+			if !seen[v.Pointer] {
+				seen[v.Pointer] = true
+				paths = append(paths, v.Pointer)
+			}
+		}
+		sort.Strings(paths)
+
+		trace.SpanFromContext(tel.Ctx(c)).AddEvent("validation", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("validation.schema", name),
+			attribute.StringSlice("validation.paths", paths),
+			attribute.Int("validation.errors", len(violations)),
+			attribute.String("user.name", c.GetString("username")),
+		))
+
+		c.Header("Content-Type", "application/problem+json")
+		c.AbortWithStatusJSON(http.StatusBadRequest, validationProblem{
+			Problem: Problem{
+				Type:     "about:blank",
+				Title:    "Invalid body",
+				Status:   http.StatusBadRequest,
+				Detail:   "the body doesn't match the " + name + " schema",
+				Instance: c.Request.URL.Path,
+			},
+			Errors: violations,
+		})
+	}
+}
+
+// schemaViolations flattens the error tree into its leaves, the parents only
+// say that a subschema failed
+func schemaViolations(ve *jsonschema.ValidationError, out []SchemaViolation) []SchemaViolation {
+	if len(ve.Causes) == 0 {
+		return append(out, SchemaViolation{Pointer: ve.InstanceLocation, Detail: ve.Message})
+	}
+	for _, cause := range ve.Causes {
+		out = schemaViolations(cause, out)
+	}
+
+	return out
+}
@@ -0,0 +1,181 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// longQueryThreshold is the duration from MONGO_LONG_QUERY_THRESHOLD (default
+// 500ms) above which an operation is slow, unless
+// MONGO_SLOW_QUERY_THRESHOLD_<OPERATION> (e.g. _FINDONE=50ms) sets its own
+var longQueryThreshold = durationFromEnv("MONGO_LONG_QUERY_THRESHOLD", 500*time.Millisecond)
+
+// explainSlowQueries attaches the query plan of slow operations to their
+// span, from MONGO_SLOW_QUERY_EXPLAIN. It costs an explain command per slow
+// operation, run before the span ends.
+var explainSlowQueries = boolFromEnv("MONGO_SLOW_QUERY_EXPLAIN", false)
+
+const explainTimeout = time.Second
+
+// slowQueryThresholds caches the threshold of each operation name
+var slowQueryThresholds sync.Map
+
+func slowQueryThreshold(operation string) time.Duration {
+	if d, ok := slowQueryThresholds.Load(operation); ok {
+		return d.(time.Duration)
+	}
+
+	d := durationFromEnv("MONGO_SLOW_QUERY_THRESHOLD_"+strings.ToUpper(operation), longQueryThreshold)
+	slowQueryThresholds.Store(operation, d)
+
+	return d
+}
+
+// explainer runs the explain command, implemented by MongoRepository
+type explainer interface {
+	Explain(ctx context.Context, command bson.D) (bson.Raw, error)
+}
+
+func (r MongoRepository) Explain(ctx context.Context, command bson.D) (bson.Raw, error) {
+	client, err := r.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Database(mongoDB).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Raw()
+}
+
+// Explain forwards to the wrapped repository, without injecting faults
+func (r chaosRepository) Explain(ctx context.Context, command bson.D) (bson.Raw, error) {
+	if e, ok := r.next.(explainer); ok {
+		return e.Explain(ctx, command)
+	}
+
+	return nil, errNoExplain
+}
+
+// flagSlow marks the span of op as a slow query when it ran for longer than
+// the threshold of its operation, counts it, and explains it if enabled
+func (r *instrumentedRepository) flagSlow(ctx context.Context, op *dbOperation, elapsed time.Duration, attrs []attribute.KeyValue) {
+	threshold := slowQueryThreshold(op.name)
+	if elapsed <= threshold {
+		return
+	}
+
+	op.span.SetAttributes(attribute.Bool("db.slow_query", true))
+	op.span.AddEvent("db.query.long", trace.WithAttributes(
+		attribute.Float64("db.query.duration", elapsed.Seconds()),
+		attribute.Float64("db.query.threshold", threshold.Seconds()),
+	))
+	r.slowOperations.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+	if !explainSlowQueries || op.explain == nil || r.explainer == nil || !op.span.IsRecording() {
+		return
+	}
+
+	// the operation's context may be the one that just ran out
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), explainTimeout)
+	defer cancel()
+
+	plan, err := r.explainer.Explain(ctx, op.explain)
+	if err != nil {
+		op.span.AddEvent("db.query.explain", trace.WithAttributes(
+			attribute.String("error.message", err.Error()),
+		))
+		return
+	}
+
+	stages, indexes := planSummary(plan)
+	op.span.AddEvent("db.query.explain", trace.WithAttributes(
+		attribute.String("db.query.plan", strings.Join(stages, " > ")),
+		attribute.StringSlice("db.query.plan.indexes", indexes),
+		attribute.Bool("db.query.plan.collection_scan", containsStage(stages, "COLLSCAN")),
+	))
+}
+
+// planSummary lists the stages of the winning plan of an explain output from
+// the top, and the indexes it uses. The plan is nested differently for finds,
+// aggregations and the slot based engine, it's looked for anywhere.
+func planSummary(explain bson.Raw) (stages, indexes []string) {
+	plan, ok := findWinningPlan(explain)
+	if !ok {
+		return nil, nil
+	}
+	if queryPlan, ok := plan.Lookup("queryPlan").DocumentOK(); ok {
+		plan = queryPlan
+	}
+
+	var walk func(stage bson.Raw)
+	walk = func(stage bson.Raw) {
+		if name, ok := stage.Lookup("stage").StringValueOK(); ok {
+			stages = append(stages, name)
+		}
+		if index, ok := stage.Lookup("indexName").StringValueOK(); ok {
+			indexes = append(indexes, index)
+		}
+		if input, ok := stage.Lookup("inputStage").DocumentOK(); ok {
+			walk(input)
+		}
+		if inputs, ok := stage.Lookup("inputStages").ArrayOK(); ok {
+			values, _ := inputs.Values()
+			for _, v := range values {
+				if input, ok := v.DocumentOK(); ok {
+					walk(input)
+				}
+			}
+		}
+	}
+	walk(plan)
+
+	return stages, indexes
+}
+
+func findWinningPlan(doc bson.Raw) (bson.Raw, bool) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, false
+	}
+
+	for _, e := range elements {
+		v := e.Value()
+		if e.Key() == "winningPlan" {
+			return v.DocumentOK()
+		}
+		if sub, ok := v.DocumentOK(); ok {
+			if plan, ok := findWinningPlan(sub); ok {
+				return plan, true
+			}
+		}
+		if arr, ok := v.ArrayOK(); ok {
+			if plan, ok := findWinningPlan(bson.Raw(arr)); ok {
+				return plan, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func containsStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errNoExplain is returned when the wrapped repository can't explain queries
+var errNoExplain = errors.New("explain isn't supported by the repository")
@@ -0,0 +1,122 @@
+package userstore
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/lifecycle"
+	"github.com/neha-gupta1/otel-semantics/pkg/logging"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startupRetryInterval is how long a failed startup hook waits before it's retried
+const startupRetryInterval = 2 * time.Second
+
+// ready is flipped once every startup hook has passed
+var ready atomic.Bool
+
+// Flusher is implemented by the SDK tracer provider
+type Flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+// exporterVerifier is implemented by tel.Telemetry, which exports a probe
+// span to check the backend can be reached
+type exporterVerifier interface {
+	VerifyExporter(ctx context.Context) error
+}
+
+// Hooks are the lifecycle hooks of the userstore, in order: the dependency
+// checks, the cache warm up, the exporter check, the background jobs, and the
+// readiness flag, which is the first thing cleared when the service stops.
+func Hooks(tp Flusher) []lifecycle.Hook {
+	// flushing only verifies the exporters that can't fail, like the
+	// in-memory one of the fixtures
+	verify := tp.ForceFlush
+	if v, ok := tp.(exporterVerifier); ok {
+		verify = v.VerifyExporter
+	}
+
+	hooks := []lifecycle.Hook{
+		{Name: "mongo.connect", OnStart: repo.Ping, RetryInterval: startupRetryInterval},
+		{Name: "mongo.ensure_indexes", OnStart: repo.EnsureIndexes, RetryInterval: startupRetryInterval},
+	}
+
+	if migrateOnStartup {
+		hooks = append(hooks, lifecycle.Hook{Name: "mongo.migrate", RetryInterval: startupRetryInterval, OnStart: func(ctx context.Context) error {
+			_, err := repo.Migrate(ctx)
+			return err
+		}})
+	}
+
+	return append(hooks,
+		lifecycle.Hook{Name: "cache.warm", OnStart: warmCache},
+		lifecycle.Hook{Name: "exporter.verify", OnStart: verify, OnStop: tp.ForceFlush, RetryInterval: startupRetryInterval},
+		lifecycle.Hook{Name: "cron", OnStart: scheduler.Start, OnStop: scheduler.Stop},
+		lifecycle.Hook{
+			Name: "service.ready",
+			OnStart: func(ctx context.Context) error {
+				ready.Store(true)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				ready.Store(false)
+				return nil
+			},
+		},
+	)
+}
+
+// warmCache fills the response cache before the first requests. It's best
+// effort: a cold cache only makes the first requests slower.
+func warmCache(ctx context.Context) error {
+	if err := userCache.warm(ctx, cacheWarmPaths); err != nil {
+		logging.FromContext(ctx).Warn("Cache warm up failed", "error", err)
+		trace.SpanFromContext(ctx).AddEvent("Cache warm up failed", trace.WithAttributes(
+			attribute.String("error.message", err.Error()),
+		))
+	}
+
+	return nil
+}
+
+// RunStartup runs the start hooks against the dependencies, verifying the
+// exporter of tp, and marks the service as ready once they all pass.
+// Services stopping gracefully use a lifecycle.Manager with Hooks instead.
+func RunStartup(ctx context.Context, tp Flusher) {
+	lc := lifecycle.New()
+	lc.Append(Hooks(tp)...)
+	if err := lc.Start(ctx); err != nil {
+		logging.FromContext(ctx).Error("Startup aborted", "error", err)
+	}
+}
+
+// readinessGate rejects traffic with 503 until startup has finished, except for
+// the health endpoints themselves and the requests of the service to itself.
+func readinessGate(c *gin.Context) {
+	if ready.Load() || c.FullPath() == "/healthz" || c.FullPath() == "/readyz" || isInternal(tel.Ctx(c)) {
+		c.Next()
+		return
+	}
+
+	trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attribute.Bool("service.ready", false))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "service is starting"})
+}
+
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func Readyz(c *gin.Context) {
+	if !ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "starting"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,41 @@
+package userstore
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GetUserStats returns the number of users by signup month
+func GetUserStats(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUserStats")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	stats, err := repo.Stats(ctx)
+	if err != nil {
+		span.AddEvent("Error aggregating user stats", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error aggregating user stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,93 @@
+package userstore
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userListLimit caps the users GET /user returns, from USER_LIST_LIMIT
+var userListLimit = intFromEnv("USER_LIST_LIMIT", 10000)
+
+// userListBatchSize is the cursor batch size of the user list, the most
+// documents held in memory while streaming
+const userListBatchSize = 500
+
+// streamAbortedKey marks in the gin context a 200 whose body was cut off, so
+// the cache doesn't store it
+const streamAbortedKey = "response.stream_aborted"
+
+// userList writes the {"user": [...]} body of GET /user. In JSON every user is
+// written as soon as it's added, so memory doesn't grow with the collection;
+// the other representations are buffered and encoded by respond.
+type userList struct {
+	c       *gin.Context
+	stream  bool
+	enc     *json.Encoder
+	encoded time.Duration
+	started bool
+	users   []any
+}
+
+func newUserList(c *gin.Context) *userList {
+	return &userList{c: c, stream: encoderFor(c).name == encoders[0].name, enc: json.NewEncoder(c.Writer), users: []any{}}
+}
+
+func (l *userList) add(user any) error {
+	if !l.stream {
+		l.users = append(l.users, user)
+		return nil
+	}
+
+	if !l.started {
+		l.start()
+	} else if _, err := l.c.Writer.WriteString(","); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	defer func() { l.encoded += time.Since(start) }()
+
+	return l.enc.Encode(user)
+}
+
+// start writes the headers and the opening of the body
+func (l *userList) start() {
+	l.started = true
+	l.c.Header("Content-Type", encoders[0].contentType)
+	l.c.Status(http.StatusOK)
+	l.c.Writer.WriteString(`{"user":[`)
+}
+
+// abort gives up on a started body, the client gets it cut off
+func (l *userList) abort() {
+	l.c.Set(streamAbortedKey, true)
+}
+
+// close ends the body. A buffered list gets an ETag and can be answered with
+// 304, a streamed one is sent before there is anything to hash.
+func (l *userList) close(span trace.Span) {
+	if !l.stream {
+		if writeConditional(l.c, span, l.users) {
+			return
+		}
+		respond(l.c, http.StatusOK, gin.H{"user": l.users})
+		return
+	}
+
+	if !l.started {
+		l.start()
+	}
+	l.c.Writer.WriteString("]}")
+
+	encodeDuration.Record(tel.Ctx(l.c), l.encoded.Seconds(), metric.WithAttributes(
+		attribute.String("http.route", l.c.FullPath()),
+		attribute.String("http.response.content_type", encoders[0].name),
+	))
+}
@@ -0,0 +1,147 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultRequestTimeout bounds every route unless it's given its own timeout.
+// It can be overridden with REQUEST_TIMEOUT (e.g. "2s").
+var defaultRequestTimeout = requestTimeoutFromEnv(5 * time.Second)
+
+// adminRequestTimeout is used by the bulk admin routes which may touch many documents
+const adminRequestTimeout = 30 * time.Second
+
+// uploadRequestTimeout leaves time for clients on slow links to send their files
+const uploadRequestTimeout = 30 * time.Second
+
+// exportRequestTimeout leaves time to stream the whole collection to slow clients
+const exportRequestTimeout = 10 * time.Minute
+
+func requestTimeoutFromEnv(fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT"))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+
+	return d
+}
+
+// requestTimeout cancels the request context once d has elapsed, which in turn
+// cancels any DB queries made with it. Clients can ask for less with
+// X-Request-Timeout or grpc-timeout, never for more. If the handler hasn't
+// written anything by then, a 504 is returned.
+func requestTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := trace.SpanFromContext(tel.Ctx(c))
+
+		timeout := d
+		if requested, ok := clientTimeout(c.Request.Header); ok {
+			span.SetAttributes(attribute.Float64("http.request.timeout", requested.Seconds()))
+			if requested < timeout {
+				timeout = requested
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(tel.Ctx(c), timeout)
+		defer cancel()
+
+		span.SetAttributes(attribute.Float64("http.server.request.timeout", timeout.Seconds()))
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			abortWithTimeout(c)
+		}
+	}
+}
+
+// clientTimeout reads the time the client is willing to wait from
+// X-Request-Timeout, a duration ("1.5s") or a number of seconds, or from
+// grpc-timeout ("500m")
+func clientTimeout(h http.Header) (time.Duration, bool) {
+	if v := h.Get("X-Request-Timeout"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d, true
+		}
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			if secs >= maxDuration.Seconds() {
+				return maxDuration, true
+			}
+			return time.Duration(secs * float64(time.Second)), true
+		}
+		return 0, false
+	}
+
+	return grpcTimeout(h.Get("Grpc-Timeout"))
+}
+
+// grpcTimeoutUnits are the units of the grpc-timeout header
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// maxDuration is what timeouts too long for a time.Duration are clamped to,
+// longer than any route allows anyway
+const maxDuration = time.Duration(math.MaxInt64)
+
+// grpcTimeout parses up to 8 digits followed by a unit. 99999999H doesn't fit
+// in a time.Duration, such timeouts are clamped to maxDuration.
+func grpcTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+
+	if n > uint64(maxDuration/unit) {
+		return maxDuration, true
+	}
+
+	return time.Duration(n) * unit, true
+}
+
+// isTimeout reports whether err was caused by the request deadline
+func isTimeout(c *gin.Context, err error) bool {
+	if !errors.Is(tel.Ctx(c).Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	return isDeadlineExceeded(err)
+}
+
+// isDeadlineExceeded reports whether err is a context deadline or driver timeout
+func isDeadlineExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)
+}
+
+// abortWithTimeout answers with 504 and marks the server span as timed out
+func abortWithTimeout(c *gin.Context) {
+	trace.SpanFromContext(tel.Ctx(c)).SetAttributes(attribute.String("error.type", "deadline_exceeded"))
+	abortWithProblem(c, http.StatusGatewayTimeout, "Request timed out", "the request did not complete within the configured timeout")
+}
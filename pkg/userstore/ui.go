@@ -0,0 +1,68 @@
+package userstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// uiTemplates are the pages served under /ui, installed on the router by Register
+var uiTemplates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// GetUsersPage renders the list of users as an HTML page. It's served under
+// /ui so http.route tells the browser traffic apart from the JSON API.
+func GetUsersPage(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUsersPage")
+	defer span.End()
+
+	users, err := repo.FindAll(ctx, nil)
+	if err != nil {
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.String(http.StatusInternalServerError, "Error fetching user details")
+		return
+	}
+
+	renderHTML(ctx, c, http.StatusOK, "users.html", gin.H{
+		"Users":   users,
+		"TraceID": span.SpanContext().TraceID().String(),
+	})
+}
+
+// renderHTML renders the template name in a child span of the one in ctx, so
+// the time spent in the template shows up on its own
+func renderHTML(ctx context.Context, c *gin.Context, status int, name string, data any) {
+	_, span := tel.HTTPScope.StartInternalSpan(ctx, "render "+name, trace.WithAttributes(
+		attribute.String("go.template", name),
+	))
+	defer span.End()
+
+	// gin panics when the template fails, record it before Recovery answers 500
+	defer func() {
+		if r := recover(); r != nil {
+			span.RecordError(fmt.Errorf("rendering %s: %v", name, r))
+			span.SetStatus(codes.Error, "template failure")
+			panic(r)
+		}
+	}()
+
+	c.HTML(status, name, data)
+}
@@ -0,0 +1,189 @@
+package userstore
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neha-gupta1/otel-semantics/pkg/tel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UserV2 is the user schema of the v2 API: the phone number is a string named
+// phone rather than the phone_no integer of v1
+type UserV2 struct {
+	ID    string `json:"id" binding:"required"`
+	Name  string `json:"name" binding:"required"`
+	Phone string `json:"phone" binding:"required,numeric"`
+
+	Password Password `json:"password,omitempty"`
+}
+
+func toV2(u Users) UserV2 {
+	return UserV2{ID: u.ID, Name: u.Name, Phone: strconv.Itoa(u.PhoneNo)}
+}
+
+func usersToV2(users []Users) []UserV2 {
+	out := make([]UserV2, 0, len(users))
+	for _, u := range users {
+		out = append(out, toV2(u))
+	}
+
+	return out
+}
+
+// fromV2 converts to the stored schema, refusing phones that aren't integers
+func fromV2(u UserV2) (Users, error) {
+	phone, err := strconv.Atoi(u.Phone)
+	if err != nil {
+		return Users{}, errors.New("phone must be a number")
+	}
+
+	return Users{ID: u.ID, Name: u.Name, PhoneNo: phone, Password: u.Password}, nil
+}
+
+// GetUsersV2 returns every user with the v2 schema
+func GetUsersV2(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUsersV2")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	users, err := repo.FindAll(ctx, nil)
+	if err != nil {
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user details"})
+		return
+	}
+
+	details := usersToV2(users)
+	if writeConditional(c, span, details) {
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"users": details,
+	})
+}
+
+// GetUserByIDV2 returns the user stored under the ObjectID in the path with
+// the v2 schema
+func GetUserByIDV2(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "GetUserByIDV2")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	id, ok := parseUserID(c, span)
+	if !ok {
+		return
+	}
+
+	user, err := repo.FindByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		abortWithProblem(c, http.StatusNotFound, "User not found", "no user with id "+id.Hex())
+		return
+	}
+	if err != nil {
+		span.AddEvent("Error fetching user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user details"})
+		return
+	}
+
+	details := toV2(user)
+	if writeConditional(c, span, details) {
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"user": details,
+	})
+}
+
+// PostUserV2 stores a user sent with the v2 schema
+func PostUserV2(c *gin.Context) {
+	ctx, span := tel.HTTPScope.StartInternalSpan(tel.Ctx(c), "PostUserV2")
+	defer span.End()
+
+	if err := authMiddleware(c, span); err != nil {
+		return
+	}
+
+	username := c.GetString("username")
+	span.SetAttributes(attribute.String("user.name", username))
+
+	body := UserV2{}
+	err := c.ShouldBindJSON(&body)
+	var user Users
+	if err == nil {
+		user, err = fromV2(body)
+	}
+	if err != nil {
+		span.AddEvent("Validation Error", trace.WithAttributes(
+			attribute.String("event.category", "validation"),
+			attribute.String("event.type", "error"),
+			attribute.String("http.method", "POST"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		abortWithProblem(c, http.StatusBadRequest, "Invalid user", err.Error())
+		return
+	}
+
+	if !storePassword(ctx, c, span, &user) {
+		return
+	}
+
+	details, err := repo.Insert(ctx, user)
+	if err != nil {
+		span.AddEvent("Error posting user details", trace.WithAttributes(
+			attribute.String("event.category", "error"),
+			attribute.String("event.type", "db"),
+			attribute.String("db.system", "mongodb"),
+			attribute.String("error.message", err.Error()),
+			attribute.String("user.name", username),
+		))
+		if isTimeout(c, err) {
+			abortWithTimeout(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error posting user details"})
+		return
+	}
+
+	userCache.invalidate()
+
+	respond(c, http.StatusOK, gin.H{
+		"user": toV2(details),
+	})
+}